@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// refreshTimeout is the time limit of refreshing and saving a token, which
+// isn't cut short by the request that was rejected being cancelled
+const refreshTimeout = 30 * time.Second
+
+// AuthTransport is an http.RoundTripper that authenticates requests with the
+// current Snyk token. When a request is rejected with 401 Unauthorized, the
+// token is refreshed once, saved, and the request is replayed with it.
+// Requests failing at the same time share a single refresh.
+type AuthTransport struct {
+	// Base is the transport used to send requests, http.DefaultTransport if nil
+	Base      http.RoundTripper
+	Provider  TokenProvider
+	Refresher TokenRefresher
+	// Logger receives failures to refresh the token, slog.Default() if nil
+	Logger *slog.Logger
+
+	mu    sync.Mutex
+	token *TokenStorage
+}
+
+// NewAuthTransport creates an AuthTransport starting with the given token
+func NewAuthTransport(base http.RoundTripper, token *TokenStorage, provider TokenProvider, refresher TokenRefresher) *AuthTransport {
+	return &AuthTransport{
+		Base:      base,
+		Provider:  provider,
+		Refresher: refresher,
+		token:     token,
+	}
+}
+
+// Token returns the current token
+func (t *AuthTransport) Token() *TokenStorage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.token
+}
+
+// RoundTrip sends the request, refreshing the token and replaying the request
+// once if it is rejected with 401 Unauthorized
+func (t *AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := t.Token()
+	resp, err := t.send(req, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// Keep the rejected response around in case the token can't be refreshed
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	refreshed, err := t.refresh(req.Context(), token)
+	if err != nil {
+		t.logger().Warn("Snyk API token refresh failed", "error", err)
+		return resp, nil
+	}
+
+	// A request with a body can only be replayed if it can be read again
+	replay := req
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		replay = req.Clone(req.Context())
+		if replay.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+
+	return t.send(replay, refreshed)
+}
+
+// send sends a copy of the request authenticated with the token
+func (t *AuthTransport) send(req *http.Request, token *TokenStorage) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if token == nil {
+		return base.RoundTrip(req)
+	}
+
+	authReq := req.Clone(req.Context())
+	authReq.Header.Set("Authorization", fmt.Sprintf("%s %s", token.AuthScheme(), token.AccessToken))
+	return base.RoundTrip(authReq)
+}
+
+// refresh replaces the rejected token with a new one, unless another request
+// already did so since the rejected token was sent
+func (t *AuthTransport) refresh(ctx context.Context, rejected *TokenStorage) (*TokenStorage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != rejected {
+		return t.token, nil
+	}
+
+	if rejected == nil || t.Refresher == nil {
+		return nil, fmt.Errorf("token can't be refreshed")
+	}
+
+	// Refresh tokens are rotated, so once the refresh is sent the new token
+	// must be saved even if the request is cancelled meanwhile, or the next
+	// run is left with a refresh token that was already used
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	defer cancel()
+
+	tokenResp, err := t.Refresher.RefreshToken(ctx, rejected.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	t.token = NewTokenStorage(tokenResp)
+
+	// The new token works for this run even if it can't be saved for the next
+	if t.Provider != nil {
+		if err := t.Provider.SaveToken(ctx, t.token); err != nil {
+			t.logger().Warn("Failed to save refreshed Snyk API token", "error", err)
+		}
+	}
+
+	return t.token, nil
+}
+
+// logger returns the transport's logger, or the default logger if it has none
+func (t *AuthTransport) logger() *slog.Logger {
+	if t.Logger != nil {
+		return t.Logger
+	}
+	return slog.Default()
+}
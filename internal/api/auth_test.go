@@ -0,0 +1,159 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// countingTokenRefresher counts the refreshes it performs
+type countingTokenRefresher struct {
+	refreshes atomic.Int32
+	err       error
+	// ctxErr is the error of the context of the last refresh
+	ctxErr error
+}
+
+func (r *countingTokenRefresher) RefreshToken(ctx context.Context, refreshToken string) (*api.TokenResponse, error) {
+	r.refreshes.Add(1)
+	r.ctxErr = ctx.Err()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// Give concurrent requests time to pile up behind the refresh
+	time.Sleep(20 * time.Millisecond)
+	return &api.TokenResponse{
+		AccessToken:  "new-token",
+		RefreshToken: "new-refresh-token",
+		TokenType:    "bearer",
+		ExpiresIn:    3600,
+	}, nil
+}
+
+var _ = Describe("AuthTransport", func() {
+	var (
+		ctx       = context.Background()
+		server    *httptest.Server
+		client    *api.SnykClient
+		provider  *MockTokenProvider
+		refresher *countingTokenRefresher
+		rejected  atomic.Int32
+	)
+
+	BeforeEach(func() {
+		rejected.Store(0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer new-token" {
+				rejected.Add(1)
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"errors": [{"detail": "token expired"}]}`))
+				return
+			}
+			w.Write([]byte(`{"data": [{"id": "org-id-1", "attributes": {"name": "Organization 1", "slug": "org-1"}}]}`))
+		}))
+
+		provider = &MockTokenProvider{}
+		refresher = &countingTokenRefresher{}
+		token := &api.TokenStorage{
+			AccessToken:  "old-token",
+			TokenType:    "bearer",
+			RefreshToken: "refresh-token",
+			Expiry:       time.Now().Add(time.Hour),
+		}
+
+		client = &api.SnykClient{
+			APIToken:    "old-token",
+			RestBaseURL: server.URL,
+			HTTPClient:  &http.Client{Transport: api.NewAuthTransport(http.DefaultTransport, token, provider, refresher)},
+			PageLimit:   api.DefaultPageLimit,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("refreshes a rejected token, saves it and replays the request", func() {
+		orgs, err := client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orgs).To(HaveLen(1))
+		Expect(refresher.refreshes.Load()).To(BeEquivalentTo(1))
+		Expect(provider.saved.AccessToken).To(Equal("new-token"))
+		Expect(provider.saved.RefreshToken).To(Equal("new-refresh-token"))
+	})
+
+	It("keeps using the refreshed token", func() {
+		_, err := client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rejected.Load()).To(BeEquivalentTo(1))
+		Expect(refresher.refreshes.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("shares a single refresh between concurrent requests", func() {
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := client.GetOrganizations(ctx)
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(refresher.refreshes.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("returns the original 401 when the token can't be refreshed", func() {
+		refresher.err = context.DeadlineExceeded
+
+		_, err := client.GetOrganizations(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("unexpected status code: 401"))
+		Expect(err.Error()).To(ContainSubstring("token expired"))
+		Expect(refresher.refreshes.Load()).To(BeEquivalentTo(1))
+		Expect(provider.saved).To(BeNil())
+	})
+
+	It("saves the refreshed token even if the request is cancelled", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Cancel the request once it has been rejected
+		base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			cancel()
+			return resp, err
+		})
+		token := &api.TokenStorage{AccessToken: "old-token", TokenType: "bearer", RefreshToken: "refresh-token"}
+		client.HTTPClient = &http.Client{Transport: api.NewAuthTransport(base, token, provider, refresher)}
+
+		_, err := client.GetOrganizations(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(refresher.refreshes.Load()).To(BeEquivalentTo(1))
+		Expect(refresher.ctxErr).NotTo(HaveOccurred())
+		Expect(provider.saved.RefreshToken).To(Equal("new-refresh-token"))
+	})
+})
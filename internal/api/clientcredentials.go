@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables holding the OAuth client of a Snyk service account
+const (
+	ClientIDEnvVar     = "SNYK_OAUTH_CLIENT_ID"
+	ClientSecretEnvVar = "SNYK_OAUTH_CLIENT_SECRET"
+)
+
+// tokenExpiryMargin is how long before their expiry tokens are replaced, so
+// that they don't expire in flight
+const tokenExpiryMargin = 5 * time.Minute
+
+// ClientCredentialsFromEnv returns the OAuth client ID and secret set in
+// ClientIDEnvVar and ClientSecretEnvVar, or clientID and clientSecret if
+// neither is set
+func ClientCredentialsFromEnv(clientID string, clientSecret string) (string, string, error) {
+	envID, envSecret := strings.TrimSpace(os.Getenv(ClientIDEnvVar)), strings.TrimSpace(os.Getenv(ClientSecretEnvVar))
+	if envID == "" && envSecret == "" {
+		return clientID, clientSecret, nil
+	}
+	if envID == "" || envSecret == "" {
+		return "", "", fmt.Errorf("%s and %s must be set together", ClientIDEnvVar, ClientSecretEnvVar)
+	}
+	return envID, envSecret, nil
+}
+
+// ClientCredentialsTokenProvider implements TokenProvider with the OAuth2
+// client credentials grant of a Snyk service account. Access tokens are kept
+// until they are about to expire, in Cache too if set so that later runs
+// reuse them. It is also the TokenRefresher of its tokens, which come without
+// a refresh token: refreshing them requests a new one.
+type ClientCredentialsTokenProvider struct {
+	ClientID     string
+	ClientSecret string
+	// Refresher requests the tokens from the OAuth2 token endpoint
+	Refresher *OAuth2TokenRefresher
+	// Cache keeps the access token between runs, if set. Tokens it can't
+	// read or save are requested again.
+	Cache TokenProvider
+	// Logger receives failures to use the cache, slog.Default() if nil
+	Logger *slog.Logger
+
+	mu    sync.Mutex
+	token *TokenStorage
+}
+
+// NewClientCredentialsTokenProvider creates a ClientCredentialsTokenProvider
+// requesting tokens with refresher and keeping them in cache, if not nil
+func NewClientCredentialsTokenProvider(clientID string, clientSecret string, refresher *OAuth2TokenRefresher, cache TokenProvider) *ClientCredentialsTokenProvider {
+	return &ClientCredentialsTokenProvider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Refresher:    refresher,
+		Cache:        cache,
+	}
+}
+
+func (p *ClientCredentialsTokenProvider) Name() string {
+	return "OAuth client " + p.ClientID
+}
+
+// GetToken returns the current access token, requesting a new one if it is
+// about to expire
+func (p *ClientCredentialsTokenProvider) GetToken(ctx context.Context) (*TokenStorage, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if fresh(p.token) {
+		return p.token, nil
+	}
+
+	if p.Cache != nil {
+		token, err := p.Cache.GetToken(ctx)
+		if err != nil && !errors.Is(err, ErrNoToken) {
+			p.logger().Info("Failed to read the cached Snyk access token", "error", err)
+		}
+		if err == nil && fresh(token) {
+			p.token = token
+			return token, nil
+		}
+	}
+
+	tokenResp, err := p.Refresher.ClientCredentials(ctx, p.ClientID, p.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	p.token = NewTokenStorage(tokenResp)
+	p.saveToCache(ctx)
+
+	return p.token, nil
+}
+
+// SaveToken replaces the current access token, such as after a refresh
+func (p *ClientCredentialsTokenProvider) SaveToken(ctx context.Context, token *TokenStorage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.token = token
+	p.saveToCache(ctx)
+	return nil
+}
+
+// RefreshToken requests a new access token, as client credentials tokens have
+// no refresh token
+func (p *ClientCredentialsTokenProvider) RefreshToken(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+	return p.Refresher.ClientCredentials(ctx, p.ClientID, p.ClientSecret)
+}
+
+// saveToCache saves the current token in the cache, if there is one. It must
+// be called with p.mu held.
+func (p *ClientCredentialsTokenProvider) saveToCache(ctx context.Context) {
+	if p.Cache == nil {
+		return
+	}
+	if err := p.Cache.SaveToken(ctx, p.token); err != nil {
+		p.logger().Info("Failed to cache the Snyk access token", "error", err)
+	}
+}
+
+// logger returns the provider's logger, or the default logger if it has none
+func (p *ClientCredentialsTokenProvider) logger() *slog.Logger {
+	if p.Logger != nil {
+		return p.Logger
+	}
+	return slog.Default()
+}
+
+// fresh reports whether a token is set and isn't about to expire
+func fresh(token *TokenStorage) bool {
+	return token != nil && token.AccessToken != "" && token.Expiry.After(time.Now().Add(tokenExpiryMargin))
+}
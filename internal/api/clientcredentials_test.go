@@ -0,0 +1,149 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("ClientCredentialsTokenProvider", func() {
+	var (
+		ctx      = context.Background()
+		mux      *http.ServeMux
+		server   *httptest.Server
+		requests atomic.Int32
+		cache    *api.EncryptedFileTokenProvider
+		provider *api.ClientCredentialsTokenProvider
+	)
+
+	BeforeEach(func() {
+		requests.Store(0)
+		mux = http.NewServeMux()
+		mux.HandleFunc("POST /oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			Expect(r.PostForm.Get("grant_type")).To(Equal("client_credentials"))
+			if r.PostForm.Get("client_id") != "ci-client" || r.PostForm.Get("client_secret") != "ci-secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error": "invalid_client"}`))
+				return
+			}
+
+			json.NewEncoder(w).Encode(api.TokenResponse{
+				AccessToken: fmt.Sprintf("access-token-%d", requests.Add(1)),
+				TokenType:   "bearer",
+				ExpiresIn:   3600,
+			})
+		})
+		server = httptest.NewServer(mux)
+		DeferCleanup(server.Close)
+
+		cache = api.NewEncryptedFileTokenProvider(GinkgoT().TempDir(), nil)
+		provider = api.NewClientCredentialsTokenProvider("ci-client", "ci-secret", api.NewOAuth2TokenRefresher(server.URL+"/oauth2", nil), cache)
+	})
+
+	It("keeps the access token until it is about to expire", func() {
+		token, err := provider.GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access-token-1"))
+		Expect(token.Expiry).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+		token, err = provider.GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access-token-1"))
+		Expect(requests.Load()).To(BeEquivalentTo(1))
+
+		Expect(provider.SaveToken(ctx, &api.TokenStorage{AccessToken: "expiring", Expiry: time.Now().Add(time.Minute)})).To(Succeed())
+		token, err = provider.GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access-token-2"))
+	})
+
+	It("reuses the cached access token in later runs", func() {
+		_, err := provider.GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		later := api.NewClientCredentialsTokenProvider("ci-client", "ci-secret", api.NewOAuth2TokenRefresher(server.URL+"/oauth2", nil), cache)
+		token, err := later.GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access-token-1"))
+		Expect(requests.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("requests a new access token to refresh the current one", func() {
+		tokenResp, err := provider.RefreshToken(ctx, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tokenResp.AccessToken).To(Equal("access-token-1"))
+	})
+
+	It("fails with a wrong secret", func() {
+		provider.ClientSecret = "wrong-secret"
+		_, err := provider.GetToken(ctx)
+		Expect(err).To(MatchError(ContainSubstring("failed to get token for OAuth client ci-client")))
+	})
+
+	It("is used by the Snyk client to replace rejected tokens", func() {
+		var rejected atomic.Bool
+		mux.HandleFunc("/rest/orgs", func(w http.ResponseWriter, r *http.Request) {
+			// Reject the first token as if it had been revoked
+			if r.Header.Get("Authorization") == "Bearer access-token-1" {
+				rejected.Store(true)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer access-token-2"))
+			w.Write([]byte(`{"data": []}`))
+		})
+
+		endpoint, err := api.NewEndpoint(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		client, err := api.NewSnykClient(ctx, endpoint, provider, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rejected.Load()).To(BeTrue())
+
+		token, err := cache.GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access-token-2"))
+	})
+})
+
+var _ = Describe("ClientCredentialsFromEnv", func() {
+	BeforeEach(func() {
+		GinkgoT().Setenv(api.ClientIDEnvVar, "")
+		GinkgoT().Setenv(api.ClientSecretEnvVar, "")
+	})
+
+	It("prefers the environment", func() {
+		GinkgoT().Setenv(api.ClientIDEnvVar, "env-client")
+		GinkgoT().Setenv(api.ClientSecretEnvVar, "env-secret")
+
+		id, secret, err := api.ClientCredentialsFromEnv("config-client", "config-secret")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("env-client"))
+		Expect(secret).To(Equal("env-secret"))
+	})
+
+	It("falls back to the configuration", func() {
+		id, secret, err := api.ClientCredentialsFromEnv("config-client", "config-secret")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("config-client"))
+		Expect(secret).To(Equal("config-secret"))
+	})
+
+	It("needs both the ID and the secret", func() {
+		GinkgoT().Setenv(api.ClientIDEnvVar, "env-client")
+
+		_, _, err := api.ClientCredentialsFromEnv("", "")
+		Expect(err).To(MatchError(ContainSubstring("must be set together")))
+	})
+})
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// revalidatedHeader marks a response served from a ResponseCache after the
+// Snyk API answered 304 Not Modified
+const revalidatedHeader = "X-Snyk-Auto-Org-Revalidated"
+
+// CachedResponse is a response body stored with the validators it was sent with
+type CachedResponse struct {
+	ETag         string
+	LastModified string
+	Body         []byte
+}
+
+// ResponseCache stores the bodies of responses by request URL
+type ResponseCache interface {
+	// GetResponse returns the response stored for the URL, or nil if there is none
+	GetResponse(ctx context.Context, url string) (*CachedResponse, error)
+	StoreResponse(ctx context.Context, url string, resp *CachedResponse) error
+}
+
+// CachingTransport is an http.RoundTripper that makes GET requests conditional.
+// Responses with an ETag or Last-Modified header are stored in Cache, and when
+// the same URL is requested again, If-None-Match and If-Modified-Since are sent
+// with it. A 304 Not Modified answer is turned into the stored response, which
+// IsRevalidated reports.
+type CachingTransport struct {
+	// Base is the transport used to send requests, http.DefaultTransport if nil
+	Base  http.RoundTripper
+	Cache ResponseCache
+}
+
+// NewCachingTransport creates a CachingTransport storing responses in cache
+func NewCachingTransport(base http.RoundTripper, cache ResponseCache) *CachingTransport {
+	return &CachingTransport{Base: base, Cache: cache}
+}
+
+// RoundTrip sends the request, conditionally if a response to it is cached
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if req.Method != http.MethodGet {
+		return base.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+
+	// A broken cache only costs us the conditional request
+	cached, _ := t.Cache.GetResponse(req.Context(), key)
+	if cached != nil && (cached.ETag != "" || cached.LastModified != "") {
+		req = req.Clone(req.Context())
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+
+		header := resp.Header.Clone()
+		header.Set(revalidatedHeader, "true")
+		header.Set("Content-Length", strconv.Itoa(len(cached.Body)))
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+			ContentLength: int64(len(cached.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && lastModified == "") {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Failing to store the response only costs us the next conditional request
+	_ = t.Cache.StoreResponse(req.Context(), key, &CachedResponse{ETag: etag, LastModified: lastModified, Body: body})
+
+	return resp, nil
+}
+
+// IsRevalidated reports whether the response was served from a ResponseCache
+// because the Snyk API answered 304 Not Modified
+func IsRevalidated(resp *http.Response) bool {
+	return resp.Header.Get(revalidatedHeader) != ""
+}
@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+// memoryResponseCache is a ResponseCache kept in memory
+type memoryResponseCache struct {
+	mu        sync.Mutex
+	responses map[string]*api.CachedResponse
+}
+
+func (c *memoryResponseCache) GetResponse(ctx context.Context, url string) (*api.CachedResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.responses[url], nil
+}
+
+func (c *memoryResponseCache) StoreResponse(ctx context.Context, url string, resp *api.CachedResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responses[url] = resp
+	return nil
+}
+
+var _ = Describe("CachingTransport", func() {
+	var (
+		ctx         = context.Background()
+		server      *httptest.Server
+		client      *api.SnykClient
+		etag        string
+		conditional []string
+	)
+
+	BeforeEach(func() {
+		etag = `W/"targets-1"`
+		conditional = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conditional = append(conditional, r.Header.Get("If-None-Match"))
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			w.Header().Set("ETag", etag)
+			w.Write([]byte(`{"data": [{"id": "target-id-1", "attributes": {"displayName": "org/repo", "url": "https://github.com/org/repo"}}]}`))
+		}))
+
+		cache := &memoryResponseCache{responses: make(map[string]*api.CachedResponse)}
+		client = &api.SnykClient{
+			APIToken:    "token",
+			RestBaseURL: server.URL,
+			HTTPClient:  &http.Client{Transport: api.NewCachingTransport(http.DefaultTransport, cache)},
+			PageLimit:   10,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("revalidates cached responses and reports them unchanged", func() {
+		targets, modified, err := client.GetTargetsIfModified(ctx, "org-id-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(modified).To(BeTrue())
+		Expect(targets).To(HaveLen(1))
+
+		targets, modified, err = client.GetTargetsIfModified(ctx, "org-id-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(modified).To(BeFalse())
+		Expect(targets).To(HaveLen(1))
+		Expect(targets[0].Attributes.URL).To(Equal("https://github.com/org/repo"))
+
+		Expect(conditional).To(Equal([]string{"", etag}))
+	})
+
+	It("reports responses with a new ETag as modified", func() {
+		_, _, err := client.GetTargetsIfModified(ctx, "org-id-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		etag = `W/"targets-2"`
+		_, modified, err := client.GetTargetsIfModified(ctx, "org-id-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(modified).To(BeTrue())
+	})
+
+	It("serves cached bodies to callers unaware of revalidation", func() {
+		_, err := client.GetTargets(ctx, "org-id-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		targets, err := client.GetTargets(ctx, "org-id-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Keys of the Snyk CLI configuration
+const (
+	configKeyAPI          = "api"
+	configKeyEndpoint     = "endpoint"
+	configKeyOAuthStorage = "INTERNAL_OAUTH_TOKEN_STORAGE"
+)
+
+// ConfigStore reads and writes the configuration file the Snyk CLI keeps with
+// the configstore package, without running the CLI
+type ConfigStore struct {
+	// Path is the path of the configuration file
+	Path string
+}
+
+// NewConfigStore returns the Snyk CLI configuration of the current user, at
+// $XDG_CONFIG_HOME/configstore/snyk.json or ~/.config/configstore/snyk.json
+func NewConfigStore() (*ConfigStore, error) {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return &ConfigStore{Path: filepath.Join(configHome, "configstore", "snyk.json")}, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return &ConfigStore{Path: filepath.Join(homeDir, filepath.FromSlash(SnykConfigPath))}, nil
+}
+
+// Get returns the value of a key, or "" if it isn't set
+func (s *ConfigStore) Get(key string) (string, error) {
+	values, err := s.read()
+	if err != nil {
+		return "", err
+	}
+
+	raw, ok := values[key]
+	if !ok {
+		return "", nil
+	}
+
+	// Values are stored as strings, but keep anything else as raw JSON
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return string(raw), nil
+	}
+	return value, nil
+}
+
+// Set sets the value of a key, keeping the other keys as they are
+func (s *ConfigStore) Set(key string, value string) error {
+	values, err := s.read()
+	if errors.Is(err, os.ErrNotExist) {
+		values = make(map[string]json.RawMessage)
+	} else if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Snyk config value: %w", err)
+	}
+	values[key] = raw
+
+	return s.write(values)
+}
+
+// Unset removes a key, keeping the other keys as they are
+func (s *ConfigStore) Unset(key string) error {
+	values, err := s.read()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if _, ok := values[key]; !ok {
+		return nil
+	}
+	delete(values, key)
+
+	return s.write(values)
+}
+
+// write replaces the configuration file with the values. The file is replaced
+// atomically so the Snyk CLI never sees it half written.
+func (s *ConfigStore) write(values map[string]json.RawMessage) error {
+	// Indent with tabs like configstore does
+	data, err := json.MarshalIndent(values, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal Snyk config: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create Snyk config directory: %w", err)
+	}
+
+	if err := writeFileAtomic(s.Path, data); err != nil {
+		return fmt.Errorf("failed to write Snyk config: %w", err)
+	}
+
+	return nil
+}
+
+// read returns the raw values of the configuration file
+func (s *ConfigStore) read() (map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Snyk config: %w", err)
+	}
+
+	values := make(map[string]json.RawMessage)
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return values, nil
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse Snyk config: %w", err)
+	}
+
+	return values, nil
+}
+
+// ConfigStoreTokenProvider implements TokenProvider using the OAuth token
+// storage in the Snyk CLI config file
+type ConfigStoreTokenProvider struct {
+	Store *ConfigStore
+}
+
+func (p *ConfigStoreTokenProvider) Name() string {
+	return p.Store.Path + " " + configKeyOAuthStorage
+}
+
+func (p *ConfigStoreTokenProvider) GetToken(ctx context.Context) (*TokenStorage, error) {
+	value, err := p.Store.Get(configKeyOAuthStorage)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, ErrNoToken
+	}
+
+	var tokenStorage TokenStorage
+	if err := json.Unmarshal([]byte(value), &tokenStorage); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token storage: %w", err)
+	}
+
+	return &tokenStorage, nil
+}
+
+func (p *ConfigStoreTokenProvider) SaveToken(ctx context.Context, token *TokenStorage) error {
+	tokenBytes, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal token storage: %w", err)
+	}
+
+	if err := p.Store.Set(configKeyOAuthStorage, string(tokenBytes)); err != nil {
+		return fmt.Errorf("failed to save token storage: %w", err)
+	}
+
+	return nil
+}
+
+// MigrateToken moves the OAuth token storage out of the Snyk CLI config into
+// another TokenProvider, removing it from the config once it has been saved
+func (p *ConfigStoreTokenProvider) MigrateToken(ctx context.Context, to TokenProvider) error {
+	token, err := p.GetToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := to.SaveToken(ctx, token); err != nil {
+		return err
+	}
+
+	if err := p.Store.Unset(configKeyOAuthStorage); err != nil {
+		return fmt.Errorf("failed to remove token storage from Snyk config: %w", err)
+	}
+
+	return nil
+}
+
+// ConfigStoreAPITokenProvider implements TokenProvider using the API token in
+// the Snyk CLI config file
+type ConfigStoreAPITokenProvider struct {
+	Store *ConfigStore
+}
+
+func (p *ConfigStoreAPITokenProvider) Name() string {
+	return p.Store.Path + " " + configKeyAPI
+}
+
+func (p *ConfigStoreAPITokenProvider) GetToken(ctx context.Context) (*TokenStorage, error) {
+	token, err := p.Store.Get(configKeyAPI)
+	if err != nil {
+		return nil, err
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrNoToken
+	}
+
+	return &TokenStorage{AccessToken: token, TokenType: AuthSchemeToken}, nil
+}
+
+func (p *ConfigStoreAPITokenProvider) SaveToken(ctx context.Context, token *TokenStorage) error {
+	return fmt.Errorf("cannot save a refreshed token as a Snyk API token")
+}
+
+// FallbackTokenProvider implements TokenProvider using Primary, and Fallback
+// only if Primary fails for a reason other than having no token configured,
+// such as the Snyk config file being missing or unreadable
+type FallbackTokenProvider struct {
+	Primary  TokenProvider
+	Fallback TokenProvider
+	used     TokenProvider
+}
+
+// Name describes the provider that supplied the last token
+func (p *FallbackTokenProvider) Name() string {
+	provider := p.used
+	if provider == nil {
+		provider = p.Primary
+	}
+	if named, ok := provider.(NamedTokenProvider); ok {
+		return named.Name()
+	}
+	return "token provider"
+}
+
+func (p *FallbackTokenProvider) GetToken(ctx context.Context) (*TokenStorage, error) {
+	token, err := p.Primary.GetToken(ctx)
+	if err == nil || errors.Is(err, ErrNoToken) {
+		p.used = p.Primary
+		return token, err
+	}
+
+	p.used = p.Fallback
+	return p.Fallback.GetToken(ctx)
+}
+
+// SaveToken saves the token with the provider that supplied it
+func (p *FallbackTokenProvider) SaveToken(ctx context.Context, token *TokenStorage) error {
+	if p.used == nil {
+		return p.Primary.SaveToken(ctx, token)
+	}
+	return p.used.SaveToken(ctx, token)
+}
+
+// GetConfiguredEndpoint returns the endpoint configured in the Snyk CLI,
+// reading its config file directly and running the CLI only if that fails
+func GetConfiguredEndpoint(ctx context.Context) (string, error) {
+	store, err := NewConfigStore()
+	if err == nil {
+		var endpoint string
+		if endpoint, err = store.Get(configKeyEndpoint); err == nil {
+			return strings.TrimSpace(endpoint), nil
+		}
+	}
+
+	return GetCLIEndpoint(ctx)
+}
@@ -0,0 +1,147 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("ConfigStore", func() {
+	var (
+		ctx       = context.Background()
+		configDir string
+		store     *api.ConfigStore
+	)
+
+	BeforeEach(func() {
+		configHome := GinkgoT().TempDir()
+		GinkgoT().Setenv("XDG_CONFIG_HOME", configHome)
+		configDir = filepath.Join(configHome, "configstore")
+
+		var err error
+		store, err = api.NewConfigStore()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	writeConfig := func(values map[string]string) {
+		data, err := json.Marshal(values)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.MkdirAll(configDir, 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(configDir, "snyk.json"), data, 0600)).To(Succeed())
+	}
+
+	It("honors XDG_CONFIG_HOME", func() {
+		Expect(store.Path).To(Equal(filepath.Join(configDir, "snyk.json")))
+	})
+
+	It("reads values and reports missing keys as empty", func() {
+		writeConfig(map[string]string{"api": "api-token"})
+
+		value, err := store.Get("api")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("api-token"))
+
+		value, err = store.Get("endpoint")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(BeEmpty())
+	})
+
+	It("writes values atomically, keeping the other keys", func() {
+		writeConfig(map[string]string{"api": "api-token", "org": "my-org"})
+
+		Expect(store.Set("endpoint", "https://api.eu.snyk.io")).To(Succeed())
+
+		data, err := os.ReadFile(store.Path)
+		Expect(err).NotTo(HaveOccurred())
+		var values map[string]string
+		Expect(json.Unmarshal(data, &values)).To(Succeed())
+		Expect(values).To(Equal(map[string]string{
+			"api":      "api-token",
+			"org":      "my-org",
+			"endpoint": "https://api.eu.snyk.io",
+		}))
+
+		// No temporary files are left behind
+		entries, err := os.ReadDir(configDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("creates the config file if it doesn't exist", func() {
+		Expect(store.Set("api", "api-token")).To(Succeed())
+
+		value, err := store.Get("api")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("api-token"))
+	})
+
+	Describe("ConfigStoreTokenProvider", func() {
+		It("round-trips the OAuth token storage", func() {
+			provider := &api.ConfigStoreTokenProvider{Store: store}
+			_, err := provider.GetToken(ctx)
+			Expect(err).To(HaveOccurred())
+
+			expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+			Expect(provider.SaveToken(ctx, &api.TokenStorage{
+				AccessToken:  "access-token",
+				TokenType:    "bearer",
+				RefreshToken: "refresh-token",
+				Expiry:       expiry,
+			})).To(Succeed())
+
+			token, err := provider.GetToken(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("access-token"))
+			Expect(token.RefreshToken).To(Equal("refresh-token"))
+			Expect(token.Expiry.Equal(expiry)).To(BeTrue())
+		})
+
+		It("reports a config without OAuth token storage as no token", func() {
+			writeConfig(map[string]string{"api": "api-token"})
+
+			_, err := (&api.ConfigStoreTokenProvider{Store: store}).GetToken(ctx)
+			Expect(err).To(MatchError(api.ErrNoToken))
+		})
+	})
+
+	Describe("ConfigStoreAPITokenProvider", func() {
+		It("reads the API token", func() {
+			writeConfig(map[string]string{"api": "api-token"})
+
+			token, err := (&api.ConfigStoreAPITokenProvider{Store: store}).GetToken(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("api-token"))
+			Expect(token.AuthScheme()).To(Equal(api.AuthSchemeToken))
+		})
+	})
+
+	Describe("FallbackTokenProvider", func() {
+		var fallback *MockTokenProvider
+
+		BeforeEach(func() {
+			fallback = &MockTokenProvider{token: &api.TokenStorage{AccessToken: "cli-token"}}
+		})
+
+		It("uses the fallback when the config file can't be read", func() {
+			provider := &api.FallbackTokenProvider{Primary: &api.ConfigStoreAPITokenProvider{Store: store}, Fallback: fallback}
+
+			token, err := provider.GetToken(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("cli-token"))
+		})
+
+		It("doesn't use the fallback when the config file has no token", func() {
+			writeConfig(map[string]string{"org": "my-org"})
+			provider := &api.FallbackTokenProvider{Primary: &api.ConfigStoreAPITokenProvider{Store: store}, Fallback: fallback}
+
+			_, err := provider.GetToken(ctx)
+			Expect(err).To(MatchError(api.ErrNoToken))
+		})
+	})
+})
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DefaultSnykEndpoint is the API URL of the default, multi-tenant US Snyk instance
+const DefaultSnykEndpoint = "https://api.snyk.io"
+
+// Sources of the Snyk endpoint, in order of precedence
+const (
+	EndpointSourceEnv     = "SNYK_API"
+	EndpointSourceConfig  = "api_url"
+	EndpointSourceCLI     = "snyk config endpoint"
+	EndpointSourceDefault = "default"
+)
+
+// Endpoint represents the base URLs of a Snyk instance
+type Endpoint struct {
+	// API is the canonical API URL of the instance, such as https://api.eu.snyk.io
+	API string
+	// RestBaseURL is the base URL of the REST API
+	RestBaseURL string
+	// OAuthBaseURL is the base URL of the OAuth2 endpoints
+	OAuthBaseURL string
+	// AuthorizeURL is the OAuth2 authorization endpoint users log in at
+	AuthorizeURL string
+	// Source describes where the endpoint was configured
+	Source string
+}
+
+// NewEndpoint derives the REST and OAuth base URLs of a Snyk instance from an
+// API URL in any of the forms accepted by the Snyk CLI, such as
+// https://api.eu.snyk.io, https://app.eu.snyk.io/api or https://snyk.example.com/api/v1.
+// An empty URL selects the default instance.
+func NewEndpoint(apiURL string) (*Endpoint, error) {
+	if apiURL == "" {
+		apiURL = DefaultSnykEndpoint
+	}
+
+	u, err := url.Parse(strings.TrimSpace(apiURL))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Snyk API URL: %s", apiURL)
+	}
+
+	// Drop the suffixes the CLI accepts, such as /api/v1 or /rest
+	p := strings.TrimRight(u.Path, "/")
+	for _, suffix := range []string{"/v1", "/rest", "/api"} {
+		p = strings.TrimSuffix(p, suffix)
+	}
+
+	// Like the Snyk CLI, serve the API from the api. host of the instance, as
+	// the web UI at app.<region>/api and the legacy snyk.io/api URLs point to
+	// it. Local instances such as the simulator have no such hosts.
+	host := strings.ToLower(u.Host)
+	if !isLocalHost(u.Hostname()) {
+		host = "api." + strings.TrimPrefix(strings.TrimPrefix(host, "api."), "app.")
+	}
+
+	base := u.Scheme + "://" + host + p
+
+	// Users log in through the web UI, served from app.<region> alongside api.<region>
+	authorizeURL := base + "/oauth2/authorize"
+	if app, ok := strings.CutPrefix(host, "api."); ok {
+		authorizeURL = u.Scheme + "://app." + app + p + "/oauth2/authorize"
+	}
+
+	return &Endpoint{
+		API:          base,
+		RestBaseURL:  base + "/rest",
+		OAuthBaseURL: base + "/oauth2",
+		AuthorizeURL: authorizeURL,
+	}, nil
+}
+
+// isLocalHost reports whether a host name is the local machine
+func isLocalHost(hostname string) bool {
+	if strings.EqualFold(hostname, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ResolveEndpoint determines the Snyk instance to use from, in order of
+// precedence, the SNYK_API environment variable, the given api_url setting,
+// the endpoint configured in the Snyk CLI, and the default instance.
+// cliEndpoint is only called when neither of the first two is set.
+func ResolveEndpoint(ctx context.Context, apiURL string, cliEndpoint func(context.Context) (string, error)) (*Endpoint, error) {
+	source := EndpointSourceDefault
+	switch {
+	case os.Getenv("SNYK_API") != "":
+		apiURL, source = os.Getenv("SNYK_API"), EndpointSourceEnv
+	case apiURL != "":
+		source = EndpointSourceConfig
+	case cliEndpoint != nil:
+		// Fall back to the default if the CLI isn't installed or configured
+		if endpoint, err := cliEndpoint(ctx); err == nil && endpoint != "" {
+			apiURL, source = endpoint, EndpointSourceCLI
+		}
+	}
+
+	endpoint, err := NewEndpoint(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve Snyk endpoint from %s: %w", source, err)
+	}
+	endpoint.Source = source
+
+	return endpoint, nil
+}
+
+// GetCLIEndpoint returns the endpoint configured in the Snyk CLI with
+// `snyk config set endpoint=...`, or "" if there is none
+func GetCLIEndpoint(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "snyk", "config", "get", "endpoint")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to execute snyk config command: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,110 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("Endpoint", func() {
+	Describe("NewEndpoint", func() {
+		DescribeTable("derives the REST and OAuth base URLs",
+			func(apiURL string, expected string) {
+				endpoint, err := api.NewEndpoint(apiURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(endpoint.API).To(Equal(expected))
+				Expect(endpoint.RestBaseURL).To(Equal(expected + "/rest"))
+				Expect(endpoint.OAuthBaseURL).To(Equal(expected + "/oauth2"))
+			},
+			Entry("default", "", "https://api.snyk.io"),
+			Entry("EU API URL", "https://api.eu.snyk.io", "https://api.eu.snyk.io"),
+			Entry("AU API URL with trailing slash", "https://api.au.snyk.io/", "https://api.au.snyk.io"),
+			Entry("EU app URL", "https://app.eu.snyk.io/api", "https://api.eu.snyk.io"),
+			Entry("legacy v1 URL", "https://snyk.io/api/v1", "https://api.snyk.io"),
+			Entry("REST URL", "https://api.eu.snyk.io/rest", "https://api.eu.snyk.io"),
+			Entry("single-tenant app URL", "https://app.acme.snyk.io/api/v1", "https://api.acme.snyk.io"),
+			Entry("private instance", "https://snyk.example.com/api", "https://api.snyk.example.com"),
+			Entry("private instance app URL", "https://app.snyk.example.com/api/v1", "https://api.snyk.example.com"),
+			Entry("local instance", "http://127.0.0.1:8080", "http://127.0.0.1:8080"),
+			Entry("local instance API URL", "http://localhost:8080/api/", "http://localhost:8080"),
+		)
+
+		It("sends users to the web UI to log in", func() {
+			endpoint, err := api.NewEndpoint("https://api.eu.snyk.io")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoint.AuthorizeURL).To(Equal("https://app.eu.snyk.io/oauth2/authorize"))
+
+			endpoint, err = api.NewEndpoint("https://snyk.example.com/api")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoint.AuthorizeURL).To(Equal("https://app.snyk.example.com/oauth2/authorize"))
+
+			endpoint, err = api.NewEndpoint("http://127.0.0.1:8080")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoint.AuthorizeURL).To(Equal("http://127.0.0.1:8080/oauth2/authorize"))
+		})
+
+		It("rejects URLs without a scheme and host", func() {
+			_, err := api.NewEndpoint("api.eu.snyk.io")
+			Expect(err).To(MatchError(ContainSubstring("invalid Snyk API URL")))
+		})
+	})
+
+	Describe("ResolveEndpoint", func() {
+		var (
+			ctx         = context.Background()
+			cliCalls    int
+			cliEndpoint func(context.Context) (string, error)
+		)
+
+		BeforeEach(func() {
+			cliCalls = 0
+			cliEndpoint = func(context.Context) (string, error) {
+				cliCalls++
+				return "https://api.au.snyk.io", nil
+			}
+			GinkgoT().Setenv("SNYK_API", "")
+		})
+
+		It("prefers the SNYK_API environment variable", func() {
+			GinkgoT().Setenv("SNYK_API", "https://app.eu.snyk.io/api")
+
+			endpoint, err := api.ResolveEndpoint(ctx, "https://snyk.example.com/api", cliEndpoint)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoint.API).To(Equal("https://api.eu.snyk.io"))
+			Expect(endpoint.Source).To(Equal(api.EndpointSourceEnv))
+			Expect(cliCalls).To(BeZero())
+		})
+
+		It("uses the api_url setting before the Snyk CLI configuration", func() {
+			endpoint, err := api.ResolveEndpoint(ctx, "https://snyk.example.com/api", cliEndpoint)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoint.API).To(Equal("https://api.snyk.example.com"))
+			Expect(endpoint.Source).To(Equal(api.EndpointSourceConfig))
+			Expect(cliCalls).To(BeZero())
+		})
+
+		It("uses the endpoint configured in the Snyk CLI", func() {
+			endpoint, err := api.ResolveEndpoint(ctx, "", cliEndpoint)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoint.API).To(Equal("https://api.au.snyk.io"))
+			Expect(endpoint.Source).To(Equal(api.EndpointSourceCLI))
+		})
+
+		It("falls back to the default instance when the Snyk CLI can't be asked", func() {
+			endpoint, err := api.ResolveEndpoint(ctx, "", func(context.Context) (string, error) {
+				return "", errors.New("snyk: command not found")
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoint.API).To(Equal(api.DefaultSnykEndpoint))
+			Expect(endpoint.Source).To(Equal(api.EndpointSourceDefault))
+		})
+
+		It("reports where an invalid endpoint came from", func() {
+			_, err := api.ResolveEndpoint(ctx, "not a url", cliEndpoint)
+			Expect(err).To(MatchError(ContainSubstring("from api_url")))
+		})
+	})
+})
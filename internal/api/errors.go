@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrorObject is an entry of the errors array of a JSON:API error document
+type ErrorObject struct {
+	ID     string      `json:"id"`
+	Status string      `json:"status"`
+	Code   string      `json:"code"`
+	Title  string      `json:"title"`
+	Detail string      `json:"detail"`
+	Source ErrorSource `json:"source"`
+}
+
+// ErrorSource points to the part of the request an error object is about
+type ErrorSource struct {
+	Pointer   string `json:"pointer"`
+	Parameter string `json:"parameter"`
+}
+
+// APIError is returned when the Snyk API answers a request with an unexpected
+// status code
+type APIError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// RequestID identifies the request in Snyk's logs, if the response had one
+	RequestID string
+	// Method is the HTTP method of the request
+	Method string
+	// Endpoint is the URL of the request
+	Endpoint string
+	// Errors are the entries of the JSON:API error document, if any
+	Errors []ErrorObject
+	// Body is the response body, kept for errors that aren't JSON:API documents
+	Body string
+}
+
+// newAPIError creates an APIError from an unexpected response, reading its body
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("snyk-request-id"),
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-Id")
+	}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.Endpoint = resp.Request.URL.String()
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	apiErr.Body = string(body)
+	apiErr.Errors = parseErrorDocument(body)
+
+	return apiErr
+}
+
+// parseErrorDocument returns the errors of a JSON:API error document, or of
+// an OAuth2 error response, or nil if body is neither
+func parseErrorDocument(body []byte) []ErrorObject {
+	var document struct {
+		Errors           []ErrorObject `json:"errors"`
+		Error            string        `json:"error"`
+		ErrorDescription string        `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil
+	}
+
+	if len(document.Errors) > 0 {
+		return document.Errors
+	}
+	if document.Error != "" {
+		return []ErrorObject{{Code: document.Error, Detail: document.ErrorDescription}}
+	}
+	return nil
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "unexpected status code: %d", e.StatusCode)
+	if e.Method != "" {
+		fmt.Fprintf(&b, " from %s %s", e.Method, e.path())
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request ID %s)", e.RequestID)
+	}
+
+	for _, obj := range e.Errors {
+		b.WriteString(": ")
+		switch {
+		case obj.Title != "" && obj.Detail != "":
+			fmt.Fprintf(&b, "%s: %s", obj.Title, obj.Detail)
+		case obj.Title != "":
+			b.WriteString(obj.Title)
+		case obj.Detail != "":
+			b.WriteString(obj.Detail)
+		default:
+			b.WriteString(obj.Code)
+		}
+	}
+
+	return b.String()
+}
+
+// path returns the path of the request, leaving out the query and host
+func (e *APIError) path() string {
+	u, err := url.Parse(e.Endpoint)
+	if err != nil {
+		return e.Endpoint
+	}
+	return u.Path
+}
+
+// OrgID returns the ID of the organization the request was about, or "" if it
+// wasn't about a single organization
+func (e *APIError) OrgID() string {
+	segments := strings.Split(strings.Trim(e.path(), "/"), "/")
+	for i := 0; i < len(segments)-1; i++ {
+		if segments[i] == "orgs" {
+			return segments[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("APIError", func() {
+	var (
+		ctx    = context.Background()
+		server *httptest.Server
+		client *api.SnykClient
+	)
+
+	serve := func(status int, body string) {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("snyk-request-id", "request-id-1")
+			w.Header().Set("Content-Type", "application/vnd.api+json")
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+		client = &api.SnykClient{APIToken: "token", RestBaseURL: server.URL, HTTPClient: http.DefaultClient, PageLimit: 10}
+	}
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("parses JSON:API error documents", func() {
+		serve(http.StatusForbidden, `{"jsonapi": {"version": "1.0"}, "errors": [{"status": "403", "code": "SNYK-0003", "title": "Forbidden", "detail": "You don't have access to this org"}]}`)
+
+		_, err := client.GetTargets(ctx, "org-id-1")
+		var apiErr *api.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(http.StatusForbidden))
+		Expect(apiErr.RequestID).To(Equal("request-id-1"))
+		Expect(apiErr.Method).To(Equal("GET"))
+		Expect(apiErr.OrgID()).To(Equal("org-id-1"))
+		Expect(apiErr.Errors).To(Equal([]api.ErrorObject{{
+			Status: "403",
+			Code:   "SNYK-0003",
+			Title:  "Forbidden",
+			Detail: "You don't have access to this org",
+		}}))
+
+		Expect(err.Error()).To(Equal("unexpected status code: 403 from GET /orgs/org-id-1/targets (request ID request-id-1): Forbidden: You don't have access to this org"))
+	})
+
+	It("keeps bodies that aren't error documents out of the message", func() {
+		serve(http.StatusUnauthorized, `<html>Unauthorized</html>`)
+
+		_, err := client.GetOrganizations(ctx)
+		var apiErr *api.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.Errors).To(BeEmpty())
+		Expect(apiErr.Body).To(Equal(`<html>Unauthorized</html>`))
+		Expect(apiErr.OrgID()).To(BeEmpty())
+		Expect(err.Error()).NotTo(ContainSubstring("html"))
+	})
+})
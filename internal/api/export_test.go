@@ -0,0 +1,6 @@
+package api
+
+// Export unexported functions for testing
+var KeyringLookupCommand = keyringLookupCommand
+var KeyringStoreCommand = keyringStoreCommand
+var IsKeyringNotFound = isKeyringNotFound
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// harCreator names snyk-auto-org as the creator of HAR files
+const harCreator = "snyk-auto-org"
+
+// HARRecorder collects the requests sent through its transports and their
+// responses, and writes them to a HAR file with their secrets redacted
+type HARRecorder struct {
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+// NewHARRecorder creates a HARRecorder without any entries
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{}
+}
+
+// Transport returns an http.RoundTripper recording the requests sent through
+// base, http.DefaultTransport if nil
+func (r *HARRecorder) Transport(base http.RoundTripper) http.RoundTripper {
+	return &harTransport{base: base, recorder: r}
+}
+
+// WriteFile writes the recorded entries to a HAR file readable only by the user
+func (r *HARRecorder) WriteFile(path string) error {
+	r.mu.Lock()
+	entries := append([]harEntry{}, r.entries...)
+	r.mu.Unlock()
+
+	// Requests of concurrent scans finish in any order
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+
+	data, err := json.MarshalIndent(harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harNameVersion{Name: harCreator, Version: "1.0"},
+		Entries: entries,
+	}}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal HAR file: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write HAR file: %w", err)
+	}
+	return nil
+}
+
+// add records an entry
+func (r *HARRecorder) add(entry harEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// harTransport is the http.RoundTripper of a HARRecorder
+type harTransport struct {
+	base     http.RoundTripper
+	recorder *HARRecorder
+}
+
+// RoundTrip sends the request and records it with its response or error
+func (t *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	req, reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	resp, err := base.RoundTrip(req)
+	elapsed := time.Since(started)
+
+	entry := harEntry{
+		StartedDateTime: started,
+		Time:            float64(elapsed.Microseconds()) / 1000,
+		Request:         newHARRequest(req, reqBody),
+		Cache:           struct{}{},
+		Timings:         harTimings{Send: 0, Wait: float64(elapsed.Microseconds()) / 1000, Receive: 0},
+	}
+
+	if err != nil {
+		entry.Response = harResponse{Headers: []harNameValue{}, Cookies: []harNameValue{}, HeadersSize: -1, BodySize: -1}
+		entry.Error = err.Error()
+		t.recorder.add(entry)
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	entry.Response = newHARResponse(resp, respBody)
+	t.recorder.add(entry)
+
+	return resp, nil
+}
+
+// readRequestBody reads the body of a request, returning it with a copy of
+// the request whose body can still be sent
+func readRequestBody(req *http.Request) (*http.Request, []byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return req, body, nil
+}
+
+// newHARRequest describes a request with its secrets redacted
+func newHARRequest(req *http.Request, body []byte) harRequest {
+	rawURL := redactURL(req.URL.String())
+	harReq := harRequest{
+		Method:      req.Method,
+		URL:         rawURL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(redactHeader(req.Header)),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+
+	if u, err := url.Parse(rawURL); err == nil {
+		harReq.QueryString = harValues(u.Query())
+	}
+
+	if body != nil {
+		contentType := req.Header.Get("Content-Type")
+		harReq.PostData = &harPostData{MimeType: contentType, Text: string(redactBody(contentType, body))}
+	}
+
+	return harReq
+}
+
+// newHARResponse describes a response with its secrets redacted
+func newHARResponse(resp *http.Response, body []byte) harResponse {
+	contentType := resp.Header.Get("Content-Type")
+	return harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(redactHeader(resp.Header)),
+		Content: harContent{
+			Size:     int64(len(body)),
+			MimeType: contentType,
+			Text:     string(redactBody(contentType, body)),
+		},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+}
+
+// harHeaders lists headers sorted by name
+func harHeaders(header http.Header) []harNameValue {
+	return harValues(url.Values(header))
+}
+
+// harValues lists the values of a multimap sorted by name
+func harValues(values map[string][]string) []harNameValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []harNameValue{}
+	for _, name := range names {
+		for _, value := range values[name] {
+			list = append(list, harNameValue{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+// The HAR 1.2 format, see http://www.softwareishard.com/blog/har-12-spec/
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string         `json:"version"`
+	Creator harNameVersion `json:"creator"`
+	Entries []harEntry     `json:"entries"`
+}
+
+type harNameVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	// Error is why no response was received, a custom field
+	Error string `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
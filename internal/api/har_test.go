@@ -0,0 +1,116 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("HARRecorder", func() {
+	var (
+		ctx      = context.Background()
+		server   *httptest.Server
+		recorder *api.HARRecorder
+		path     string
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/oauth2/token":
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"access_token": "new-access-token", "refresh_token": "new-refresh-token", "expires_in": 3600, "token_type": "bearer"}`))
+			default:
+				w.Header().Set("Content-Type", "application/vnd.api+json")
+				w.Header().Set("snyk-request-id", "request-1")
+				w.Write([]byte(`{"data": [{"id": "org-id-1", "attributes": {"name": "Organization 1"}}]}`))
+			}
+		}))
+
+		recorder = api.NewHARRecorder()
+		path = filepath.Join(GinkgoT().TempDir(), "trace.har")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	// readHAR reads the HAR file back as generic JSON
+	readHAR := func() map[string]interface{} {
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("secret-api-token"))
+		Expect(string(data)).NotTo(ContainSubstring("old-refresh-token"))
+		Expect(string(data)).NotTo(ContainSubstring("new-access-token"))
+		Expect(string(data)).NotTo(ContainSubstring("new-refresh-token"))
+
+		var har map[string]interface{}
+		Expect(json.Unmarshal(data, &har)).To(Succeed())
+		return har["log"].(map[string]interface{})
+	}
+
+	It("records the requests of the Snyk client and the token refresher with their secrets redacted", func() {
+		httpClient := &http.Client{Transport: recorder.Transport(nil)}
+		client := &api.SnykClient{
+			APIToken:    "secret-api-token",
+			RestBaseURL: server.URL,
+			HTTPClient:  httpClient,
+			PageLimit:   10,
+		}
+		orgs, err := client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orgs).To(HaveLen(1))
+
+		refresher := api.NewOAuth2TokenRefresher(server.URL+"/oauth2", httpClient)
+		token, err := refresher.RefreshToken(ctx, "old-refresh-token")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("new-access-token"))
+
+		Expect(recorder.WriteFile(path)).To(Succeed())
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		log := readHAR()
+		Expect(log["version"]).To(Equal("1.2"))
+		entries := log["entries"].([]interface{})
+		Expect(entries).To(HaveLen(2))
+
+		orgsEntry := entries[0].(map[string]interface{})
+		request := orgsEntry["request"].(map[string]interface{})
+		Expect(request["method"]).To(Equal("GET"))
+		Expect(request["url"]).To(ContainSubstring("/orgs?"))
+		Expect(request["headers"]).To(ContainElement(map[string]interface{}{"name": "Authorization", "value": api.Redacted}))
+		response := orgsEntry["response"].(map[string]interface{})
+		Expect(response["status"]).To(BeNumerically("==", 200))
+		Expect(response["headers"]).To(ContainElement(map[string]interface{}{"name": "Snyk-Request-Id", "value": "request-1"}))
+		Expect(response["content"].(map[string]interface{})["text"]).To(ContainSubstring("Organization 1"))
+
+		refreshEntry := entries[1].(map[string]interface{})
+		postData := refreshEntry["request"].(map[string]interface{})["postData"].(map[string]interface{})
+		Expect(postData["text"]).To(Equal("grant_type=refresh_token&refresh_token=" + api.Redacted))
+		content := refreshEntry["response"].(map[string]interface{})["content"].(map[string]interface{})
+		Expect(content["text"]).To(ContainSubstring(`"token_type":"bearer"`))
+		Expect(content["text"]).To(ContainSubstring(`"access_token":"` + api.Redacted + `"`))
+	})
+
+	It("records requests failing without a response", func() {
+		server.Close()
+
+		client := &http.Client{Transport: recorder.Transport(nil)}
+		_, err := client.Get(server.URL + "/orgs")
+		Expect(err).To(HaveOccurred())
+
+		Expect(recorder.WriteFile(path)).To(Succeed())
+		entries := readHAR()["entries"].([]interface{})
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].(map[string]interface{})["_error"]).NotTo(BeEmpty())
+	})
+})
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// DefaultKeyringService is the keyring service secrets are stored under
+const DefaultKeyringService = "snyk-auto-org"
+
+// KeyringSecretBackend implements SecretBackend with the OS keyring: the login
+// keychain on macOS, through the security tool, and the freedesktop Secret
+// Service elsewhere, through secret-tool from libsecret. Secrets are passed to
+// the tools on stdin so they never show up in process listings.
+type KeyringSecretBackend struct {
+	// Service is the keyring service secrets are stored under
+	Service string
+}
+
+// NewKeyringSecretBackend creates a KeyringSecretBackend for the default service
+func NewKeyringSecretBackend() *KeyringSecretBackend {
+	return &KeyringSecretBackend{Service: DefaultKeyringService}
+}
+
+func (b *KeyringSecretBackend) GetSecret(ctx context.Context, name string) ([]byte, error) {
+	args := keyringLookupCommand(runtime.GOOS, b.Service, name)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && isKeyringNotFound(runtime.GOOS, exitErr.ExitCode(), output, stderr.Bytes()) {
+		return nil, ErrSecretNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s from keyring: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret %s from keyring: %w", name, err)
+	}
+
+	return secret, nil
+}
+
+func (b *KeyringSecretBackend) SetSecret(ctx context.Context, name string, secret []byte) error {
+	args, stdin := keyringStoreCommand(runtime.GOOS, b.Service, name, base64.StdEncoding.EncodeToString(secret))
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to store secret %s in keyring: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// keyringLookupCommand returns the command printing a secret from the keyring
+// of goos
+func keyringLookupCommand(goos string, service string, name string) []string {
+	if goos == "darwin" {
+		return []string{"security", "find-generic-password", "-s", service, "-a", name, "-w"}
+	}
+	return []string{"secret-tool", "lookup", "service", service, "account", name}
+}
+
+// keyringStoreCommand returns the command storing an encoded secret in the
+// keyring of goos, and what to write to its stdin
+func keyringStoreCommand(goos string, service string, name string, encoded string) ([]string, string) {
+	if goos == "darwin" {
+		// Read the command from stdin in interactive mode rather than passing
+		// the secret as an argument
+		return []string{"security", "-i"}, fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+			securityQuote(service), securityQuote(name), securityQuote(encoded))
+	}
+	return []string{"secret-tool", "store", "--label=" + service + " " + name, "service", service, "account", name}, encoded
+}
+
+// securityQuote quotes an argument of a command read by security -i, which
+// splits its input at spaces outside double quotes
+func securityQuote(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// isKeyringNotFound reports whether a failed keyring lookup on goos means the
+// secret doesn't exist. security exits with errSecItemNotFound (44), and
+// secret-tool exits with 1 without printing anything.
+func isKeyringNotFound(goos string, exitCode int, stdout []byte, stderr []byte) bool {
+	if goos == "darwin" {
+		return exitCode == 44
+	}
+	return exitCode == 1 && len(bytes.TrimSpace(stdout)) == 0 && len(bytes.TrimSpace(stderr)) == 0
+}
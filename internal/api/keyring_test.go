@@ -0,0 +1,47 @@
+package api_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("KeyringSecretBackend", func() {
+	DescribeTable("looks up secrets with the keyring tool of the OS",
+		func(goos string, expected []string) {
+			Expect(api.KeyringLookupCommand(goos, "snyk auto org", "token-key")).To(Equal(expected))
+		},
+		Entry("macOS", "darwin", []string{"security", "find-generic-password", "-s", "snyk auto org", "-a", "token-key", "-w"}),
+		Entry("Linux", "linux", []string{"secret-tool", "lookup", "service", "snyk auto org", "account", "token-key"}),
+	)
+
+	DescribeTable("stores secrets with the keyring tool of the OS, passing them on stdin",
+		func(goos string, service string, expected []string, stdin string) {
+			args, input := api.KeyringStoreCommand(goos, service, "token-key", "c2VjcmV0")
+			Expect(args).To(Equal(expected))
+			Expect(input).To(Equal(stdin))
+		},
+		Entry("macOS", "darwin", api.DefaultKeyringService,
+			[]string{"security", "-i"},
+			"add-generic-password -U -s \"snyk-auto-org\" -a \"token-key\" -w \"c2VjcmV0\"\n"),
+		Entry("macOS with a service containing spaces and quotes", "darwin", `snyk "auto" org`,
+			[]string{"security", "-i"},
+			"add-generic-password -U -s \"snyk \\\"auto\\\" org\" -a \"token-key\" -w \"c2VjcmV0\"\n"),
+		Entry("Linux", "linux", "snyk auto org",
+			[]string{"secret-tool", "store", "--label=snyk auto org token-key", "service", "snyk auto org", "account", "token-key"},
+			"c2VjcmV0"),
+	)
+
+	DescribeTable("tells missing secrets from failures",
+		func(goos string, exitCode int, stdout string, stderr string, notFound bool) {
+			Expect(api.IsKeyringNotFound(goos, exitCode, []byte(stdout), []byte(stderr))).To(Equal(notFound))
+		},
+		Entry("macOS item not found", "darwin", 44, "", "security: SecKeychainSearchCopyNext: The specified item could not be found in the keychain.", true),
+		Entry("macOS locked keychain", "darwin", 36, "", "security: User interaction is not allowed.", false),
+		Entry("macOS other failure", "darwin", 1, "", "", false),
+		Entry("Linux secret not found", "linux", 1, "", "", true),
+		Entry("Linux no Secret Service", "linux", 1, "", "secret-tool: Cannot autolaunch D-Bus without X11 $DISPLAY", false),
+		Entry("Linux other exit code", "linux", 2, "", "", false),
+		Entry("Linux output on failure", "linux", 1, "partial", "", false),
+	)
+})
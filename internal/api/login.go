@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SnykCLIClientID is the OAuth client of the Snyk CLI, which users log in as
+// so that the Snyk CLI can keep using and refreshing the token
+const SnykCLIClientID = "b56d4c2e-b9e1-4d27-8773-ad47eafb0956"
+
+// OAuthCallbackPath is the path of the redirect URI of the Snyk CLI's OAuth client
+const OAuthCallbackPath = "/authorization-code/callback"
+
+// OAuthCallbackPorts are the loopback ports the Snyk CLI's OAuth client may
+// be redirected to, tried in order
+var OAuthCallbackPorts = []int{8080, 18081, 28082, 38083, 48084}
+
+// AuthorizationCodeFlow logs a user in with the OAuth2 authorization code
+// grant with PKCE (RFC 7636). The user approves the access in a browser, which
+// the authorization server then redirects to a listener on the loopback
+// interface with the code to exchange for a token.
+type AuthorizationCodeFlow struct {
+	// AuthorizeURL is the authorization endpoint, such as Endpoint.AuthorizeURL
+	AuthorizeURL string
+	// ClientID is the OAuth client to log in as, SnykCLIClientID if empty
+	ClientID string
+	// Refresher exchanges the authorization code for a token
+	Refresher *OAuth2TokenRefresher
+	// Ports are the loopback ports tried for the redirect listener,
+	// OAuthCallbackPorts if empty. Port 0 picks any free port.
+	Ports []int
+	// OpenBrowser sends the user to the authorization URL
+	OpenBrowser func(ctx context.Context, authURL string) error
+}
+
+// callbackResult is the outcome of the redirect to the listener
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// Login runs the flow until the user approved or denied the access, or ctx is
+// done, and returns the token issued for it
+func (f *AuthorizationCodeFlow) Login(ctx context.Context) (*TokenStorage, error) {
+	clientID := f.ClientID
+	if clientID == "" {
+		clientID = SnykCLIClientID
+	}
+
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := f.listen()
+	if err != nil {
+		return nil, err
+	}
+	redirectURI := "http://" + listener.Addr().String() + OAuthCallbackPath
+
+	results := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+OAuthCallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		result := parseCallback(r.URL.Query(), state)
+		if result.err != nil {
+			http.Error(w, "Login to Snyk failed: "+result.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Logged in to Snyk, you can close this window.")
+		}
+
+		// Only the first redirect counts
+		select {
+		case results <- result:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", clientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("state", state)
+	params.Set("code_challenge", codeChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+	params.Set("scope", "offline_access")
+	params.Set("version", "2021-08-11~experimental")
+
+	if err := f.OpenBrowser(ctx, f.AuthorizeURL+"?"+params.Encode()); err != nil {
+		return nil, err
+	}
+
+	var result callbackResult
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result = <-results:
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	tokenResp, err := f.Refresher.ExchangeCode(ctx, result.code, verifier, redirectURI, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("no access token in the token response")
+	}
+
+	return NewTokenStorage(tokenResp), nil
+}
+
+// listen listens on the first free port of the flow on the loopback interface
+func (f *AuthorizationCodeFlow) listen() (net.Listener, error) {
+	ports := f.Ports
+	if len(ports) == 0 {
+		ports = OAuthCallbackPorts
+	}
+
+	var errs []error
+	for _, port := range ports {
+		listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err == nil {
+			return listener, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("failed to listen for the login redirect: %w", errors.Join(errs...))
+}
+
+// parseCallback returns the authorization code of the redirect to the
+// listener, or why the authorization failed
+func parseCallback(query url.Values, state string) callbackResult {
+	if query.Get("state") != state {
+		return callbackResult{err: fmt.Errorf("the login redirect doesn't match the login request")}
+	}
+	if code := query.Get("error"); code != "" {
+		if description := query.Get("error_description"); description != "" {
+			return callbackResult{err: fmt.Errorf("authorization failed: %s: %s", code, description)}
+		}
+		return callbackResult{err: fmt.Errorf("authorization failed: %s", code)}
+	}
+	if query.Get("code") == "" {
+		return callbackResult{err: fmt.Errorf("no authorization code in the login redirect")}
+	}
+	return callbackResult{code: query.Get("code")}
+}
+
+// randomString returns n random bytes encoded in unpadded base64url
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallenge returns the S256 code challenge of a PKCE code verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,125 @@
+package api_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("AuthorizationCodeFlow", func() {
+	var (
+		ctx       = context.Background()
+		server    *httptest.Server
+		flow      *api.AuthorizationCodeFlow
+		challenge string
+		redirect  func(query url.Values)
+	)
+
+	// follow stands in for the user's browser, approving the access
+	follow := func(ctx context.Context, authURL string) error {
+		resp, err := http.Get(authURL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	BeforeEach(func() {
+		redirect = func(query url.Values) {
+			query.Set("code", "test-code")
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /oauth2/authorize", func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			Expect(query.Get("response_type")).To(Equal("code"))
+			Expect(query.Get("client_id")).To(Equal(api.SnykCLIClientID))
+			Expect(query.Get("code_challenge_method")).To(Equal("S256"))
+			challenge = query.Get("code_challenge")
+
+			redirectURI, err := url.Parse(query.Get("redirect_uri"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(redirectURI.Hostname()).To(Equal("127.0.0.1"))
+			Expect(redirectURI.Path).To(Equal(api.OAuthCallbackPath))
+
+			params := url.Values{"state": {query.Get("state")}}
+			redirect(params)
+			redirectURI.RawQuery = params.Encode()
+			http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+		})
+		mux.HandleFunc("POST /oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			Expect(r.PostForm.Get("grant_type")).To(Equal("authorization_code"))
+			Expect(r.PostForm.Get("code")).To(Equal("test-code"))
+			Expect(r.PostForm.Get("client_id")).To(Equal(api.SnykCLIClientID))
+
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			Expect(base64.RawURLEncoding.EncodeToString(sum[:])).To(Equal(challenge))
+
+			json.NewEncoder(w).Encode(api.TokenResponse{
+				AccessToken:  "new-access-token",
+				TokenType:    "bearer",
+				RefreshToken: "new-refresh-token",
+				ExpiresIn:    3600,
+			})
+		})
+		server = httptest.NewServer(mux)
+		DeferCleanup(server.Close)
+
+		flow = &api.AuthorizationCodeFlow{
+			AuthorizeURL: server.URL + "/oauth2/authorize",
+			Refresher:    api.NewOAuth2TokenRefresher(server.URL+"/oauth2", nil),
+			Ports:        []int{0},
+			OpenBrowser:  follow,
+		}
+	})
+
+	It("exchanges the authorization code for a token with the code verifier", func() {
+		token, err := flow.Login(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("new-access-token"))
+		Expect(token.RefreshToken).To(Equal("new-refresh-token"))
+		Expect(token.AuthScheme()).To(Equal(api.AuthSchemeBearer))
+		Expect(token.Expiry).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+	})
+
+	It("fails when the user denies the access", func() {
+		redirect = func(query url.Values) {
+			query.Set("error", "access_denied")
+			query.Set("error_description", "The user denied the request")
+		}
+
+		_, err := flow.Login(ctx)
+		Expect(err).To(MatchError("authorization failed: access_denied: The user denied the request"))
+	})
+
+	It("rejects redirects of another login request", func() {
+		redirect = func(query url.Values) {
+			query.Set("state", "another-state")
+			query.Set("code", "test-code")
+		}
+
+		_, err := flow.Login(ctx)
+		Expect(err).To(MatchError(ContainSubstring("doesn't match the login request")))
+	})
+
+	It("stops waiting for the redirect when cancelled", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		flow.OpenBrowser = func(context.Context, string) error {
+			cancel()
+			return nil
+		}
+
+		_, err := flow.Login(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Links represents the pagination links of a JSON:API collection response
+type Links struct {
+	Next string `json:"next"`
+	Prev string `json:"prev"`
+}
+
+// Page represents a single page of a JSON:API collection response
+type Page[T any] struct {
+	Data  []T   `json:"data"`
+	Links Links `json:"links"`
+}
+
+// PageFunc is called with the items of each page retrieved by Paginate.
+// Returning false stops the pagination before the next page is requested.
+type PageFunc[T any] func(items []T) (bool, error)
+
+// Paginate retrieves the pages of a JSON:API collection starting at initialURL,
+// following links.next until there are no more pages or fn asks to stop
+func Paginate[T any](ctx context.Context, c *SnykClient, initialURL string, fn PageFunc[T]) error {
+	_, err := paginate(ctx, c, initialURL, fn)
+	return err
+}
+
+// paginate is Paginate, also reporting whether every page retrieved was
+// unchanged since it was last retrieved through a CachingTransport
+func paginate[T any](ctx context.Context, c *SnykClient, initialURL string, fn PageFunc[T]) (bool, error) {
+	nextURL := initialURL
+	unchanged := true
+
+	for nextURL != "" {
+		var page Page[T]
+		revalidated, err := c.getJSONWithFallback(ctx, nextURL, &page)
+		if err != nil {
+			return false, err
+		}
+		unchanged = unchanged && revalidated
+
+		more, err := fn(page.Data)
+		if err != nil {
+			return false, err
+		}
+		if !more {
+			return unchanged, nil
+		}
+
+		nextURL, err = c.resolveNextURL(page.Links.Next)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return unchanged, nil
+}
+
+// getJSON performs a GET request against the Snyk REST API and decodes the
+// JSON response body into v, reporting whether the response was unchanged
+// since it was last retrieved through a CachingTransport
+func (c *SnykClient) getJSON(ctx context.Context, reqURL string, v interface{}) (bool, error) {
+	// Log the request
+	c.logRequest("GET", reqURL)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+	token, scheme := c.credentials()
+	req.Header.Set("Authorization", fmt.Sprintf("%s %s", scheme, token))
+
+	resp, err := c.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, newAPIError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	revalidated := IsRevalidated(resp)
+	if revalidated && c.Stats != nil {
+		c.Stats.revalidated.Add(1)
+	}
+	return revalidated, nil
+}
+
+// resolveNextURL turns a links.next value into an absolute URL. Relative
+// links are resolved against the client's REST base URL, and an empty link
+// resolves to an empty string, meaning there are no more pages.
+func (c *SnykClient) resolveNextURL(next string) (string, error) {
+	if next == "" {
+		return "", nil
+	}
+
+	if isAbsoluteURL(next) {
+		return next, nil
+	}
+
+	// Parse the base URL to get its components
+	baseURL, err := url.Parse(c.RestBaseURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse base URL: %w", err)
+	}
+
+	// Parse the relative path
+	relPath, err := url.Parse(next)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse relative path: %w", err)
+	}
+
+	// Resolve the relative path against the base URL
+	return baseURL.ResolveReference(relPath).String(), nil
+}
+
+// isAbsoluteURL checks if the given URL is absolute (starts with http:// or https://)
+func isAbsoluteURL(urlStr string) bool {
+	return len(urlStr) > 8 && (urlStr[:7] == "http://" || urlStr[:8] == "https://")
+}
@@ -0,0 +1,107 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("Paginate", func() {
+	var (
+		ctx           = context.Background()
+		server        *httptest.Server
+		client        *api.SnykClient
+		mux           *http.ServeMux
+		secondPageHit bool
+	)
+
+	BeforeEach(func() {
+		mux = http.NewServeMux()
+		server = httptest.NewServer(mux)
+		secondPageHit = false
+
+		client = &api.SnykClient{
+			APIToken:    "test-token",
+			RestBaseURL: server.URL,
+			HTTPClient:  http.DefaultClient,
+			PageLimit:   api.DefaultPageLimit,
+		}
+
+		mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("starting_after") == "item-2" {
+				secondPageHit = true
+				w.Write([]byte(`{"data": [{"id": "item-3"}]}`))
+				return
+			}
+
+			w.Write([]byte(`{
+				"data": [{"id": "item-1"}, {"id": "item-2"}],
+				"links": {"next": "/items?starting_after=item-2"}
+			}`))
+		})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	type item struct {
+		ID string `json:"id"`
+	}
+
+	It("yields every page in order", func() {
+		var pages [][]item
+		err := api.Paginate(ctx, client, server.URL+"/items", func(items []item) (bool, error) {
+			pages = append(pages, items)
+			return true, nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pages).To(HaveLen(2))
+		Expect(pages[0]).To(Equal([]item{{ID: "item-1"}, {ID: "item-2"}}))
+		Expect(pages[1]).To(Equal([]item{{ID: "item-3"}}))
+	})
+
+	It("stops requesting pages once the callback returns false", func() {
+		var seen []item
+		err := api.Paginate(ctx, client, server.URL+"/items", func(items []item) (bool, error) {
+			seen = append(seen, items...)
+			return false, nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(seen).To(HaveLen(2))
+		Expect(secondPageHit).To(BeFalse())
+	})
+
+	Context("when searching for an organization by target URL", func() {
+		BeforeEach(func() {
+			mux.HandleFunc("/orgs", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"data": [{"id": "org-id-1", "attributes": {"name": "Organization 1", "slug": "org-1"}}]}`))
+			})
+
+			mux.HandleFunc("/orgs/org-id-1/targets", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("starting_after") == "target-id-1" {
+					secondPageHit = true
+					w.Write([]byte(`{"data": [{"id": "target-id-2", "attributes": {"displayName": "test/other", "url": "https://github.com/test/other"}}]}`))
+					return
+				}
+
+				w.Write([]byte(`{
+					"data": [{"id": "target-id-1", "attributes": {"displayName": "test/repo", "url": "https://github.com/test/repo"}}],
+					"links": {"next": "/orgs/org-id-1/targets?starting_after=target-id-1"}
+				}`))
+			})
+		})
+
+		It("stops at the first page containing a match", func() {
+			orgTarget, err := client.FindOrgWithTargetURL(ctx, "https://github.com/test/repo")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgTarget.OrgID).To(Equal("org-id-1"))
+			Expect(orgTarget.TargetName).To(Equal("test/repo"))
+			Expect(secondPageHit).To(BeFalse())
+		})
+	})
+})
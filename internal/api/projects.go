@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ProjectStatusActive is the status of a project that is being monitored
+const ProjectStatusActive = "active"
+
+// Project represents a Snyk project from the REST API
+type Project struct {
+	ID              string `json:"id" db:"id"`
+	OrgID           string `json:"org_id" db:"org_id"`
+	TargetID        string `json:"target_id" db:"target_id"`
+	Name            string `json:"name" db:"name"`
+	Type            string `json:"type" db:"type"`
+	Status          string `json:"status" db:"status"`
+	Origin          string `json:"origin" db:"origin"`
+	TargetFile      string `json:"target_file" db:"target_file"`
+	TargetReference string `json:"target_reference" db:"target_reference"`
+	Attributes      struct {
+		Name            string `json:"name"`
+		Type            string `json:"type"`
+		Status          string `json:"status"`
+		Origin          string `json:"origin"`
+		TargetFile      string `json:"target_file"`
+		TargetReference string `json:"target_reference"`
+	} `json:"attributes" db:"-"`
+	Relationships struct {
+		Target struct {
+			Data struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		} `json:"target"`
+	} `json:"relationships" db:"-"`
+}
+
+// ProjectsResponse represents the response from the Snyk REST API for projects
+type ProjectsResponse = Page[Project]
+
+// IsActive reports whether the project is being monitored
+func (p Project) IsActive() bool {
+	return p.Status == ProjectStatusActive
+}
+
+// CoversFile reports whether the project was created from the given manifest
+// file, a path relative to the root of the repository
+func (p Project) CoversFile(file string) bool {
+	return p.TargetFile != "" && NormalizeManifestPath(p.TargetFile) == NormalizeManifestPath(file)
+}
+
+// NormalizeManifestPath cleans a manifest path so that paths written differently,
+// such as "./services/api/package.json" and "services/api/package.json", compare equal
+func NormalizeManifestPath(file string) string {
+	file = strings.ReplaceAll(file, "\\", "/")
+	return strings.TrimPrefix(path.Clean("/"+file), "/")
+}
+
+// GetProjectsForTarget retrieves the projects of an organization created from a target
+func (c *SnykClient) GetProjectsForTarget(ctx context.Context, orgID string, targetID string) ([]Project, error) {
+	params := url.Values{}
+	params.Add("version", c.restVersion(ResourceProjects))
+	params.Add("limit", fmt.Sprintf("%d", c.PageLimit))
+	params.Add("target_id", targetID)
+
+	reqURL := fmt.Sprintf("%s/orgs/%s/projects?%s", c.RestBaseURL, orgID, params.Encode())
+
+	var allProjects []Project
+	err := Paginate(ctx, c, reqURL, func(projects []Project) (bool, error) {
+		// Map API response to Project objects and append to result
+		for _, project := range projects {
+			projectTargetID := project.Relationships.Target.Data.ID
+			if projectTargetID == "" {
+				projectTargetID = targetID
+			}
+
+			allProjects = append(allProjects, Project{
+				ID:              project.ID,
+				OrgID:           orgID,
+				TargetID:        projectTargetID,
+				Name:            project.Attributes.Name,
+				Type:            project.Attributes.Type,
+				Status:          project.Attributes.Status,
+				Origin:          project.Attributes.Origin,
+				TargetFile:      project.Attributes.TargetFile,
+				TargetReference: project.Attributes.TargetReference,
+			})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return allProjects, nil
+}
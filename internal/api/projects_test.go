@@ -0,0 +1,98 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("Projects", func() {
+	var (
+		ctx    = context.Background()
+		server *httptest.Server
+		client *api.SnykClient
+		mux    *http.ServeMux
+	)
+
+	BeforeEach(func() {
+		mux = http.NewServeMux()
+		server = httptest.NewServer(mux)
+
+		client = &api.SnykClient{
+			APIToken:    "test-token",
+			RestBaseURL: server.URL,
+			HTTPClient:  http.DefaultClient,
+			PageLimit:   api.DefaultPageLimit,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("GetProjectsForTarget", func() {
+		BeforeEach(func() {
+			mux.HandleFunc("/orgs/org-id-1/projects", func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Query().Get("target_id")).To(Equal("target-id-1"))
+				Expect(r.URL.Query().Get("version")).To(Equal(api.SnykAPIRestVersion))
+				w.Write([]byte(`{
+					"data": [
+						{
+							"id": "project-id-1",
+							"attributes": {
+								"name": "test/repo:services/api/package.json",
+								"type": "npm",
+								"status": "active",
+								"origin": "github",
+								"target_file": "services/api/package.json",
+								"target_reference": "main"
+							},
+							"relationships": {"target": {"data": {"id": "target-id-1", "type": "target"}}}
+						},
+						{
+							"id": "project-id-2",
+							"attributes": {"name": "test/repo:go.mod", "type": "gomodules", "status": "inactive", "origin": "github", "target_file": "go.mod"}
+						}
+					]
+				}`))
+			})
+		})
+
+		It("returns the projects of the target", func() {
+			projects, err := client.GetProjectsForTarget(ctx, "org-id-1", "target-id-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(projects).To(HaveLen(2))
+
+			Expect(projects[0].ID).To(Equal("project-id-1"))
+			Expect(projects[0].OrgID).To(Equal("org-id-1"))
+			Expect(projects[0].TargetID).To(Equal("target-id-1"))
+			Expect(projects[0].Name).To(Equal("test/repo:services/api/package.json"))
+			Expect(projects[0].Type).To(Equal("npm"))
+			Expect(projects[0].Status).To(Equal("active"))
+			Expect(projects[0].Origin).To(Equal("github"))
+			Expect(projects[0].TargetFile).To(Equal("services/api/package.json"))
+			Expect(projects[0].TargetReference).To(Equal("main"))
+			Expect(projects[0].IsActive()).To(BeTrue())
+
+			Expect(projects[1].TargetID).To(Equal("target-id-1"))
+			Expect(projects[1].IsActive()).To(BeFalse())
+		})
+	})
+
+	Describe("CoversFile", func() {
+		It("matches manifest paths written differently", func() {
+			project := api.Project{TargetFile: "services/api/package.json"}
+			Expect(project.CoversFile("./services/api/package.json")).To(BeTrue())
+			Expect(project.CoversFile(`services\api\package.json`)).To(BeTrue())
+			Expect(project.CoversFile("package.json")).To(BeFalse())
+		})
+
+		It("doesn't match projects without a manifest file", func() {
+			Expect(api.Project{}.CoversFile("")).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces secrets in recorded Snyk API traffic
+const Redacted = "REDACTED"
+
+// secretHeaders are the headers whose values are always secret
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// secretFields are the JSON object keys whose values are secret, such as those
+// of OAuth2 token responses
+var secretFields = []string{"access_token", "refresh_token", "id_token", "client_secret", "code_verifier", "token"}
+
+// secretFormFields are the form fields and query parameters whose values are
+// secret, such as those of OAuth2 token requests. JSON:API errors have a
+// code, so only the authorization code of forms is secret.
+var secretFormFields = append([]string{"code"}, secretFields...)
+
+// isSecretHeader reports whether the values of a header are secret
+func isSecretHeader(name string) bool {
+	for _, secret := range secretHeaders {
+		if strings.EqualFold(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSecretField reports whether the value of a field in secrets is secret
+func isSecretField(secrets []string, name string) bool {
+	for _, secret := range secrets {
+		if strings.EqualFold(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeader returns a copy of header with the values of secret headers redacted
+func redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for name, values := range redacted {
+		if isSecretHeader(name) {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+	}
+	return redacted
+}
+
+// redactValues returns a copy of values with secret fields redacted
+func redactValues(values url.Values) url.Values {
+	redacted := url.Values{}
+	for name, vs := range values {
+		for _, v := range vs {
+			if isSecretField(secretFormFields, name) {
+				v = Redacted
+			}
+			redacted.Add(name, v)
+		}
+	}
+	return redacted
+}
+
+// redactURL returns rawURL with the values of secret query parameters redacted
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+
+	query := u.Query()
+	for name := range query {
+		if isSecretField(secretFormFields, name) {
+			u.RawQuery = redactValues(query).Encode()
+			break
+		}
+	}
+	return u.String()
+}
+
+// redactBody returns a request or response body with secrets redacted: the
+// secret fields of form bodies, and the secret keys of JSON objects at any
+// depth. Other bodies are returned unchanged.
+func redactBody(contentType string, body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body
+		}
+		return []byte(redactValues(values).Encode())
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return body
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(trimmed, &document); err != nil {
+		return body
+	}
+	if !redactJSON(document) {
+		return body
+	}
+
+	redacted, err := json.Marshal(document)
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+// redactJSON redacts the values of secret keys in a decoded JSON document,
+// reporting whether it found any
+func redactJSON(document interface{}) bool {
+	found := false
+	switch v := document.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if isSecretField(secretFields, key) {
+				v[key] = Redacted
+				found = true
+			} else if redactJSON(value) {
+				found = true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if redactJSON(value) {
+				found = true
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Environment variables selecting the record/replay mode of NewHTTPClient
+const (
+	// RecordDirEnvVar names a directory to record every Snyk API interaction into
+	RecordDirEnvVar = "SNYK_AUTO_ORG_RECORD_DIR"
+	// ReplayDirEnvVar names a directory of recorded interactions to answer
+	// every Snyk API request from, without any network access
+	ReplayDirEnvVar = "SNYK_AUTO_ORG_REPLAY_DIR"
+)
+
+// ErrUnmatchedRequest is returned by a ReplayTransport for requests that
+// weren't recorded. They aren't retried.
+var ErrUnmatchedRequest = errors.New("no recorded Snyk API interaction matches the request")
+
+// Interaction is a recorded request and its response, with secrets redacted
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the request of an Interaction
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the response of an Interaction
+type RecordedResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// key identifies the requests an interaction answers: those with the same
+// method, URL, regardless of the order of its query parameters, and body
+func (r RecordedRequest) key() string {
+	rawURL := r.URL
+	if u, err := url.Parse(rawURL); err == nil {
+		u.RawQuery = u.Query().Encode()
+		rawURL = u.String()
+	}
+	return r.Method + " " + rawURL + "\n" + r.Body
+}
+
+// newRecordedRequest records a request with its secrets redacted
+func newRecordedRequest(req *http.Request, body []byte) RecordedRequest {
+	return RecordedRequest{
+		Method:  req.Method,
+		URL:     redactURL(req.URL.String()),
+		Headers: redactHeader(req.Header),
+		Body:    string(redactBody(req.Header.Get("Content-Type"), body)),
+	}
+}
+
+// RecordingTransport is an http.RoundTripper writing every request and its
+// response to a file in Dir, with secrets redacted, for a ReplayTransport to
+// answer them later
+type RecordingTransport struct {
+	// Base is the transport used to send requests, http.DefaultTransport if nil
+	Base http.RoundTripper
+	Dir  string
+
+	seq atomic.Int64
+}
+
+// NewRecordingTransport creates a RecordingTransport writing to dir
+func NewRecordingTransport(base http.RoundTripper, dir string) *RecordingTransport {
+	return &RecordingTransport{Base: base, Dir: dir}
+}
+
+// RoundTrip sends the request and records it with its response
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	req, reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: newRecordedRequest(req, reqBody),
+		Response: RecordedResponse{
+			Status:  resp.StatusCode,
+			Headers: redactHeader(resp.Header),
+			Body:    string(redactBody(resp.Header.Get("Content-Type"), respBody)),
+		},
+	}
+	if err := t.write(interaction); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// unsafeFileChars are replaced in the names of interaction files
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// write writes an interaction to the next file in Dir, named after its
+// sequence number, method and path so that the files sort in recording order
+func (t *RecordingTransport) write(interaction Interaction) error {
+	if err := os.MkdirAll(t.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal interaction: %w", err)
+	}
+
+	name := interaction.Request.URL
+	if u, err := url.Parse(name); err == nil {
+		name = u.Path
+	}
+	name = strings.Trim(unsafeFileChars.ReplaceAllString(name, "-"), "-")
+	file := filepath.Join(t.Dir, fmt.Sprintf("%04d-%s-%s.json", t.seq.Add(1), interaction.Request.Method, name))
+
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return fmt.Errorf("failed to write interaction: %w", err)
+	}
+	return nil
+}
+
+// ReplayTransport is an http.RoundTripper answering requests from the
+// interactions recorded by a RecordingTransport, without any network access.
+// Requests recorded several times are answered in recording order, repeating
+// the last answer once they run out. Requests that weren't recorded fail with
+// ErrUnmatchedRequest.
+type ReplayTransport struct {
+	mu           sync.Mutex
+	interactions map[string][]Interaction
+	served       map[string]int
+}
+
+// NewReplayTransport creates a ReplayTransport answering from the
+// interactions recorded in dir
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fixtures: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded interactions found in %s", dir)
+	}
+	sort.Strings(files)
+
+	t := &ReplayTransport{interactions: map[string][]Interaction{}, served: map[string]int{}}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture: %w", err)
+		}
+
+		var interaction Interaction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture %s: %w", file, err)
+		}
+
+		key := interaction.Request.key()
+		t.interactions[key] = append(t.interactions[key], interaction)
+	}
+
+	return t, nil
+}
+
+// RoundTrip answers the request with the next recorded response to it
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	recorded := newRecordedRequest(req, body)
+	key := recorded.key()
+
+	t.mu.Lock()
+	interactions := t.interactions[key]
+	if len(interactions) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s %s", ErrUnmatchedRequest, recorded.Method, recorded.URL)
+	}
+	next := min(t.served[key], len(interactions)-1)
+	t.served[key]++
+	t.mu.Unlock()
+
+	response := interactions[next].Response
+	header := response.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", response.Status, http.StatusText(response.Status)),
+		StatusCode:    response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(response.Body)),
+		ContentLength: int64(len(response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// transportFromEnv wraps base in a RecordingTransport or replaces it with a
+// ReplayTransport as selected by RecordDirEnvVar and ReplayDirEnvVar
+func transportFromEnv(base http.RoundTripper) (http.RoundTripper, error) {
+	recordDir, replayDir := os.Getenv(RecordDirEnvVar), os.Getenv(ReplayDirEnvVar)
+	switch {
+	case recordDir != "" && replayDir != "":
+		return nil, fmt.Errorf("%s and %s can't be set together", RecordDirEnvVar, ReplayDirEnvVar)
+	case recordDir != "":
+		return NewRecordingTransport(base, recordDir), nil
+	case replayDir != "":
+		return NewReplayTransport(replayDir)
+	default:
+		return base, nil
+	}
+}
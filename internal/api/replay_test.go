@@ -0,0 +1,163 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("Record and replay", func() {
+	var (
+		ctx    = context.Background()
+		server *httptest.Server
+		dir    string
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("starting_after") == "" {
+				// Link to the next page with the query parameters in another order
+				w.Write([]byte(`{"data": [{"id": "org-id-1", "attributes": {"name": "Organization 1"}}],
+					"links": {"next": "/orgs?starting_after=org-id-1&version=` + api.SnykAPIRestVersion + `&limit=10"}}`))
+				return
+			}
+			w.Write([]byte(`{"data": [{"id": "org-id-2", "attributes": {"name": "Organization 2"}}]}`))
+		}))
+		dir = filepath.Join(GinkgoT().TempDir(), "fixtures")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newClient := func(transport http.RoundTripper) *api.SnykClient {
+		return &api.SnykClient{
+			APIToken:    "secret-api-token",
+			RestBaseURL: server.URL,
+			HTTPClient:  &http.Client{Transport: transport},
+			PageLimit:   10,
+			Retry:       api.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second},
+		}
+	}
+
+	record := func() {
+		orgs, err := newClient(api.NewRecordingTransport(nil, dir)).GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orgs).To(HaveLen(2))
+	}
+
+	It("records every interaction with its secrets redacted", func() {
+		record()
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(2))
+		Expect(filepath.Base(files[0])).To(Equal("0001-GET-orgs.json"))
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).NotTo(ContainSubstring("secret-api-token"))
+			Expect(string(data)).To(ContainSubstring(api.Redacted))
+		}
+	})
+
+	It("replays the interactions without the network", func() {
+		record()
+		server.Close()
+
+		replay, err := api.NewReplayTransport(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		orgs, err := newClient(replay).GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orgs).To(HaveLen(2))
+		Expect(orgs[1].Name).To(Equal("Organization 2"))
+	})
+
+	It("fails unmatched requests without retrying them", func() {
+		record()
+
+		replay, err := api.NewReplayTransport(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		start := time.Now()
+		_, err = newClient(replay).GetGroups(ctx)
+		Expect(err).To(MatchError(api.ErrUnmatchedRequest))
+		Expect(err.Error()).To(ContainSubstring("GET " + server.URL + "/groups?"))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	It("refuses to replay an empty directory", func() {
+		_, err := api.NewReplayTransport(GinkgoT().TempDir())
+		Expect(err).To(MatchError(ContainSubstring("no recorded interactions found")))
+	})
+
+	Describe("NewHTTPClient", func() {
+		It("records when the record directory is set", func() {
+			GinkgoT().Setenv(api.RecordDirEnvVar, dir)
+
+			httpClient, err := api.NewHTTPClient(api.HTTPOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			client := newClient(httpClient.Transport)
+			_, err = client.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Join(dir, "0001-GET-orgs.json")).To(BeARegularFile())
+		})
+
+		It("replays when the replay directory is set", func() {
+			record()
+			GinkgoT().Setenv(api.ReplayDirEnvVar, dir)
+
+			httpClient, err := api.NewHTTPClient(api.HTTPOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			server.Close()
+
+			orgs, err := newClient(httpClient.Transport).GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgs).To(HaveLen(2))
+		})
+
+		It("rejects both modes at once", func() {
+			GinkgoT().Setenv(api.RecordDirEnvVar, dir)
+			GinkgoT().Setenv(api.ReplayDirEnvVar, dir)
+
+			_, err := api.NewHTTPClient(api.HTTPOptions{})
+			Expect(err).To(MatchError(ContainSubstring("can't be set together")))
+		})
+	})
+
+	It("replays requests recorded several times in order, repeating the last answer", func() {
+		statuses := []int{http.StatusTooManyRequests, http.StatusOK}
+		flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			status := statuses[0]
+			statuses = statuses[1:]
+			w.WriteHeader(status)
+		}))
+		defer flaky.Close()
+
+		recorder := &http.Client{Transport: api.NewRecordingTransport(nil, dir)}
+		for range 2 {
+			resp, err := recorder.Get(flaky.URL + "/orgs")
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+		}
+
+		replay, err := api.NewReplayTransport(dir)
+		Expect(err).NotTo(HaveOccurred())
+		replayer := &http.Client{Transport: replay}
+		for _, status := range []int{http.StatusTooManyRequests, http.StatusOK, http.StatusOK} {
+			resp, err := replayer.Get(flaky.URL + "/orgs")
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(status))
+		}
+	})
+})
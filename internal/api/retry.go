@@ -0,0 +1,217 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts = 5                      // Default number of attempts per request, including the first
+	DefaultRetryMaxElapsed  = 2 * time.Minute        // Default total time budget per request, including waits
+	DefaultRetryBaseDelay   = 500 * time.Millisecond // Default delay before the first retry
+	DefaultRetryMaxDelay    = 30 * time.Second       // Default upper bound for a single backoff delay
+)
+
+// RetryPolicy controls how failed requests to the Snyk API are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per request, including the
+	// first one. Values below 2 disable retries.
+	MaxAttempts int
+	// MaxElapsed is the total time budget per request, including waits.
+	// Zero means no time limit.
+	MaxElapsed time.Duration
+	// BaseDelay is the backoff delay before the first retry, doubled on
+	// every following retry
+	BaseDelay time.Duration
+	// MaxDelay caps a single backoff delay
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used by NewSnykClient
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultRetryMaxAttempts,
+		MaxElapsed:  DefaultRetryMaxElapsed,
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+	}
+}
+
+// RetryEvent describes a retry that is about to happen
+type RetryEvent struct {
+	Method      string
+	URL         string
+	Attempt     int // Number of the attempt that is about to be made
+	MaxAttempts int
+	Wait        time.Duration
+	Reason      string
+}
+
+// backoff returns the jittered exponential delay before the given retry (1-based)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	if delay <= 0 {
+		delay = DefaultRetryBaseDelay
+	}
+
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+
+	for i := 1; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	// Use "equal jitter": wait at least half the delay, plus a random share of the rest
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// isRetryableStatus reports whether a response status is worth retrying
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// isTransientNetworkError reports whether a failed request may succeed when
+// sent again: it timed out, or the connection was refused, reset or cut short.
+// Errors that won't go away on their own, such as untrusted certificates,
+// unknown hosts and malformed URLs, aren't.
+func isTransientNetworkError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// serverRequestedWait returns how long the server asked us to wait before
+// retrying, based on the Retry-After and X-RateLimit-* headers
+func serverRequestedWait(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		// Retry-After is either a number of seconds or an HTTP date
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return nonNegative(date.Sub(now)), true
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset := resp.Header.Get("X-RateLimit-Reset"); reset != "" {
+			if value, err := strconv.ParseInt(reset, 10, 64); err == nil && value >= 0 {
+				// Large values are Unix timestamps, small ones are seconds until the reset
+				if value > 1_000_000_000 {
+					return nonNegative(time.Unix(value, 0).Sub(now)), true
+				}
+				return time.Duration(value) * time.Second, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// do executes a request, retrying rate-limited (429) and server error (5xx)
+// responses as well as transient network errors according to the client's
+// retry policy. The request must not have a body.
+func (c *SnykClient) do(req *http.Request) (*http.Response, error) {
+	policy := c.Retry
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		sent := time.Now()
+		resp, err := c.HTTPClient.Do(req)
+		c.logResponse(req, resp, err, time.Since(sent))
+
+		// Never retry once the caller has given up
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctxErr
+		}
+
+		// Requests that weren't recorded won't be on a second try either
+		if errors.Is(err, ErrUnmatchedRequest) {
+			return nil, err
+		}
+
+		var reason string
+		var wait time.Duration
+		switch {
+		case err != nil && !isTransientNetworkError(err):
+			return nil, fmt.Errorf("failed to execute request: %w", err)
+		case err != nil:
+			reason = err.Error()
+			wait = policy.backoff(attempt)
+		case isRetryableStatus(resp.StatusCode):
+			reason = resp.Status
+			if serverWait, ok := serverRequestedWait(resp, time.Now()); ok {
+				wait = serverWait
+			} else {
+				wait = policy.backoff(attempt)
+			}
+		default:
+			return resp, nil
+		}
+
+		// Give up when we're out of attempts or the wait would exceed our time budget
+		outOfAttempts := attempt >= policy.MaxAttempts
+		outOfTime := policy.MaxElapsed > 0 && time.Since(start)+wait > policy.MaxElapsed
+		if outOfAttempts || outOfTime {
+			if err != nil {
+				return nil, fmt.Errorf("failed to execute request: %w", err)
+			}
+			return resp, nil
+		}
+
+		// Discard the failed response before trying again
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		c.retries.Add(1)
+		if c.OnRetry != nil {
+			c.OnRetry(RetryEvent{
+				Method:      req.Method,
+				URL:         req.URL.String(),
+				Attempt:     attempt + 1,
+				MaxAttempts: policy.MaxAttempts,
+				Wait:        wait,
+				Reason:      reason,
+			})
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Retries returns the number of request retries made by the client so far
+func (c *SnykClient) Retries() int {
+	return int(c.retries.Load())
+}
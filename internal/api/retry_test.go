@@ -0,0 +1,189 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("Retries", func() {
+	var (
+		ctx      = context.Background()
+		server   *httptest.Server
+		client   *api.SnykClient
+		mux      *http.ServeMux
+		requests atomic.Int32
+		events   []api.RetryEvent
+	)
+
+	BeforeEach(func() {
+		mux = http.NewServeMux()
+		server = httptest.NewServer(mux)
+		requests.Store(0)
+		events = nil
+
+		client = &api.SnykClient{
+			APIToken:    "test-token",
+			RestBaseURL: server.URL,
+			HTTPClient:  http.DefaultClient,
+			PageLimit:   api.DefaultPageLimit,
+			Retry: api.RetryPolicy{
+				MaxAttempts: 3,
+				MaxElapsed:  5 * time.Second,
+				BaseDelay:   time.Millisecond,
+				MaxDelay:    5 * time.Millisecond,
+			},
+		}
+		client.OnRetry = func(event api.RetryEvent) {
+			events = append(events, event)
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("when the API fails transiently", func() {
+		BeforeEach(func() {
+			mux.HandleFunc("/orgs", func(w http.ResponseWriter, r *http.Request) {
+				switch requests.Add(1) {
+				case 1:
+					w.WriteHeader(http.StatusServiceUnavailable)
+				case 2:
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusTooManyRequests)
+				default:
+					w.Write([]byte(`{"data": [{"id": "org-id-1", "attributes": {"name": "Organization 1", "slug": "org-1"}}]}`))
+				}
+			})
+		})
+
+		It("retries until the request succeeds", func() {
+			orgs, err := client.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgs).To(HaveLen(1))
+			Expect(requests.Load()).To(BeEquivalentTo(3))
+			Expect(client.Retries()).To(Equal(2))
+		})
+
+		It("reports every retry", func() {
+			_, err := client.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(2))
+			Expect(events[0].Attempt).To(Equal(2))
+			Expect(events[0].Reason).To(ContainSubstring("503"))
+			Expect(events[1].Attempt).To(Equal(3))
+			Expect(events[1].Wait).To(Equal(time.Duration(0)))
+		})
+	})
+
+	Context("when the API keeps failing", func() {
+		BeforeEach(func() {
+			mux.HandleFunc("/orgs", func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(http.StatusBadGateway)
+			})
+		})
+
+		It("gives up after the maximum number of attempts", func() {
+			_, err := client.GetOrganizations(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unexpected status code: 502"))
+			Expect(requests.Load()).To(BeEquivalentTo(3))
+		})
+	})
+
+	Context("when the rate limit resets after the time budget", func() {
+		BeforeEach(func() {
+			mux.HandleFunc("/orgs", func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.Header().Set("X-RateLimit-Reset", "60")
+				w.WriteHeader(http.StatusTooManyRequests)
+			})
+		})
+
+		It("gives up without waiting", func() {
+			start := time.Now()
+			_, err := client.GetOrganizations(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unexpected status code: 429"))
+			Expect(requests.Load()).To(BeEquivalentTo(1))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+
+	Context("when the context is cancelled while waiting to retry", func() {
+		BeforeEach(func() {
+			client.Retry.BaseDelay = time.Minute
+			client.Retry.MaxDelay = time.Minute
+			client.Retry.MaxElapsed = 0
+
+			mux.HandleFunc("/orgs", func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+		})
+
+		It("returns promptly with the context error", func() {
+			cancelCtx, cancel := context.WithCancel(ctx)
+			client.OnRetry = func(api.RetryEvent) { cancel() }
+
+			start := time.Now()
+			_, err := client.GetOrganizations(cancelCtx)
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(requests.Load()).To(BeEquivalentTo(1))
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+
+	Context("when the API returns a client error", func() {
+		BeforeEach(func() {
+			mux.HandleFunc("/orgs", func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(http.StatusForbidden)
+			})
+		})
+
+		It("does not retry", func() {
+			_, err := client.GetOrganizations(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(requests.Load()).To(BeEquivalentTo(1))
+			Expect(client.Retries()).To(BeZero())
+		})
+	})
+
+	Context("when the API can't be reached", func() {
+		It("retries refused connections", func() {
+			server.Close()
+
+			_, err := client.GetOrganizations(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(client.Retries()).To(Equal(2))
+		})
+
+		It("doesn't retry untrusted certificates", func() {
+			tlsServer := httptest.NewTLSServer(mux)
+			DeferCleanup(tlsServer.Close)
+			client.RestBaseURL = tlsServer.URL
+
+			_, err := client.GetOrganizations(ctx)
+			Expect(err).To(MatchError(ContainSubstring("certificate")))
+			Expect(client.Retries()).To(BeZero())
+		})
+
+		It("doesn't retry malformed URLs", func() {
+			client.RestBaseURL = "http://127.0.0.1:badport"
+
+			_, err := client.GetOrganizations(ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(client.Retries()).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrSecretNotFound is returned by a SecretBackend without a secret of the given name
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretBackend stores small secrets by name, like an OS keyring or secret service
+type SecretBackend interface {
+	GetSecret(ctx context.Context, name string) ([]byte, error)
+	SetSecret(ctx context.Context, name string, secret []byte) error
+}
+
+// FileSecretBackend implements SecretBackend with files in a directory only
+// the current user can access, for systems without a keyring. The secrets are
+// stored in plain text, so a token encrypted with a key kept here is only
+// obfuscated: anyone who can read the token file can read the key too.
+type FileSecretBackend struct {
+	Dir string
+}
+
+func (b *FileSecretBackend) GetSecret(ctx context.Context, name string) ([]byte, error) {
+	secret, err := os.ReadFile(filepath.Join(b.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSecretNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+
+	return secret, nil
+}
+
+func (b *FileSecretBackend) SetSecret(ctx context.Context, name string, secret []byte) error {
+	if err := os.MkdirAll(b.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	return writeFileAtomic(filepath.Join(b.Dir, name), secret)
+}
+
+// tokenKeyName is the name of the secret holding the token encryption key
+const tokenKeyName = "token-key"
+
+// tokenAdditionalData binds the encrypted token to its purpose and format
+var tokenAdditionalData = []byte("snyk-auto-org token v1")
+
+// EncryptedFileTokenProvider implements TokenProvider by storing the token in
+// a file encrypted with AES-256-GCM, using a key kept in a SecretBackend. The
+// token is only as safe as the backend: use a KeyringSecretBackend to keep the
+// key out of reach of anyone who can read the token file.
+type EncryptedFileTokenProvider struct {
+	// Path is the path of the encrypted token file
+	Path string
+	// Backend stores the encryption key
+	Backend SecretBackend
+}
+
+// NewEncryptedFileTokenProvider creates an EncryptedFileTokenProvider storing
+// the token in dir, with the encryption key in backend, or in the secrets
+// subdirectory of dir if backend is nil
+func NewEncryptedFileTokenProvider(dir string, backend SecretBackend) *EncryptedFileTokenProvider {
+	if backend == nil {
+		backend = &FileSecretBackend{Dir: filepath.Join(dir, "secrets")}
+	}
+
+	return &EncryptedFileTokenProvider{
+		Path:    filepath.Join(dir, "token.enc"),
+		Backend: backend,
+	}
+}
+
+func (p *EncryptedFileTokenProvider) Name() string {
+	return p.Path
+}
+
+func (p *EncryptedFileTokenProvider) GetToken(ctx context.Context) (*TokenStorage, error) {
+	sealed, err := os.ReadFile(p.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encrypted token: %w", err)
+	}
+
+	key, err := p.Backend.GetSecret(ctx, tokenKeyName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token encryption key: %w", err)
+	}
+
+	aead, err := newTokenCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("failed to decrypt token: file is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, tokenAdditionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt token: %w", err)
+	}
+
+	var tokenStorage TokenStorage
+	if err := json.Unmarshal(plaintext, &tokenStorage); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token storage: %w", err)
+	}
+
+	return &tokenStorage, nil
+}
+
+func (p *EncryptedFileTokenProvider) SaveToken(ctx context.Context, token *TokenStorage) error {
+	plaintext, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal token storage: %w", err)
+	}
+
+	key, err := p.encryptionKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newTokenCipher(key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, tokenAdditionalData)
+
+	if err := os.MkdirAll(filepath.Dir(p.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+
+	if err := writeFileAtomic(p.Path, sealed); err != nil {
+		return fmt.Errorf("failed to save encrypted token: %w", err)
+	}
+
+	return nil
+}
+
+// encryptionKey returns the token encryption key, creating it the first time
+func (p *EncryptedFileTokenProvider) encryptionKey(ctx context.Context) ([]byte, error) {
+	key, err := p.Backend.GetSecret(ctx, tokenKeyName)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, ErrSecretNotFound) {
+		return nil, fmt.Errorf("failed to get token encryption key: %w", err)
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate token encryption key: %w", err)
+	}
+
+	if err := p.Backend.SetSecret(ctx, tokenKeyName, key); err != nil {
+		return nil, fmt.Errorf("failed to store token encryption key: %w", err)
+	}
+
+	return key, nil
+}
+
+// newTokenCipher returns the AES-GCM cipher for the token encryption key
+func newTokenCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token encryption key: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+// writeFileAtomic replaces a file with data readable only by the current user,
+// writing to a temporary file first so readers never see it half written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	return nil
+}
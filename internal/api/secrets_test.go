@@ -0,0 +1,157 @@
+package api_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("EncryptedFileTokenProvider", func() {
+	var (
+		ctx      = context.Background()
+		dir      string
+		provider *api.EncryptedFileTokenProvider
+		token    *api.TokenStorage
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		provider = api.NewEncryptedFileTokenProvider(dir, nil)
+		token = &api.TokenStorage{
+			AccessToken:  "access-token",
+			TokenType:    "bearer",
+			RefreshToken: "refresh-token",
+			Expiry:       time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+		}
+	})
+
+	It("reports a missing token file as no token", func() {
+		_, err := provider.GetToken(ctx)
+		Expect(err).To(MatchError(api.ErrNoToken))
+	})
+
+	It("round-trips the token without storing it in plain text", func() {
+		Expect(provider.SaveToken(ctx, token)).To(Succeed())
+
+		data, err := os.ReadFile(provider.Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("refresh-token"))
+
+		info, err := os.Stat(provider.Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		loaded, err := provider.GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.AccessToken).To(Equal("access-token"))
+		Expect(loaded.RefreshToken).To(Equal("refresh-token"))
+		Expect(loaded.Expiry.Equal(token.Expiry)).To(BeTrue())
+	})
+
+	It("keeps the encryption key across saves", func() {
+		Expect(provider.SaveToken(ctx, token)).To(Succeed())
+		key, err := provider.Backend.GetSecret(ctx, "token-key")
+		Expect(err).NotTo(HaveOccurred())
+
+		token.AccessToken = "new-access-token"
+		Expect(provider.SaveToken(ctx, token)).To(Succeed())
+		Expect(provider.Backend.GetSecret(ctx, "token-key")).To(Equal(key))
+
+		loaded, err := provider.GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.AccessToken).To(Equal("new-access-token"))
+	})
+
+	It("rejects a tampered token file", func() {
+		Expect(provider.SaveToken(ctx, token)).To(Succeed())
+
+		data, err := os.ReadFile(provider.Path)
+		Expect(err).NotTo(HaveOccurred())
+		data[len(data)-1] ^= 0xff
+		Expect(os.WriteFile(provider.Path, data, 0600)).To(Succeed())
+
+		_, err = provider.GetToken(ctx)
+		Expect(err).To(MatchError(ContainSubstring("failed to decrypt token")))
+	})
+
+	Describe("MigrateToken", func() {
+		var store *api.ConfigStore
+
+		BeforeEach(func() {
+			store = &api.ConfigStore{Path: filepath.Join(GinkgoT().TempDir(), "snyk.json")}
+			Expect(store.Set("api", "api-token")).To(Succeed())
+		})
+
+		It("moves the token out of the Snyk config", func() {
+			source := &api.ConfigStoreTokenProvider{Store: store}
+			Expect(source.SaveToken(ctx, token)).To(Succeed())
+
+			Expect(source.MigrateToken(ctx, provider)).To(Succeed())
+
+			_, err := source.GetToken(ctx)
+			Expect(err).To(MatchError(api.ErrNoToken))
+			Expect(store.Get("api")).To(Equal("api-token"))
+
+			loaded, err := provider.GetToken(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.RefreshToken).To(Equal("refresh-token"))
+		})
+
+		It("reports a config without OAuth token storage as no token", func() {
+			err := (&api.ConfigStoreTokenProvider{Store: store}).MigrateToken(ctx, provider)
+			Expect(err).To(MatchError(api.ErrNoToken))
+
+			_, err = os.Stat(provider.Path)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("KeyringSecretBackend", func() {
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+			Skip("the fake keyring stands in for secret-tool only")
+		}
+
+		// A fake secret-tool keeping secrets in files, failing lookups of
+		// missing secrets silently like the real one
+		bin := GinkgoT().TempDir()
+		store := GinkgoT().TempDir()
+		script := `#!/bin/sh
+case "$1" in
+lookup) cat "$SECRETS/$3-$5" 2>/dev/null || exit 1 ;;
+store) cat > "$SECRETS/$4-$6" ;;
+esac
+`
+		Expect(os.WriteFile(filepath.Join(bin, "secret-tool"), []byte(script), 0700)).To(Succeed())
+		GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+		GinkgoT().Setenv("SECRETS", store)
+	})
+
+	It("reports a missing secret as not found", func() {
+		_, err := api.NewKeyringSecretBackend().GetSecret(ctx, "token-key")
+		Expect(err).To(MatchError(api.ErrSecretNotFound))
+	})
+
+	It("keeps the token key out of the token directory", func() {
+		dir := GinkgoT().TempDir()
+		provider := api.NewEncryptedFileTokenProvider(dir, api.NewKeyringSecretBackend())
+		Expect(provider.SaveToken(ctx, &api.TokenStorage{AccessToken: "access-token"})).To(Succeed())
+
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+
+		token, err := provider.GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access-token"))
+	})
+})
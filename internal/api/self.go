@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// User is the Snyk user or service account a token belongs to
+type User struct {
+	ID       string
+	Name     string
+	Username string
+	Email    string
+}
+
+// String describes the user by name, with their email or username if known
+func (u User) String() string {
+	name := u.Name
+	if name == "" {
+		name = u.ID
+	}
+
+	switch {
+	case u.Email != "":
+		return fmt.Sprintf("%s (%s)", name, u.Email)
+	case u.Username != "" && u.Username != u.Name:
+		return fmt.Sprintf("%s (%s)", name, u.Username)
+	default:
+		return name
+	}
+}
+
+// selfDocument is the response of the Snyk REST API for the current user
+type selfDocument struct {
+	Data struct {
+		ID         string `json:"id"`
+		Type       string `json:"type"`
+		Attributes struct {
+			Name     string `json:"name"`
+			Username string `json:"username"`
+			Email    string `json:"email"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// GetSelf retrieves the user or service account the client is authenticated as
+func (c *SnykClient) GetSelf(ctx context.Context) (*User, error) {
+	params := url.Values{}
+	params.Add("version", c.restVersion(ResourceSelf))
+
+	reqURL := fmt.Sprintf("%s/self?%s", c.RestBaseURL, params.Encode())
+
+	var document selfDocument
+	if _, err := c.getJSONWithFallback(ctx, reqURL, &document); err != nil {
+		return nil, err
+	}
+	if document.Data.ID == "" {
+		return nil, fmt.Errorf("the Snyk API didn't return the ID of the authenticated user")
+	}
+
+	return &User{
+		ID:       document.Data.ID,
+		Name:     document.Data.Attributes.Name,
+		Username: document.Data.Attributes.Username,
+		Email:    document.Data.Attributes.Email,
+	}, nil
+}
@@ -0,0 +1,64 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("Self", func() {
+	var (
+		ctx    = context.Background()
+		server *httptest.Server
+		client *api.SnykClient
+		body   string
+	)
+
+	BeforeEach(func() {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/self", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("version")).To(Equal(api.SnykAPIRestVersion))
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer test-token"))
+			w.Write([]byte(body))
+		})
+		server = httptest.NewServer(mux)
+
+		client = &api.SnykClient{
+			APIToken:    "test-token",
+			RestBaseURL: server.URL,
+			HTTPClient:  http.DefaultClient,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("returns the authenticated user", func() {
+		body = `{"data": {"id": "user-id-1", "type": "user", "attributes": {"name": "Jane Doe", "username": "jane", "email": "jane@example.com"}}}`
+
+		user, err := client.GetSelf(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*user).To(Equal(api.User{ID: "user-id-1", Name: "Jane Doe", Username: "jane", Email: "jane@example.com"}))
+		Expect(user.String()).To(Equal("Jane Doe (jane@example.com)"))
+	})
+
+	It("returns the authenticated service account", func() {
+		body = `{"data": {"id": "bot-id-1", "type": "service_account", "attributes": {"name": "ci-bot"}}}`
+
+		user, err := client.GetSelf(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.String()).To(Equal("ci-bot"))
+	})
+
+	It("fails without a user ID", func() {
+		body = `{"data": {}}`
+
+		_, err := client.GetSelf(ctx)
+		Expect(err).To(MatchError(ContainSubstring("didn't return the ID")))
+	})
+})
@@ -1,23 +1,25 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os/exec"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	SnykAPIRestBaseURL = "https://api.snyk.io/rest"
-	SnykOAuthBaseURL   = "https://api.snyk.io/oauth2"
+	SnykAPIRestBaseURL = DefaultSnykEndpoint + "/rest"
+	SnykOAuthBaseURL   = DefaultSnykEndpoint + "/oauth2"
 	SnykConfigPath     = ".config/configstore/snyk.json"
-	SnykAPIRestVersion = "2024-10-15"
-	DefaultPageLimit   = 100 // Default number of items per page
+	SnykAPIRestVersion = "2024-10-15" // Default REST API version
+	DefaultPageLimit   = 100          // Default number of items per page
 )
 
 // TokenResponse represents the response from the OAuth2 token endpoint
@@ -41,20 +43,29 @@ type TokenStorage struct {
 
 // TokenProvider defines the interface for token operations
 type TokenProvider interface {
-	GetToken() (*TokenStorage, error)
-	SaveToken(*TokenStorage) error
+	GetToken(ctx context.Context) (*TokenStorage, error)
+	SaveToken(ctx context.Context, token *TokenStorage) error
 }
 
 // CLITokenProvider implements TokenProvider using Snyk CLI config
 type CLITokenProvider struct{}
 
-func (p *CLITokenProvider) GetToken() (*TokenStorage, error) {
-	cmd := exec.Command("snyk", "config", "get", "INTERNAL_OAUTH_TOKEN_STORAGE")
+func (p *CLITokenProvider) Name() string {
+	return "snyk config INTERNAL_OAUTH_TOKEN_STORAGE"
+}
+
+func (p *CLITokenProvider) GetToken(ctx context.Context) (*TokenStorage, error) {
+	cmd := exec.CommandContext(ctx, "snyk", "config", "get", "INTERNAL_OAUTH_TOKEN_STORAGE")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute snyk config command: %w", err)
 	}
 
+	// The CLI prints nothing if the user never authenticated with OAuth
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return nil, ErrNoToken
+	}
+
 	var tokenStorage TokenStorage
 	if err := json.Unmarshal(output, &tokenStorage); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal token storage: %w", err)
@@ -63,13 +74,13 @@ func (p *CLITokenProvider) GetToken() (*TokenStorage, error) {
 	return &tokenStorage, nil
 }
 
-func (p *CLITokenProvider) SaveToken(token *TokenStorage) error {
+func (p *CLITokenProvider) SaveToken(ctx context.Context, token *TokenStorage) error {
 	tokenBytes, err := json.Marshal(token)
 	if err != nil {
 		return fmt.Errorf("failed to marshal token storage: %w", err)
 	}
 
-	cmd := exec.Command("snyk", "config", "set", "INTERNAL_OAUTH_TOKEN_STORAGE", string(tokenBytes))
+	cmd := exec.CommandContext(ctx, "snyk", "config", "set", "INTERNAL_OAUTH_TOKEN_STORAGE", string(tokenBytes))
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to save token storage: %w", err)
 	}
@@ -79,7 +90,7 @@ func (p *CLITokenProvider) SaveToken(token *TokenStorage) error {
 
 // TokenRefresher defines the interface for token refresh operations
 type TokenRefresher interface {
-	RefreshToken(refreshToken string) (*TokenResponse, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*TokenResponse, error)
 }
 
 // OAuth2TokenRefresher implements TokenRefresher using OAuth2 endpoint
@@ -88,34 +99,88 @@ type OAuth2TokenRefresher struct {
 	oauthURL string
 }
 
-func NewOAuth2TokenRefresher() *OAuth2TokenRefresher {
+// NewOAuth2TokenRefresher creates a refresher using the OAuth2 endpoints at
+// oauthURL, or those of the default Snyk instance if it is empty, sending
+// requests with httpClient, or a client with the default HTTPOptions if nil
+func NewOAuth2TokenRefresher(oauthURL string, httpClient *http.Client) *OAuth2TokenRefresher {
+	if oauthURL == "" {
+		oauthURL = SnykOAuthBaseURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultHTTPTimeout}
+	}
+
 	return &OAuth2TokenRefresher{
-		client:   &http.Client{Timeout: 10 * time.Second},
-		oauthURL: SnykOAuthBaseURL,
+		client:   httpClient,
+		oauthURL: oauthURL,
 	}
 }
 
-func (r *OAuth2TokenRefresher) RefreshToken(refreshToken string) (*TokenResponse, error) {
+func (r *OAuth2TokenRefresher) RefreshToken(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+	// API tokens and tokens passed in the environment have no refresh token
+	if refreshToken == "" {
+		return nil, fmt.Errorf("token can't be refreshed")
+	}
+
 	data := url.Values{}
 	data.Set("grant_type", "refresh_token")
 	data.Set("refresh_token", refreshToken)
 
-	req, err := http.NewRequest("POST", r.oauthURL+"/token", strings.NewReader(data.Encode()))
+	tokenResp, err := r.requestToken(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	return tokenResp, nil
+}
+
+// ExchangeCode exchanges an authorization code issued to clientID for a
+// token, proving with verifier that it was requested by this client (PKCE)
+func (r *OAuth2TokenRefresher) ExchangeCode(ctx context.Context, code string, verifier string, redirectURI string, clientID string) (*TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("code_verifier", verifier)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("client_id", clientID)
+
+	tokenResp, err := r.requestToken(ctx, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create refresh token request: %w", err)
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	return tokenResp, nil
+}
+
+// ClientCredentials requests a token for the OAuth client of a service account
+func (r *OAuth2TokenRefresher) ClientCredentials(ctx context.Context, clientID string, clientSecret string) (*TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	data.Set("client_id", clientID)
+	data.Set("client_secret", clientSecret)
+
+	tokenResp, err := r.requestToken(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token for OAuth client %s: %w", clientID, err)
+	}
+	return tokenResp, nil
+}
+
+// requestToken sends a token request to the OAuth2 token endpoint
+func (r *OAuth2TokenRefresher) requestToken(ctx context.Context, data url.Values) (*TokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", r.oauthURL+"/token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute refresh token request: %w", err)
+		return nil, fmt.Errorf("failed to execute token request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to refresh token: status %d, body: %s", resp.StatusCode, string(bodyBytes))
+		return nil, newAPIError(resp)
 	}
 
 	var tokenResp TokenResponse
@@ -126,79 +191,197 @@ func (r *OAuth2TokenRefresher) RefreshToken(refreshToken string) (*TokenResponse
 	return &tokenResp, nil
 }
 
+// NewTokenStorage returns the token storage of a token issued now
+func NewTokenStorage(tokenResp *TokenResponse) *TokenStorage {
+	return &TokenStorage{
+		AccessToken:  tokenResp.AccessToken,
+		TokenType:    tokenResp.TokenType,
+		RefreshToken: tokenResp.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}
+}
+
 // Organization represents a Snyk organization from the REST API
 type Organization struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	Slug       string `json:"slug"`
+	ID      string `json:"id" db:"id"`
+	Name    string `json:"name" db:"name"`
+	Slug    string `json:"slug" db:"slug"`
+	GroupID string `json:"group_id" db:"group_id"`
+	// Role is the name of the authenticated user's role in the organization,
+	// such as Org Admin, or "" if it isn't known
+	Role       string `json:"role" db:"role"`
 	Attributes struct {
-		Name string `json:"name"`
-		Slug string `json:"slug"`
-	} `json:"attributes"`
+		Name    string `json:"name"`
+		Slug    string `json:"slug"`
+		GroupID string `json:"group_id"`
+	} `json:"attributes" db:"-"`
+	Relationships struct {
+		MemberRole struct {
+			Data struct {
+				ID         string `json:"id"`
+				Attributes struct {
+					Name string `json:"name"`
+				} `json:"attributes"`
+			} `json:"data"`
+		} `json:"member_role"`
+	} `json:"relationships" db:"-"`
 }
 
 // OrgsResponse represents the response from the Snyk REST API for organizations
-type OrgsResponse struct {
-	Data  []Organization `json:"data"`
-	Links struct {
-		Next string `json:"next"`
-		Prev string `json:"prev"`
-	} `json:"links"`
+type OrgsResponse = Page[Organization]
+
+// Group represents a Snyk group from the REST API
+type Group struct {
+	ID         string `json:"id" db:"id"`
+	Name       string `json:"name" db:"name"`
+	Slug       string `json:"slug" db:"slug"`
+	Attributes struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	} `json:"attributes" db:"-"`
 }
 
+// GroupsResponse represents the response from the Snyk REST API for groups
+type GroupsResponse = Page[Group]
+
 // Target represents a Snyk target from the REST API
 type Target struct {
-	ID         string `json:"id"`
-	Attributes struct {
-		DisplayName string `json:"displayName"`
-		URL         string `json:"url"`
-	} `json:"attributes"`
+	ID            string              `json:"id"`
+	Attributes    TargetAttributes    `json:"attributes"`
+	Relationships TargetRelationships `json:"relationships"`
+	// Raw is the JSON object the target was decoded from, keeping the fields
+	// not decoded above
+	Raw json.RawMessage `json:"-"`
 }
 
-// TargetsResponse represents the response from the Snyk REST API for targets
-type TargetsResponse struct {
-	Data  []Target `json:"data"`
-	Links struct {
-		Next string `json:"next"`
-		Prev string `json:"prev"`
-	} `json:"links"`
+// TargetAttributes represents the attributes of a Snyk target
+type TargetAttributes struct {
+	DisplayName string    `json:"displayName"`
+	URL         string    `json:"url"`
+	IsPrivate   bool      `json:"is_private"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TargetRelationships represents the relationships of a Snyk target
+type TargetRelationships struct {
+	Integration struct {
+		Data struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				IntegrationType string `json:"integration_type"`
+			} `json:"attributes"`
+		} `json:"data"`
+	} `json:"integration"`
+}
+
+// UnmarshalJSON decodes a target, keeping its JSON object in Raw
+func (t *Target) UnmarshalJSON(data []byte) error {
+	type target Target
+	if err := json.Unmarshal(data, (*target)(t)); err != nil {
+		return err
+	}
+
+	t.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// IntegrationType returns the type of the SCM integration the target was
+// imported with, such as github, github-enterprise or cli
+func (t Target) IntegrationType() string {
+	return t.Relationships.Integration.Data.Attributes.IntegrationType
 }
 
+// IntegrationID returns the ID of the integration the target was imported with
+func (t Target) IntegrationID() string {
+	return t.Relationships.Integration.Data.ID
+}
+
+// TargetsResponse represents the response from the Snyk REST API for targets
+type TargetsResponse = Page[Target]
+
 // OrgTarget represents a combination of an organization and a target
 type OrgTarget struct {
 	OrgID      string
 	OrgName    string
+	OrgRole    string
+	GroupID    string
+	TargetID   string
 	TargetURL  string
 	TargetName string
 }
 
 // SnykClient handles communication with the Snyk API
 type SnykClient struct {
-	APIToken       string
-	RestBaseURL    string
-	HTTPClient     *http.Client
-	PageLimit      int // Number of items per page for paginated requests
-	tokenProvider  TokenProvider
-	tokenRefresher TokenRefresher
+	APIToken    string
+	AuthScheme  string // Authorization scheme of APIToken, Bearer if empty
+	TokenSource string // Where APIToken came from
+	RestBaseURL string
+	HTTPClient  *http.Client
+	PageLimit   int         // Number of items per page for paginated requests
+	Retry       RetryPolicy // How failed requests are retried
+	OnRetry     func(RetryEvent)
+	// RestVersion is the REST API version of requests, SnykAPIRestVersion if empty
+	RestVersion string
+	// RestVersions are the REST API versions of requests for single resources,
+	// such as ResourceTargets, overriding RestVersion
+	RestVersions map[string]string
+	// OnVersionFallback is called when a request for a resource only worked
+	// with another of KnownRestVersions than the one asked for
+	OnVersionFallback func(resource string, version string)
+	// Logger receives the debug log of requests, slog.Default() if nil
+	Logger *slog.Logger
+	// Stats counts the requests sent, if set
+	Stats      *RequestStats
+	versionsMu sync.Mutex
+	auth       *AuthTransport // Refreshes the token when it is rejected, if set
+	retries    atomic.Int64
 }
 
-// NewSnykClient creates a new Snyk API client
-func NewSnykClient() (*SnykClient, error) {
-	provider := &CLITokenProvider{}
-	refresher := NewOAuth2TokenRefresher()
+// NewSnykClient creates a new Snyk API client for the Snyk instance at
+// endpoint, or the default instance if endpoint is nil, authenticating with the
+// token from provider, or the default token providers if provider is nil.
+// Requests are sent with httpClient, from NewHTTPClient, or a client with the
+// default HTTPOptions if it is nil.
+func NewSnykClient(ctx context.Context, endpoint *Endpoint, provider NamedTokenProvider, httpClient *http.Client) (*SnykClient, error) {
+	if endpoint == nil {
+		var err error
+		if endpoint, err = NewEndpoint(DefaultSnykEndpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	if provider == nil {
+		provider = NewDefaultTokenProvider()
+	}
+	if httpClient == nil {
+		var err error
+		if httpClient, err = NewHTTPClient(HTTPOptions{}); err != nil {
+			return nil, err
+		}
+	}
+	var refresher TokenRefresher = NewOAuth2TokenRefresher(endpoint.OAuthBaseURL, httpClient)
+	// Providers issuing their own tokens, such as ClientCredentialsTokenProvider, also refresh them
+	if providerRefresher, ok := provider.(TokenRefresher); ok {
+		refresher = providerRefresher
+	}
 
-	token, err := GetSnykAPIToken(provider, refresher)
+	token, err := GetSnykToken(ctx, provider, refresher)
 	if err != nil {
 		return nil, err
 	}
 
+	// Refresh the token if it expires in the middle of a long scan
+	auth := NewAuthTransport(httpClient.Transport, token, provider, refresher)
+
 	return &SnykClient{
-		APIToken:       token,
-		RestBaseURL:    SnykAPIRestBaseURL,
-		HTTPClient:     &http.Client{Timeout: 10 * time.Second},
-		PageLimit:      DefaultPageLimit,
-		tokenProvider:  provider,
-		tokenRefresher: refresher,
+		APIToken:    token.AccessToken,
+		AuthScheme:  token.AuthScheme(),
+		TokenSource: provider.Name(),
+		RestBaseURL: endpoint.RestBaseURL,
+		HTTPClient:  &http.Client{Timeout: httpClient.Timeout, Transport: auth},
+		PageLimit:   DefaultPageLimit,
+		Retry:       DefaultRetryPolicy(),
+		auth:        auth,
 	}, nil
 }
 
@@ -210,22 +393,38 @@ func redactToken(token string) string {
 	return token[:4] + "..." + token[len(token)-4:]
 }
 
+// credentials returns the current API token and its Authorization scheme
+func (c *SnykClient) credentials() (string, string) {
+	if c.auth != nil {
+		if token := c.auth.Token(); token != nil {
+			return token.AccessToken, token.AuthScheme()
+		}
+	}
+
+	if c.AuthScheme == "" {
+		return c.APIToken, AuthSchemeBearer
+	}
+	return c.APIToken, c.AuthScheme
+}
+
 // logRequest logs information about the API request being made
 func (c *SnykClient) logRequest(method, url string) {
-	redactedToken := redactToken(c.APIToken)
-	log.Printf("Snyk API Request: %s %s [Auth: Bearer %s]", method, url, redactedToken)
+	token, scheme := c.credentials()
+	c.logger().Debug("Snyk API request", "method", method, "url", url, "auth", scheme+" "+redactToken(token))
 }
 
-// GetOrganizations retrieves the list of organizations from the Snyk REST API
-func (c *SnykClient) GetOrganizations() ([]Organization, error) {
+// GetOrganizations retrieves the list of organizations from the Snyk REST API,
+// with the authenticated user's role in each of them
+func (c *SnykClient) GetOrganizations(ctx context.Context) ([]Organization, error) {
 	params := url.Values{}
-	params.Add("version", SnykAPIRestVersion)
+	params.Add("version", c.restVersion(ResourceOrgs))
 	params.Add("limit", fmt.Sprintf("%d", c.PageLimit))
+	params.Add("expand", "member_role")
 
 	reqURL := fmt.Sprintf("%s/orgs?%s", c.RestBaseURL, params.Encode())
 
 	// Call the helper function to fetch all paginated results
-	orgs, err := c.getAllOrganizationPages(reqURL)
+	orgs, err := c.getAllOrganizationPages(ctx, reqURL)
 	if err != nil {
 		return nil, err
 	}
@@ -234,142 +433,107 @@ func (c *SnykClient) GetOrganizations() ([]Organization, error) {
 }
 
 // getAllOrganizationPages retrieves all pages of organizations from the Snyk REST API
-func (c *SnykClient) getAllOrganizationPages(initialURL string) ([]Organization, error) {
+func (c *SnykClient) getAllOrganizationPages(ctx context.Context, initialURL string) ([]Organization, error) {
 	var allOrganizations []Organization
-	nextURL := initialURL
-
-	for nextURL != "" {
-		// Log the request
-		c.logRequest("GET", nextURL)
-
-		// Make request to the current URL
-		req, err := http.NewRequest("GET", nextURL, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
-		}
-
-		req.Header.Set("Content-Type", "application/vnd.api+json")
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIToken))
-
-		resp, err := c.HTTPClient.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to execute request: %w", err)
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(bodyBytes))
-		}
-
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
-		}
-
-		var orgsResp OrgsResponse
-		if err := json.Unmarshal(body, &orgsResp); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-		}
 
+	err := Paginate(ctx, c, initialURL, func(orgs []Organization) (bool, error) {
 		// Map API response to Organization objects and append to result
-		for _, org := range orgsResp.Data {
+		for _, org := range orgs {
 			allOrganizations = append(allOrganizations, Organization{
-				ID:   org.ID,
-				Name: org.Attributes.Name,
-				Slug: org.Attributes.Slug,
+				ID:      org.ID,
+				Name:    org.Attributes.Name,
+				Slug:    org.Attributes.Slug,
+				GroupID: org.Attributes.GroupID,
+				Role:    org.Relationships.MemberRole.Data.Attributes.Name,
 			})
 		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// Check if there's a next page
-		if orgsResp.Links.Next != "" {
-			// If the next URL is a relative path, make it absolute
-			if !isAbsoluteURL(orgsResp.Links.Next) {
-				// Parse the base URL to get its components
-				baseURL, err := url.Parse(c.RestBaseURL)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse base URL: %w", err)
-				}
+	return allOrganizations, nil
+}
 
-				// Parse the relative path
-				relPath, err := url.Parse(orgsResp.Links.Next)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse relative path: %w", err)
-				}
+// GetGroups retrieves the list of groups from the Snyk REST API
+func (c *SnykClient) GetGroups(ctx context.Context) ([]Group, error) {
+	params := url.Values{}
+	params.Add("version", c.restVersion(ResourceGroups))
+	params.Add("limit", fmt.Sprintf("%d", c.PageLimit))
 
-				// Resolve the relative path against the base URL
-				nextURL = baseURL.ResolveReference(relPath).String()
-			} else {
-				nextURL = orgsResp.Links.Next
-			}
-		} else {
-			// No more pages
-			nextURL = ""
+	reqURL := fmt.Sprintf("%s/groups?%s", c.RestBaseURL, params.Encode())
+
+	var allGroups []Group
+	err := Paginate(ctx, c, reqURL, func(groups []Group) (bool, error) {
+		// Map API response to Group objects and append to result
+		for _, group := range groups {
+			allGroups = append(allGroups, Group{
+				ID:   group.ID,
+				Name: group.Attributes.Name,
+				Slug: group.Attributes.Slug,
+			})
 		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return allOrganizations, nil
-}
-
-// isAbsoluteURL checks if the given URL is absolute (starts with http:// or https://)
-func isAbsoluteURL(urlStr string) bool {
-	return len(urlStr) > 8 && (urlStr[:7] == "http://" || urlStr[:8] == "https://")
+	return allGroups, nil
 }
 
 // GetSnykAPIToken retrieves the Snyk API token using the provided TokenProvider
-func GetSnykAPIToken(provider TokenProvider, refresher TokenRefresher) (string, error) {
-	tokenStorage, err := provider.GetToken()
+func GetSnykAPIToken(ctx context.Context, provider TokenProvider, refresher TokenRefresher) (string, error) {
+	tokenStorage, err := GetSnykToken(ctx, provider, refresher)
 	if err != nil {
 		return "", err
 	}
 
+	return tokenStorage.AccessToken, nil
+}
+
+// GetSnykToken retrieves the Snyk API token along with its type using the
+// provided TokenProvider, refreshing it if it is about to expire. Tokens
+// without an expiry, such as API tokens, never expire.
+func GetSnykToken(ctx context.Context, provider TokenProvider, refresher TokenRefresher) (*TokenStorage, error) {
+	tokenStorage, err := provider.GetToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if the access token is expired or about to expire (within 5 minutes)
-	if tokenStorage.Expiry.Before(time.Now().Add(5 * time.Minute)) {
+	if !tokenStorage.Expiry.IsZero() && tokenStorage.Expiry.Before(time.Now().Add(tokenExpiryMargin)) {
 		if tokenStorage.RefreshToken == "" {
-			return "", fmt.Errorf("access token is expired and no refresh token available")
+			return nil, fmt.Errorf("access token is expired and no refresh token available")
 		}
 
 		// Try to refresh the token
-		tokenResp, err := refresher.RefreshToken(tokenStorage.RefreshToken)
+		tokenResp, err := refresher.RefreshToken(ctx, tokenStorage.RefreshToken)
 		if err != nil {
-			return "", fmt.Errorf("failed to refresh token: %w", err)
+			return nil, fmt.Errorf("failed to refresh token: %w", err)
 		}
 
 		// Update token storage with new tokens
-		tokenStorage = &TokenStorage{
-			AccessToken:  tokenResp.AccessToken,
-			TokenType:    tokenResp.TokenType,
-			RefreshToken: tokenResp.RefreshToken,
-			Expiry:       time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
-		}
+		tokenStorage = NewTokenStorage(tokenResp)
 
 		// Save the updated tokens
-		if err := provider.SaveToken(tokenStorage); err != nil {
-			return "", fmt.Errorf("failed to save updated token storage: %w", err)
+		if err := provider.SaveToken(ctx, tokenStorage); err != nil {
+			return nil, fmt.Errorf("failed to save updated token storage: %w", err)
 		}
 	}
 
 	if tokenStorage.AccessToken == "" {
-		return "", fmt.Errorf("no access token found in Snyk config")
+		return nil, fmt.Errorf("no access token found in Snyk config")
 	}
 
-	return tokenStorage.AccessToken, nil
+	return tokenStorage, nil
 }
 
 // GetTargetsWithURL retrieves targets for an organization with a specific URL
-func (c *SnykClient) GetTargetsWithURL(orgID string, urlFilter string) ([]Target, error) {
-	params := url.Values{}
-	params.Add("version", SnykAPIRestVersion)
-	params.Add("limit", fmt.Sprintf("%d", c.PageLimit))
-	if urlFilter != "" {
-		params.Add("url", urlFilter)
-	}
-
-	reqURL := fmt.Sprintf("%s/orgs/%s/targets?%s", c.RestBaseURL, orgID, params.Encode())
-
+func (c *SnykClient) GetTargetsWithURL(ctx context.Context, orgID string, urlFilter string) ([]Target, error) {
 	// Call the helper function to fetch all paginated results
-	targets, err := c.getAllTargetPages(reqURL)
+	targets, err := c.getAllTargetPages(ctx, c.targetsURL(orgID, urlFilter))
 	if err != nil {
 		return nil, err
 	}
@@ -377,92 +541,59 @@ func (c *SnykClient) GetTargetsWithURL(orgID string, urlFilter string) ([]Target
 	return targets, nil
 }
 
-// getAllTargetPages retrieves all pages of targets from the Snyk REST API
-func (c *SnykClient) getAllTargetPages(initialURL string) ([]Target, error) {
-	var allTargets []Target
-	nextURL := initialURL
-
-	for nextURL != "" {
-		// Log the request
-		c.logRequest("GET", nextURL)
-
-		// Make request to the current URL
-		req, err := http.NewRequest("GET", nextURL, nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request: %w", err)
-		}
-
-		req.Header.Set("Content-Type", "application/vnd.api+json")
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.APIToken))
-
-		resp, err := c.HTTPClient.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("failed to execute request: %w", err)
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(bodyBytes))
-		}
+// targetsURL builds the URL of the first page of targets for an organization
+func (c *SnykClient) targetsURL(orgID string, urlFilter string) string {
+	params := url.Values{}
+	params.Add("version", c.restVersion(ResourceTargets))
+	params.Add("limit", fmt.Sprintf("%d", c.PageLimit))
+	if urlFilter != "" {
+		params.Add("url", urlFilter)
+	}
 
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %w", err)
-		}
+	return fmt.Sprintf("%s/orgs/%s/targets?%s", c.RestBaseURL, orgID, params.Encode())
+}
 
-		var targetsResp TargetsResponse
-		if err := json.Unmarshal(body, &targetsResp); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-		}
+// getAllTargetPages retrieves all pages of targets from the Snyk REST API
+func (c *SnykClient) getAllTargetPages(ctx context.Context, initialURL string) ([]Target, error) {
+	var allTargets []Target
 
+	err := Paginate(ctx, c, initialURL, func(targets []Target) (bool, error) {
 		// Append targets from this page to our result
-		allTargets = append(allTargets, targetsResp.Data...)
-
-		// Check if there's a next page
-		if targetsResp.Links.Next != "" {
-			// If the next URL is a relative path, make it absolute
-			if !isAbsoluteURL(targetsResp.Links.Next) {
-				// Parse the base URL to get its components
-				baseURL, err := url.Parse(c.RestBaseURL)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse base URL: %w", err)
-				}
-
-				// Parse the relative path
-				relPath, err := url.Parse(targetsResp.Links.Next)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse relative path: %w", err)
-				}
-
-				// Resolve the relative path against the base URL
-				nextURL = baseURL.ResolveReference(relPath).String()
-			} else {
-				nextURL = targetsResp.Links.Next
-			}
-		} else {
-			// No more pages
-			nextURL = ""
-		}
+		allTargets = append(allTargets, targets...)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return allTargets, nil
 }
 
 // GetTargets retrieves all targets for an organization
-func (c *SnykClient) GetTargets(orgID string) ([]Target, error) {
-	return c.GetTargetsWithURL(orgID, "")
+func (c *SnykClient) GetTargets(ctx context.Context, orgID string) ([]Target, error) {
+	return c.GetTargetsWithURL(ctx, orgID, "")
 }
 
-// FindOrgWithTargetURL finds an organization with a target matching the given URL
-func (c *SnykClient) FindOrgWithTargetURL(targetURL string) (*OrgTarget, error) {
-	organizations, err := c.GetOrganizations()
+// GetTargetsIfModified retrieves all targets for an organization, reporting
+// whether they changed since they were last retrieved. Without a
+// CachingTransport, targets are always reported as changed.
+func (c *SnykClient) GetTargetsIfModified(ctx context.Context, orgID string) ([]Target, bool, error) {
+	var allTargets []Target
+	unchanged, err := paginate(ctx, c, c.targetsURL(orgID, ""), func(targets []Target) (bool, error) {
+		allTargets = append(allTargets, targets...)
+		return true, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get organizations: %w", err)
+		return nil, false, err
 	}
 
-	// Create both HTTP and HTTPS variants of the URL to query
+	return allTargets, !unchanged, nil
+}
+
+// URLVariants returns the URL variants a target for the given repository URL
+// may have been imported with, covering both the HTTPS and HTTP schemes
+func URLVariants(targetURL string) []string {
+	// Create both HTTP and HTTPS variants of the URL
 	httpVariant := targetURL
 	httpsVariant := targetURL
 
@@ -477,25 +608,77 @@ func (c *SnykClient) FindOrgWithTargetURL(targetURL string) (*OrgTarget, error)
 		httpsVariant = "https://" + targetURL
 	}
 
+	return []string{httpsVariant, httpVariant}
+}
+
+// MatchesURL reports whether a target URL equals one of the given URL variants
+func MatchesURL(targetURL string, variants []string) bool {
+	for _, variant := range variants {
+		if targetURL == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// FindTargetByURL asks the Snyk API for the targets of an organization matching
+// the URL variants of targetURL, using the server-side url filter instead of
+// downloading every target. It returns nil if the organization has no such target.
+func (c *SnykClient) FindTargetByURL(ctx context.Context, orgID string, targetURL string) (*Target, error) {
+	variants := URLVariants(targetURL)
+
+	for _, variant := range variants {
+		var match *Target
+
+		// Double check the URL of the filtered targets, stopping at the first match
+		err := Paginate(ctx, c, c.targetsURL(orgID, variant), func(targets []Target) (bool, error) {
+			for i := range targets {
+				if MatchesURL(targets[i].Attributes.URL, variants) {
+					match = &targets[i]
+					return false, nil
+				}
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if match != nil {
+			return match, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// FindOrgWithTargetURL finds an organization with a target matching the given URL
+func (c *SnykClient) FindOrgWithTargetURL(ctx context.Context, targetURL string) (*OrgTarget, error) {
+	organizations, err := c.GetOrganizations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organizations: %w", err)
+	}
+
 	for _, org := range organizations {
-		// Get all targets for this organization
-		targets, err := c.GetTargets(org.ID)
+		// Only ask each organization for targets matching the URL
+		target, err := c.FindTargetByURL(ctx, org.ID, targetURL)
 		if err != nil {
-			// Continue to next org on error
+			// Stop if we were cancelled, otherwise continue to next org on error
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			continue
 		}
 
-		// Search for matching URL in the targets
-		for _, target := range targets {
-			if target.Attributes.URL == httpVariant || target.Attributes.URL == httpsVariant {
-				// Found a target matching one of the URL variants
-				return &OrgTarget{
-					OrgID:      org.ID,
-					OrgName:    org.Name,
-					TargetURL:  target.Attributes.URL,
-					TargetName: target.Attributes.DisplayName,
-				}, nil
-			}
+		if target != nil {
+			return &OrgTarget{
+				OrgID:      org.ID,
+				OrgName:    org.Name,
+				GroupID:    org.GroupID,
+				TargetID:   target.ID,
+				TargetURL:  target.Attributes.URL,
+				TargetName: target.Attributes.DisplayName,
+			}, nil
 		}
 	}
 
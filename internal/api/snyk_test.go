@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -18,11 +19,11 @@ type MockTokenProvider struct {
 	saved *api.TokenStorage
 }
 
-func (m *MockTokenProvider) GetToken() (*api.TokenStorage, error) {
+func (m *MockTokenProvider) GetToken(ctx context.Context) (*api.TokenStorage, error) {
 	return m.token, m.err
 }
 
-func (m *MockTokenProvider) SaveToken(token *api.TokenStorage) error {
+func (m *MockTokenProvider) SaveToken(ctx context.Context, token *api.TokenStorage) error {
 	m.saved = token
 	return nil
 }
@@ -33,12 +34,13 @@ type MockTokenRefresher struct {
 	err      error
 }
 
-func (m *MockTokenRefresher) RefreshToken(refreshToken string) (*api.TokenResponse, error) {
+func (m *MockTokenRefresher) RefreshToken(ctx context.Context, refreshToken string) (*api.TokenResponse, error) {
 	return m.response, m.err
 }
 
 var _ = Describe("SnykClient", func() {
 	var (
+		ctx      = context.Background()
 		server   *httptest.Server
 		client   *api.SnykClient
 		mux      *http.ServeMux
@@ -97,7 +99,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("should refresh the token when expired", func() {
-				token, err := api.GetSnykAPIToken(mockProvider, mockRefresher)
+				token, err := api.GetSnykAPIToken(ctx, mockProvider, mockRefresher)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(token).To(Equal("new-test-token"))
 
@@ -127,7 +129,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("should return an error", func() {
-				_, err := api.GetSnykAPIToken(mockProvider, mockRefresher)
+				_, err := api.GetSnykAPIToken(ctx, mockProvider, mockRefresher)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("failed to refresh token"))
 			})
@@ -145,7 +147,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("should return the existing token without refreshing", func() {
-				token, err := api.GetSnykAPIToken(mockProvider, mockRefresher)
+				token, err := api.GetSnykAPIToken(ctx, mockProvider, mockRefresher)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(token).To(Equal("valid-token"))
 
@@ -166,7 +168,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("should return an error", func() {
-				_, err := api.GetSnykAPIToken(mockProvider, mockRefresher)
+				_, err := api.GetSnykAPIToken(ctx, mockProvider, mockRefresher)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("no refresh token available"))
 			})
@@ -179,6 +181,7 @@ var _ = Describe("SnykClient", func() {
 				mux.HandleFunc("/orgs", func(w http.ResponseWriter, r *http.Request) {
 					Expect(r.Header.Get("Authorization")).To(Equal("Bearer " + token))
 					Expect(r.URL.Query().Get("version")).To(Equal(api.SnykAPIRestVersion))
+					Expect(r.URL.Query().Get("expand")).To(Equal("member_role"))
 					w.WriteHeader(http.StatusOK)
 					w.Write([]byte(`{
 						"data": [
@@ -186,7 +189,17 @@ var _ = Describe("SnykClient", func() {
 								"id": "org-id-1",
 								"attributes": {
 									"name": "Organization 1",
-									"slug": "org-slug-1"
+									"slug": "org-slug-1",
+									"group_id": "group-id-1"
+								},
+								"relationships": {
+									"member_role": {
+										"data": {
+											"id": "role-id-1",
+											"type": "org_role",
+											"attributes": {"name": "Org Collaborator"}
+										}
+									}
 								}
 							},
 							{
@@ -202,15 +215,19 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("returns the list of organizations", func() {
-				orgs, err := client.GetOrganizations()
+				orgs, err := client.GetOrganizations(ctx)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(orgs).To(HaveLen(2))
 				Expect(orgs[0].ID).To(Equal("org-id-1"))
 				Expect(orgs[0].Name).To(Equal("Organization 1"))
 				Expect(orgs[0].Slug).To(Equal("org-slug-1"))
+				Expect(orgs[0].GroupID).To(Equal("group-id-1"))
+				Expect(orgs[0].Role).To(Equal("Org Collaborator"))
 				Expect(orgs[1].ID).To(Equal("org-id-2"))
 				Expect(orgs[1].Name).To(Equal("Organization 2"))
 				Expect(orgs[1].Slug).To(Equal("org-slug-2"))
+				Expect(orgs[1].GroupID).To(BeEmpty())
+				Expect(orgs[1].Role).To(BeEmpty())
 			})
 		})
 
@@ -275,7 +292,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("returns all organizations from all pages", func() {
-				orgs, err := client.GetOrganizations()
+				orgs, err := client.GetOrganizations(ctx)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(orgs).To(HaveLen(4))
 				Expect(orgs[0].ID).To(Equal("org-id-1"))
@@ -336,7 +353,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("should handle unicode-encoded ampersands in pagination links", func() {
-				orgs, err := client.GetOrganizations()
+				orgs, err := client.GetOrganizations(ctx)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(orgs).To(HaveLen(3))
 				Expect(orgs[0].ID).To(Equal("org-id-1"))
@@ -395,7 +412,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("should handle absolute URLs with base path in pagination links", func() {
-				orgs, err := client.GetOrganizations()
+				orgs, err := client.GetOrganizations(ctx)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(orgs).To(HaveLen(3))
 				Expect(orgs[0].ID).To(Equal("org-id-1"))
@@ -412,13 +429,59 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("returns an error", func() {
-				_, err := client.GetOrganizations()
+				_, err := client.GetOrganizations(ctx)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("unexpected status code: 401"))
 			})
 		})
 	})
 
+	Describe("GetGroups", func() {
+		Context("when the API returns paginated results", func() {
+			BeforeEach(func() {
+				mux.HandleFunc("/groups", func(w http.ResponseWriter, r *http.Request) {
+					Expect(r.Header.Get("Authorization")).To(Equal("Bearer " + token))
+
+					if r.URL.Query().Get("starting_after") == "group-id-1" {
+						w.Write([]byte(`{"data": [{"id": "group-id-2", "attributes": {"name": "Group 2", "slug": "group-2"}}]}`))
+						return
+					}
+
+					Expect(r.URL.Query().Get("version")).To(Equal(api.SnykAPIRestVersion))
+
+					w.Write([]byte(`{
+						"data": [{"id": "group-id-1", "attributes": {"name": "Group 1", "slug": "group-1"}}],
+						"links": {"next": "/groups?starting_after=group-id-1"}
+					}`))
+				})
+			})
+
+			It("returns the groups from all pages", func() {
+				groups, err := client.GetGroups(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(groups).To(HaveLen(2))
+				Expect(groups[0].ID).To(Equal("group-id-1"))
+				Expect(groups[0].Name).To(Equal("Group 1"))
+				Expect(groups[0].Slug).To(Equal("group-1"))
+				Expect(groups[1].ID).To(Equal("group-id-2"))
+				Expect(groups[1].Name).To(Equal("Group 2"))
+			})
+		})
+
+		Context("when the API returns an error", func() {
+			BeforeEach(func() {
+				mux.HandleFunc("/groups", func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusForbidden)
+				})
+			})
+
+			It("returns an error", func() {
+				_, err := client.GetGroups(ctx)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
 	Describe("GetTargetsWithURL", func() {
 		Context("when the API returns paginated results", func() {
 			BeforeEach(func() {
@@ -467,7 +530,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("returns all targets from all pages", func() {
-				targets, err := client.GetTargetsWithURL(orgID, "")
+				targets, err := client.GetTargetsWithURL(ctx, orgID, "")
 				Expect(err).NotTo(HaveOccurred())
 				Expect(targets).To(HaveLen(2))
 				Expect(targets[0].ID).To(Equal("target-id-1"))
@@ -499,7 +562,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("returns the list of targets", func() {
-				targets, err := client.GetTargetsWithURL(orgID, gitURL)
+				targets, err := client.GetTargetsWithURL(ctx, orgID, gitURL)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(targets).To(HaveLen(1))
 				Expect(targets[0].ID).To(Equal(targetID))
@@ -551,7 +614,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("should handle absolute URLs with base path in pagination links", func() {
-				targets, err := client.GetTargetsWithURL(orgID, "")
+				targets, err := client.GetTargetsWithURL(ctx, orgID, "")
 				Expect(err).NotTo(HaveOccurred())
 				Expect(targets).To(HaveLen(2))
 				Expect(targets[0].ID).To(Equal("target-id-1"))
@@ -569,13 +632,57 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("returns an error", func() {
-				_, err := client.GetTargetsWithURL(orgID, "")
+				_, err := client.GetTargetsWithURL(ctx, orgID, "")
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("unexpected status code: 401"))
 			})
 		})
 	})
 
+	Describe("FindTargetByURL", func() {
+		var filters []string
+
+		BeforeEach(func() {
+			filters = nil
+			mux.HandleFunc("/orgs/"+orgID+"/targets", func(w http.ResponseWriter, r *http.Request) {
+				filter := r.URL.Query().Get("url")
+				filters = append(filters, filter)
+
+				// Only the HTTP variant of the URL was imported
+				if filter != "http://github.com/test/repo" {
+					w.Write([]byte(`{"data": []}`))
+					return
+				}
+				w.Write([]byte(`{
+					"data": [
+						{
+							"id": "` + targetID + `",
+							"attributes": {
+								"displayName": "test/repo",
+								"url": "http://github.com/test/repo"
+							}
+						}
+					]
+				}`))
+			})
+		})
+
+		It("asks the API for each URL variant until a target matches", func() {
+			target, err := client.FindTargetByURL(ctx, orgID, gitURL)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(target).NotTo(BeNil())
+			Expect(target.ID).To(Equal(targetID))
+			Expect(filters).To(Equal([]string{gitURL, "http://github.com/test/repo"}))
+		})
+
+		It("returns nil when no target matches", func() {
+			target, err := client.FindTargetByURL(ctx, orgID, "https://github.com/test/unknown")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(target).To(BeNil())
+			Expect(filters).To(HaveLen(2))
+		})
+	})
+
 	Describe("FindOrgWithTargetURL", func() {
 		Context("when an organization with the target URL exists", func() {
 			BeforeEach(func() {
@@ -630,7 +737,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("returns the organization with target URL", func() {
-				orgTarget, err := client.FindOrgWithTargetURL(gitURL)
+				orgTarget, err := client.FindOrgWithTargetURL(ctx, gitURL)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(orgTarget).NotTo(BeNil())
 				Expect(orgTarget.OrgID).To(Equal("org-id-2"))
@@ -668,7 +775,7 @@ var _ = Describe("SnykClient", func() {
 			})
 
 			It("returns an error", func() {
-				_, err := client.FindOrgWithTargetURL(gitURL)
+				_, err := client.FindOrgWithTargetURL(ctx, gitURL)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("no organization found with a target matching URL"))
 			})
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// RequestStats counts the Snyk API requests of one or more clients
+type RequestStats struct {
+	requests    atomic.Int64
+	revalidated atomic.Int64
+	duration    atomic.Int64
+}
+
+// Requests returns the number of requests sent, including retries
+func (s *RequestStats) Requests() int64 {
+	return s.requests.Load()
+}
+
+// Revalidated returns the number of responses served from a ResponseCache
+// because the Snyk API answered 304 Not Modified
+func (s *RequestStats) Revalidated() int64 {
+	return s.revalidated.Load()
+}
+
+// Duration returns the total time spent waiting for responses
+func (s *RequestStats) Duration() time.Duration {
+	return time.Duration(s.duration.Load())
+}
+
+// record counts a request that took d
+func (s *RequestStats) record(d time.Duration) {
+	s.requests.Add(1)
+	s.duration.Add(int64(d))
+}
+
+// logResponse logs the outcome of a request that took d, and counts it in Stats
+func (c *SnykClient) logResponse(req *http.Request, resp *http.Response, err error, d time.Duration) {
+	if c.Stats != nil {
+		c.Stats.record(d)
+	}
+
+	if err != nil {
+		c.logger().Debug("Snyk API request failed", "method", req.Method, "url", req.URL.String(), "duration", d, "error", err)
+		return
+	}
+	c.logger().Debug("Snyk API response", "method", req.Method, "url", req.URL.String(), "status", resp.StatusCode,
+		"duration", d, "request_id", resp.Header.Get("snyk-request-id"), "revalidated", IsRevalidated(resp))
+}
+
+// logger returns the client's logger, or the default logger if it has none
+func (c *SnykClient) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
+}
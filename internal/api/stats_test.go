@@ -0,0 +1,73 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("Request logging and stats", func() {
+	var (
+		ctx    = context.Background()
+		server *httptest.Server
+		client *api.SnykClient
+		logs   bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("snyk-request-id", "request-1")
+			w.Write([]byte(`{"data": []}`))
+		}))
+		logs.Reset()
+
+		client = &api.SnykClient{
+			APIToken:    "secret-api-token",
+			RestBaseURL: server.URL,
+			HTTPClient:  http.DefaultClient,
+			PageLimit:   api.DefaultPageLimit,
+			Stats:       &api.RequestStats{},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("logs requests at the debug level without the token", func() {
+		client.Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		_, err := client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(logs.String()).To(ContainSubstring(`level=DEBUG msg="Snyk API request" method=GET`))
+		Expect(logs.String()).To(ContainSubstring("status=200"))
+		Expect(logs.String()).To(ContainSubstring("request_id=request-1"))
+		Expect(logs.String()).NotTo(ContainSubstring("secret-api-token"))
+	})
+
+	It("logs nothing at the info level", func() {
+		client.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+		_, err := client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logs.String()).To(BeEmpty())
+	})
+
+	It("counts the requests", func() {
+		_, err := client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetGroups(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(client.Stats.Requests()).To(Equal(int64(2)))
+		Expect(client.Stats.Duration()).To(BeNumerically(">", 0))
+		Expect(client.Stats.Revalidated()).To(BeZero())
+	})
+})
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Authorization schemes of the Snyk API
+const (
+	// AuthSchemeBearer is used for OAuth access tokens
+	AuthSchemeBearer = "Bearer"
+	// AuthSchemeToken is used for personal and service account API tokens
+	AuthSchemeToken = "token"
+)
+
+// ErrNoToken is returned by a TokenProvider that has no token configured
+var ErrNoToken = errors.New("no token configured")
+
+// NamedTokenProvider is a TokenProvider that can describe where its token comes from
+type NamedTokenProvider interface {
+	TokenProvider
+	// Name describes the source of the token, such as an environment variable
+	Name() string
+}
+
+// AuthScheme returns the Authorization scheme to send the token with
+func (t *TokenStorage) AuthScheme() string {
+	if strings.EqualFold(t.TokenType, AuthSchemeToken) {
+		return AuthSchemeToken
+	}
+	return AuthSchemeBearer
+}
+
+// EnvTokenProvider implements TokenProvider using an environment variable
+// holding a token that never expires
+type EnvTokenProvider struct {
+	// Variable is the name of the environment variable
+	Variable string
+	// Scheme is the Authorization scheme the token is sent with
+	Scheme string
+}
+
+func (p *EnvTokenProvider) Name() string {
+	return p.Variable
+}
+
+func (p *EnvTokenProvider) GetToken(ctx context.Context) (*TokenStorage, error) {
+	token := strings.TrimSpace(os.Getenv(p.Variable))
+	if token == "" {
+		return nil, ErrNoToken
+	}
+
+	return &TokenStorage{AccessToken: token, TokenType: p.Scheme}, nil
+}
+
+func (p *EnvTokenProvider) SaveToken(ctx context.Context, token *TokenStorage) error {
+	return fmt.Errorf("cannot save token to environment variable %s", p.Variable)
+}
+
+// CLIAPITokenProvider implements TokenProvider using the API token stored in
+// the Snyk CLI config by `snyk auth <token>` or `snyk config set api=<token>`
+type CLIAPITokenProvider struct{}
+
+func (p *CLIAPITokenProvider) Name() string {
+	return "snyk config api"
+}
+
+func (p *CLIAPITokenProvider) GetToken(ctx context.Context) (*TokenStorage, error) {
+	cmd := exec.CommandContext(ctx, "snyk", "config", "get", "api")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute snyk config command: %w", err)
+	}
+
+	token := strings.TrimSpace(string(output))
+	if token == "" {
+		return nil, ErrNoToken
+	}
+
+	return &TokenStorage{AccessToken: token, TokenType: AuthSchemeToken}, nil
+}
+
+func (p *CLIAPITokenProvider) SaveToken(ctx context.Context, token *TokenStorage) error {
+	return fmt.Errorf("cannot save a refreshed token as a Snyk API token")
+}
+
+// ChainTokenProvider implements TokenProvider by asking each of its providers
+// in turn and using the first token found
+type ChainTokenProvider struct {
+	Providers []TokenProvider
+	used      TokenProvider
+}
+
+// NewDefaultTokenProvider returns the providers checked by the Snyk CLI, in
+// order: SNYK_TOKEN, SNYK_OAUTH_TOKEN, the API token and the OAuth token storage
+// of the Snyk CLI config. The config file is read directly, running the Snyk
+// CLI only if it can't be read.
+func NewDefaultTokenProvider() *ChainTokenProvider {
+	var apiToken TokenProvider = &CLIAPITokenProvider{}
+	if store, err := NewConfigStore(); err == nil {
+		apiToken = &FallbackTokenProvider{Primary: &ConfigStoreAPITokenProvider{Store: store}, Fallback: apiToken}
+	}
+
+	return &ChainTokenProvider{
+		Providers: []TokenProvider{
+			&EnvTokenProvider{Variable: "SNYK_TOKEN", Scheme: AuthSchemeToken},
+			&EnvTokenProvider{Variable: "SNYK_OAUTH_TOKEN", Scheme: AuthSchemeBearer},
+			apiToken,
+			NewCLIOAuthTokenProvider(),
+		},
+	}
+}
+
+// NewCLIOAuthTokenProvider returns the provider of the OAuth token storage of
+// the Snyk CLI config, read and written directly unless the config file can't
+// be read, in which case the Snyk CLI is run
+func NewCLIOAuthTokenProvider() NamedTokenProvider {
+	store, err := NewConfigStore()
+	if err != nil {
+		return &CLITokenProvider{}
+	}
+	return &FallbackTokenProvider{Primary: &ConfigStoreTokenProvider{Store: store}, Fallback: &CLITokenProvider{}}
+}
+
+// NewEncryptedTokenProvider returns the providers used when the OAuth token is
+// kept in an encrypted file in dir instead of the Snyk CLI config, in order:
+// SNYK_TOKEN, SNYK_OAUTH_TOKEN, the API token of the Snyk CLI config and the
+// encrypted file, whose key is kept in backend
+func NewEncryptedTokenProvider(dir string, backend SecretBackend) *ChainTokenProvider {
+	var apiToken TokenProvider = &CLIAPITokenProvider{}
+	if store, err := NewConfigStore(); err == nil {
+		apiToken = &FallbackTokenProvider{Primary: &ConfigStoreAPITokenProvider{Store: store}, Fallback: apiToken}
+	}
+
+	return &ChainTokenProvider{
+		Providers: []TokenProvider{
+			&EnvTokenProvider{Variable: "SNYK_TOKEN", Scheme: AuthSchemeToken},
+			&EnvTokenProvider{Variable: "SNYK_OAUTH_TOKEN", Scheme: AuthSchemeBearer},
+			apiToken,
+			NewEncryptedFileTokenProvider(dir, backend),
+		},
+	}
+}
+
+// Name describes the provider that supplied the last token
+func (p *ChainTokenProvider) Name() string {
+	if named, ok := p.used.(NamedTokenProvider); ok {
+		return named.Name()
+	}
+	return "token chain"
+}
+
+func (p *ChainTokenProvider) GetToken(ctx context.Context) (*TokenStorage, error) {
+	var errs []error
+	for _, provider := range p.Providers {
+		token, err := provider.GetToken(ctx)
+		if err == nil && token != nil && token.AccessToken != "" {
+			p.used = provider
+			return token, nil
+		}
+
+		// Don't keep trying once we've been cancelled
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		if err != nil && !errors.Is(err, ErrNoToken) {
+			name := "token provider"
+			if named, ok := provider.(NamedTokenProvider); ok {
+				name = named.Name()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("no Snyk token found, run `snyk auth` or set SNYK_TOKEN: %w", errors.Join(errs...))
+	}
+	return nil, fmt.Errorf("no Snyk token found, run `snyk auth` or set SNYK_TOKEN")
+}
+
+// SaveToken saves the token with the provider that supplied it
+func (p *ChainTokenProvider) SaveToken(ctx context.Context, token *TokenStorage) error {
+	if p.used == nil {
+		return fmt.Errorf("no token provider to save the token with")
+	}
+	return p.used.SaveToken(ctx, token)
+}
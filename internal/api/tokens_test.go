@@ -0,0 +1,151 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+// namedMockTokenProvider is a MockTokenProvider with a name
+type namedMockTokenProvider struct {
+	MockTokenProvider
+	name string
+}
+
+func (m *namedMockTokenProvider) Name() string {
+	return m.name
+}
+
+var _ = Describe("Token providers", func() {
+	var ctx = context.Background()
+
+	Describe("EnvTokenProvider", func() {
+		It("reads a non-expiring token from the environment", func() {
+			GinkgoT().Setenv("SNYK_TOKEN", "env-token\n")
+
+			provider := &api.EnvTokenProvider{Variable: "SNYK_TOKEN", Scheme: api.AuthSchemeToken}
+			token, err := provider.GetToken(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("env-token"))
+			Expect(token.AuthScheme()).To(Equal(api.AuthSchemeToken))
+			Expect(token.Expiry.IsZero()).To(BeTrue())
+		})
+
+		It("reports a missing variable as no token", func() {
+			GinkgoT().Setenv("SNYK_TOKEN", "")
+
+			provider := &api.EnvTokenProvider{Variable: "SNYK_TOKEN", Scheme: api.AuthSchemeToken}
+			_, err := provider.GetToken(ctx)
+			Expect(err).To(MatchError(api.ErrNoToken))
+		})
+	})
+
+	Describe("ChainTokenProvider", func() {
+		var first, second, third *namedMockTokenProvider
+
+		BeforeEach(func() {
+			first = &namedMockTokenProvider{name: "first", MockTokenProvider: MockTokenProvider{err: api.ErrNoToken}}
+			second = &namedMockTokenProvider{name: "second", MockTokenProvider: MockTokenProvider{err: errors.New("snyk not installed")}}
+			third = &namedMockTokenProvider{name: "third", MockTokenProvider: MockTokenProvider{token: &api.TokenStorage{AccessToken: "third-token", TokenType: "bearer"}}}
+		})
+
+		It("uses the first provider with a token", func() {
+			chain := &api.ChainTokenProvider{Providers: []api.TokenProvider{first, second, third}}
+			token, err := chain.GetToken(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("third-token"))
+			Expect(chain.Name()).To(Equal("third"))
+		})
+
+		It("saves tokens with the provider that supplied them", func() {
+			chain := &api.ChainTokenProvider{Providers: []api.TokenProvider{first, third}}
+			_, err := chain.GetToken(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(chain.SaveToken(ctx, &api.TokenStorage{AccessToken: "new-token"})).To(Succeed())
+			Expect(third.saved.AccessToken).To(Equal("new-token"))
+		})
+
+		It("reports the failures when no provider has a token", func() {
+			chain := &api.ChainTokenProvider{Providers: []api.TokenProvider{first, second}}
+			_, err := chain.GetToken(ctx)
+			Expect(err).To(MatchError(ContainSubstring("no Snyk token found")))
+			Expect(err).To(MatchError(ContainSubstring("second: snyk not installed")))
+			Expect(err.Error()).NotTo(ContainSubstring("first"))
+		})
+
+		It("prefers SNYK_TOKEN over SNYK_OAUTH_TOKEN", func() {
+			GinkgoT().Setenv("SNYK_TOKEN", "api-token")
+			GinkgoT().Setenv("SNYK_OAUTH_TOKEN", "oauth-token")
+
+			chain := api.NewDefaultTokenProvider()
+			token, err := chain.GetToken(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("api-token"))
+			Expect(token.AuthScheme()).To(Equal(api.AuthSchemeToken))
+			Expect(chain.Name()).To(Equal("SNYK_TOKEN"))
+		})
+
+		It("sends SNYK_OAUTH_TOKEN as a bearer token", func() {
+			GinkgoT().Setenv("SNYK_TOKEN", "")
+			GinkgoT().Setenv("SNYK_OAUTH_TOKEN", "oauth-token")
+
+			chain := api.NewDefaultTokenProvider()
+			token, err := chain.GetToken(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("oauth-token"))
+			Expect(token.AuthScheme()).To(Equal(api.AuthSchemeBearer))
+			Expect(chain.Name()).To(Equal("SNYK_OAUTH_TOKEN"))
+		})
+	})
+
+	Describe("GetSnykToken", func() {
+		It("never refreshes tokens without an expiry", func() {
+			provider := &MockTokenProvider{token: &api.TokenStorage{AccessToken: "api-token", TokenType: api.AuthSchemeToken}}
+			refresher := &MockTokenRefresher{err: errors.New("should not refresh")}
+
+			token, err := api.GetSnykToken(ctx, provider, refresher)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("api-token"))
+			Expect(provider.saved).To(BeNil())
+		})
+
+		It("still refreshes expired OAuth tokens", func() {
+			provider := &MockTokenProvider{token: &api.TokenStorage{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)}}
+			refresher := &MockTokenRefresher{response: &api.TokenResponse{AccessToken: "new", TokenType: "bearer", ExpiresIn: 3600}}
+
+			token, err := api.GetSnykToken(ctx, provider, refresher)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("new"))
+			Expect(token.AuthScheme()).To(Equal(api.AuthSchemeBearer))
+		})
+	})
+
+	Describe("Authorization header", func() {
+		It("uses the token scheme for API tokens", func() {
+			var header string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Get("Authorization")
+				w.Write([]byte(`{"data": []}`))
+			}))
+			defer server.Close()
+
+			client := &api.SnykClient{
+				APIToken:    "api-token",
+				AuthScheme:  api.AuthSchemeToken,
+				RestBaseURL: server.URL,
+				HTTPClient:  http.DefaultClient,
+				PageLimit:   api.DefaultPageLimit,
+			}
+			_, err := client.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header).To(Equal("token api-token"))
+		})
+	})
+})
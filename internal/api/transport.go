@@ -0,0 +1,89 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DefaultHTTPTimeout is the time limit of a single Snyk API request
+const DefaultHTTPTimeout = 10 * time.Second
+
+// Environment variables naming extra CA certificates to trust, as honored by
+// the Snyk CLI
+var caCertEnvVars = []string{"NODE_EXTRA_CA_CERTS", "SNYK_CA_CERTIFICATE_LOCATION"}
+
+// HTTPOptions configures the HTTP client shared by the Snyk API client and the
+// OAuth2 token refresher
+type HTTPOptions struct {
+	// Timeout is the time limit of a single request, DefaultHTTPTimeout if zero
+	Timeout time.Duration
+	// CACertFiles are PEM files of CA certificates to trust in addition to the
+	// system roots and those named by NODE_EXTRA_CA_CERTS and
+	// SNYK_CA_CERTIFICATE_LOCATION
+	CACertFiles []string
+	// ClientCertFile and ClientKeyFile are the PEM files of a client
+	// certificate to present, if set
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// NewHTTPClient creates an HTTP client for the Snyk API the way the Snyk CLI
+// connects: through the proxy named by HTTPS_PROXY, HTTP_PROXY and NO_PROXY,
+// trusting the extra CA certificates, and presenting the client certificate.
+// The client records or replays its interactions if RecordDirEnvVar or
+// ReplayDirEnvVar is set.
+func NewHTTPClient(opts HTTPOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	caFiles := opts.CACertFiles
+	for _, name := range caCertEnvVars {
+		if file := os.Getenv(name); file != "" {
+			caFiles = append(caFiles, file)
+		}
+	}
+	if len(caFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range caFiles {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA certificates: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no CA certificates found in %s", file)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+
+	// Record or replay the Snyk API interactions if asked to
+	roundTripper, err := transportFromEnv(transport)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{Timeout: timeout, Transport: roundTripper}, nil
+}
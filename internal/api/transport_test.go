@@ -0,0 +1,116 @@
+package api_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("NewHTTPClient", func() {
+	var (
+		server *httptest.Server
+		dir    string
+	)
+
+	// writePEM writes a PEM block to a file in dir and returns its path
+	writePEM := func(name string, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		Expect(os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		GinkgoT().Setenv("NODE_EXTRA_CA_CERTS", "")
+		GinkgoT().Setenv("SNYK_CA_CERTIFICATE_LOCATION", "")
+
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.PeerCertificates) > 0 {
+				w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+			}
+		}))
+		server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+		server.StartTLS()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("uses the default timeout", func() {
+		client, err := api.NewHTTPClient(api.HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.Timeout).To(Equal(api.DefaultHTTPTimeout))
+	})
+
+	It("doesn't trust unknown CA certificates", func() {
+		client, err := api.NewHTTPClient(api.HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Get(server.URL)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("trusts the CA certificates named by SNYK_CA_CERTIFICATE_LOCATION", func() {
+		GinkgoT().Setenv("SNYK_CA_CERTIFICATE_LOCATION", writePEM("ca.pem", "CERTIFICATE", server.Certificate().Raw))
+
+		client, err := api.NewHTTPClient(api.HTTPOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+	})
+
+	It("presents the client certificate", func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "snyk-auto-org-test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		Expect(err).NotTo(HaveOccurred())
+
+		client, err := api.NewHTTPClient(api.HTTPOptions{
+			CACertFiles:    []string{writePEM("ca.pem", "CERTIFICATE", server.Certificate().Raw)},
+			ClientCertFile: writePEM("client.pem", "CERTIFICATE", certDER),
+			ClientKeyFile:  writePEM("client.key", "EC PRIVATE KEY", keyDER),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		Expect(string(body[:n])).To(Equal("snyk-auto-org-test"))
+	})
+
+	It("reports CA files without certificates", func() {
+		path := filepath.Join(dir, "empty.pem")
+		Expect(os.WriteFile(path, []byte("not a certificate"), 0600)).To(Succeed())
+
+		_, err := api.NewHTTPClient(api.HTTPOptions{CACertFiles: []string{path}})
+		Expect(err).To(MatchError(ContainSubstring("no CA certificates found")))
+	})
+})
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// REST API resources whose version can be chosen separately
+const (
+	ResourceOrgs     = "orgs"
+	ResourceGroups   = "groups"
+	ResourceTargets  = "targets"
+	ResourceProjects = "projects"
+	ResourceSelf     = "self"
+)
+
+// RestResources are the REST API resources whose version can be chosen separately
+var RestResources = []string{ResourceOrgs, ResourceGroups, ResourceTargets, ResourceProjects, ResourceSelf}
+
+// KnownRestVersions are REST API versions known to work, newest first. When
+// the Snyk API doesn't support the version of a request, these are tried in
+// turn.
+var KnownRestVersions = []string{SnykAPIRestVersion, "2024-06-21", "2024-01-23", "2023-11-06"}
+
+// restVersion returns the REST API version of requests for a resource: the
+// one set for it in RestVersions, else RestVersion, else SnykAPIRestVersion
+func (c *SnykClient) restVersion(resource string) string {
+	c.versionsMu.Lock()
+	defer c.versionsMu.Unlock()
+
+	if version := c.RestVersions[resource]; version != "" {
+		return version
+	}
+	if c.RestVersion != "" {
+		return c.RestVersion
+	}
+	return SnykAPIRestVersion
+}
+
+// setRestVersion makes version the REST API version of requests for a resource
+func (c *SnykClient) setRestVersion(resource string, version string) {
+	c.versionsMu.Lock()
+	defer c.versionsMu.Unlock()
+
+	if c.RestVersions == nil {
+		c.RestVersions = map[string]string{}
+	}
+	c.RestVersions[resource] = version
+}
+
+// IsVersionUnsupported reports whether the Snyk API rejected the request
+// because it doesn't support its REST API version. Only the error objects are
+// looked at, as every JSON:API document mentions a version in its jsonapi member.
+func (e *APIError) IsVersionUnsupported() bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusGone:
+	default:
+		return false
+	}
+
+	for _, obj := range e.Errors {
+		if obj.Source.Parameter == "version" {
+			return true
+		}
+		for _, text := range []string{obj.Code, obj.Title, obj.Detail} {
+			if rejectsVersion(text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rejectsVersion reports whether an error message says that the requested
+// version is unsupported or invalid
+func rejectsVersion(text string) bool {
+	text = strings.ToLower(text)
+	if !strings.Contains(text, "version") {
+		return false
+	}
+	for _, reason := range []string{"unsupported", "not supported", "invalid", "does not exist"} {
+		if strings.Contains(text, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// getJSONWithFallback is getJSON, retrying the request with each of
+// KnownRestVersions if the Snyk API doesn't support its version. The version
+// that worked is used for later requests for the same resource, and reported
+// to OnVersionFallback.
+func (c *SnykClient) getJSONWithFallback(ctx context.Context, reqURL string, v interface{}) (bool, error) {
+	revalidated, err := c.getJSON(ctx, reqURL, v)
+
+	var apiErr *APIError
+	if err == nil || !errors.As(err, &apiErr) || !apiErr.IsVersionUnsupported() {
+		return revalidated, err
+	}
+
+	u, parseErr := url.Parse(reqURL)
+	if parseErr != nil {
+		return false, err
+	}
+	query := u.Query()
+	rejected := query.Get("version")
+	resource := resourceOf(u.Path)
+	if rejected == "" || resource == "" {
+		return false, err
+	}
+
+	for _, version := range KnownRestVersions {
+		if version == rejected {
+			continue
+		}
+
+		query.Set("version", version)
+		u.RawQuery = query.Encode()
+
+		revalidated, retryErr := c.getJSON(ctx, u.String(), v)
+		if retryErr == nil {
+			c.setRestVersion(resource, version)
+			if c.OnVersionFallback != nil {
+				c.OnVersionFallback(resource, version)
+			}
+			return revalidated, nil
+		}
+		if !errors.As(retryErr, &apiErr) || !apiErr.IsVersionUnsupported() {
+			return false, retryErr
+		}
+	}
+
+	return false, err
+}
+
+// resourceOf returns the REST API resource a request path is for, the last of
+// its segments naming one of RestResources, or "" if there is none
+func resourceOf(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		for _, resource := range RestResources {
+			if segments[i] == resource {
+				return resource
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+var _ = Describe("REST API versions", func() {
+	var (
+		ctx    = context.Background()
+		server *httptest.Server
+		client *api.SnykClient
+		mux    *http.ServeMux
+		asked  []string
+	)
+
+	BeforeEach(func() {
+		mux = http.NewServeMux()
+		server = httptest.NewServer(mux)
+		asked = nil
+
+		client = &api.SnykClient{
+			APIToken:    "test-token",
+			RestBaseURL: server.URL,
+			HTTPClient:  http.DefaultClient,
+			PageLimit:   api.DefaultPageLimit,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	// supporting answers requests with a version in supported, and rejects
+	// the others like the Snyk API does
+	supporting := func(supported ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			version := r.URL.Query().Get("version")
+			asked = append(asked, version)
+			for _, v := range supported {
+				if v == version {
+					w.Write([]byte(`{"data": [{"id": "org-id-1", "attributes": {"name": "Organization 1"}}]}`))
+					return
+				}
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"jsonapi": {"version": "1.0"}, "errors": [{"status": "400", "detail": "The requested version is not supported"}]}`))
+		}
+	}
+
+	It("uses the version set for a resource over the one set for every resource", func() {
+		client.RestVersion = "2024-06-21"
+		client.RestVersions = map[string]string{api.ResourceOrgs: "2024-01-23"}
+		mux.HandleFunc("/orgs", supporting("2024-01-23"))
+		mux.HandleFunc("/groups", supporting("2024-06-21"))
+
+		_, err := client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.GetGroups(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(asked).To(Equal([]string{"2024-01-23", "2024-06-21"}))
+	})
+
+	It("falls back to a known version and keeps using it", func() {
+		var fallbacks []string
+		client.OnVersionFallback = func(resource string, version string) {
+			fallbacks = append(fallbacks, resource+"="+version)
+		}
+		fallback := api.KnownRestVersions[2]
+		mux.HandleFunc("/orgs", supporting(fallback))
+
+		orgs, err := client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orgs).To(HaveLen(1))
+		Expect(fallbacks).To(Equal([]string{"orgs=" + fallback}))
+
+		asked = nil
+		_, err = client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(asked).To(Equal([]string{fallback}))
+	})
+
+	It("returns the original error when no known version is supported", func() {
+		mux.HandleFunc("/orgs", supporting())
+
+		_, err := client.GetOrganizations(ctx)
+		Expect(err).To(MatchError(ContainSubstring("unexpected status code: 400")))
+		Expect(asked).To(HaveLen(len(api.KnownRestVersions)))
+	})
+
+	It("doesn't retry other errors", func() {
+		mux.HandleFunc("/orgs", func(w http.ResponseWriter, r *http.Request) {
+			asked = append(asked, r.URL.Query().Get("version"))
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors": [{"status": "400", "detail": "limit must be at most 100"}]}`))
+		})
+
+		_, err := client.GetOrganizations(ctx)
+		Expect(err).To(HaveOccurred())
+		Expect(asked).To(HaveLen(1))
+	})
+
+	DescribeTable("only falls back when an error object rejects the version",
+		func(status int, body string, fallback bool) {
+			var fallbacks []string
+			client.OnVersionFallback = func(resource string, version string) {
+				fallbacks = append(fallbacks, resource+"="+version)
+			}
+			mux.HandleFunc("/orgs/org-id-1/targets", func(w http.ResponseWriter, r *http.Request) {
+				asked = append(asked, r.URL.Query().Get("version"))
+				if r.URL.Query().Get("version") == api.KnownRestVersions[1] {
+					w.Write([]byte(`{"data": []}`))
+					return
+				}
+				w.Header().Set("Content-Type", "application/vnd.api+json")
+				w.WriteHeader(status)
+				w.Write([]byte(body))
+			})
+
+			_, err := client.GetTargets(ctx, "org-id-1")
+			if fallback {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(asked).To(HaveLen(2))
+				Expect(fallbacks).To(Equal([]string{"targets=" + api.KnownRestVersions[1]}))
+			} else {
+				Expect(err).To(HaveOccurred())
+				Expect(asked).To(HaveLen(1))
+				Expect(fallbacks).To(BeEmpty())
+			}
+		},
+		Entry("unknown organization", http.StatusNotFound,
+			`{"jsonapi": {"version": "1.0"}, "errors": [{"status": "404", "code": "SNYK-0004", "title": "Not Found", "detail": "Org bad-org was not found"}]}`, false),
+		Entry("invalid parameter", http.StatusBadRequest,
+			`{"jsonapi": {"version": "1.0"}, "errors": [{"status": "400", "title": "Bad Request", "detail": "limit must be at most 100", "source": {"parameter": "limit"}}]}`, false),
+		Entry("version parameter", http.StatusBadRequest,
+			`{"jsonapi": {"version": "1.0"}, "errors": [{"status": "400", "title": "Bad Request", "detail": "requested version not found", "source": {"parameter": "version"}}]}`, true),
+		Entry("unsupported version", http.StatusNotFound,
+			`{"jsonapi": {"version": "1.0"}, "errors": [{"status": "404", "title": "Not Found", "detail": "The requested version does not exist"}]}`, true),
+	)
+})
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"runtime"
+
+	"github.com/spf13/cobra"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/config"
+)
+
+// authCmd logs in to Snyk with OAuth, without the Snyk CLI
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Log in to Snyk in a browser and store the OAuth token",
+	Long: `Log in to the configured Snyk instance in a browser with OAuth, like
+snyk auth does, and store the token where token_storage says. The Snyk CLI
+and snyk-auto-org then use and refresh it, so that snyk auth never has to be run.`,
+	Args: cobra.NoArgs,
+	// main prints the error
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		restoreLogging, err := setupLogging(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to set up logging: %w", err)
+		}
+		defer restoreLogging()
+
+		noBrowser, _ := cmd.Flags().GetBool("no-browser")
+		return login(cmd.Context(), cfg, cmd.OutOrStdout(), browserOpener(cmd.OutOrStdout(), noBrowser), nil)
+	},
+}
+
+func init() {
+	authCmd.Flags().Bool("no-browser", false, "Only print the login URL instead of opening it in a browser")
+
+	rootCmd.AddCommand(authCmd)
+}
+
+// login runs the OAuth authorization code flow against the configured Snyk
+// instance, listening for the redirect on one of ports, the Snyk CLI's if
+// empty, and stores the token in the configured token storage
+func login(ctx context.Context, cfg *config.Config, out io.Writer, openBrowser func(context.Context, string) error, ports []int) error {
+	endpoint, err := api.ResolveEndpoint(ctx, cfg.APIURL, api.GetConfiguredEndpoint)
+	if err != nil {
+		return err
+	}
+
+	storage, err := newOAuthTokenStorage(cfg)
+	if err != nil {
+		return err
+	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	flow := &api.AuthorizationCodeFlow{
+		AuthorizeURL: endpoint.AuthorizeURL,
+		Refresher:    api.NewOAuth2TokenRefresher(endpoint.OAuthBaseURL, httpClient),
+		Ports:        ports,
+		OpenBrowser:  openBrowser,
+	}
+	token, err := flow.Login(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to log in to Snyk: %w", err)
+	}
+
+	if err := storage.SaveToken(ctx, token); err != nil {
+		return fmt.Errorf("failed to store the Snyk token: %w", err)
+	}
+	slog.Info("Stored the Snyk OAuth token", "storage", storage.Name())
+
+	client, err := api.NewSnykClient(ctx, endpoint, storage, httpClient)
+	if err != nil {
+		return err
+	}
+	user, err := client.GetSelf(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to identify the authenticated Snyk user: %w", err)
+	}
+	fmt.Fprintf(out, "Authenticated as %s at %s\n", user, endpoint.API)
+
+	// Tokens in the environment or the Snyk CLI's api setting are used first
+	provider, err := newTokenProvider(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := provider.GetToken(ctx); err == nil && provider.Name() != storage.Name() {
+		slog.Warn("The new Snyk token won't be used while another one takes precedence", "source", provider.Name())
+	}
+
+	return nil
+}
+
+// newOAuthTokenStorage returns the configured storage of the OAuth token
+func newOAuthTokenStorage(cfg *config.Config) (api.NamedTokenProvider, error) {
+	if cfg.TokenStorage != config.TokenStorageEncrypted {
+		return api.NewCLIOAuthTokenProvider(), nil
+	}
+
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	return api.NewEncryptedFileTokenProvider(dir, newSecretBackend(cfg)), nil
+}
+
+// browserOpener returns a function printing the login URL to out and, unless
+// noBrowser is set, opening it in the default browser
+func browserOpener(out io.Writer, noBrowser bool) func(context.Context, string) error {
+	return func(ctx context.Context, authURL string) error {
+		fmt.Fprintf(out, "Log in to Snyk at:\n\n  %s\n\n", authURL)
+		if noBrowser {
+			return nil
+		}
+
+		var cmd *exec.Cmd
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.Command("open", authURL)
+		case "windows":
+			cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", authURL)
+		default:
+			cmd = exec.Command("xdg-open", authURL)
+		}
+
+		// The URL can still be opened by hand
+		if err := cmd.Start(); err != nil {
+			slog.Info("Failed to open a browser", "error", err)
+			return nil
+		}
+		go cmd.Wait()
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/app"
+	"github.com/z4ce/snyk-auto-org/internal/config"
+	"github.com/z4ce/snyk-auto-org/internal/simulator"
+)
+
+var _ = Describe("Login", func() {
+	var (
+		ctx    = context.Background()
+		server *httptest.Server
+		cfg    *config.Config
+		out    bytes.Buffer
+	)
+
+	// follow stands in for the user's browser, approving the access
+	follow := func(ctx context.Context, authURL string) error {
+		resp, err := http.Get(authURL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	BeforeEach(func() {
+		GinkgoT().Setenv("HOME", GinkgoT().TempDir())
+		GinkgoT().Setenv("XDG_CONFIG_HOME", "")
+		GinkgoT().Setenv("SNYK_API", "")
+		GinkgoT().Setenv("SNYK_TOKEN", "")
+		GinkgoT().Setenv("SNYK_OAUTH_TOKEN", "")
+		GinkgoT().Setenv(api.ClientIDEnvVar, "")
+		GinkgoT().Setenv(api.ClientSecretEnvVar, "")
+
+		fixture, err := simulator.LoadFixture(filepath.Join("..", "simulator", "testdata", "fixture.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		server = httptest.NewServer(simulator.New(fixture))
+		DeferCleanup(server.Close)
+
+		cfg = &config.Config{APIURL: server.URL, TokenStorage: config.TokenStorageSnyk}
+		out.Reset()
+	})
+
+	It("stores the token in the Snyk CLI config", func() {
+		Expect(app.Login(ctx, cfg, &out, follow, []int{0})).To(Succeed())
+		Expect(out.String()).To(HavePrefix("Authenticated as Simulated User"))
+
+		store, err := api.NewConfigStore()
+		Expect(err).NotTo(HaveOccurred())
+		token, err := (&api.ConfigStoreTokenProvider{Store: store}).GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).NotTo(BeEmpty())
+		Expect(token.RefreshToken).NotTo(BeEmpty())
+		Expect(token.Expiry).NotTo(BeZero())
+	})
+
+	It("stores the token in the encrypted token file", func() {
+		cfg.TokenStorage = config.TokenStorageEncrypted
+		cfg.SecretBackend = config.SecretBackendFile
+
+		Expect(app.Login(ctx, cfg, &out, follow, []int{0})).To(Succeed())
+
+		dir, err := config.Dir()
+		Expect(err).NotTo(HaveOccurred())
+		token, err := api.NewEncryptedFileTokenProvider(dir, nil).GetToken(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.RefreshToken).NotTo(BeEmpty())
+	})
+})
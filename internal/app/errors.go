@@ -0,0 +1,44 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+// explainAPIError adds advice on what to do about common Snyk API errors,
+// naming the organization the request was about if it is one of organizations
+func explainAPIError(err error, organizations []api.Organization) error {
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	org := apiErr.OrgID()
+	for _, o := range organizations {
+		if o.ID == org {
+			org = fmt.Sprintf("%s (%s)", o.Name, o.ID)
+			break
+		}
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("the Snyk token was rejected, run `snyk auth` to log in again or check SNYK_TOKEN: %w", err)
+	case http.StatusForbidden:
+		if org != "" {
+			return fmt.Errorf("you don't have access to organization %s, ask one of its admins for access or choose another one with --org: %w", org, err)
+		}
+		return fmt.Errorf("the Snyk token doesn't have permission for this request, check its scopes in the Snyk settings: %w", err)
+	case http.StatusNotFound:
+		if org != "" {
+			return fmt.Errorf("organization %s was not found, check the organization ID given with --org or default_org, or run --reset-cache if it was deleted: %w", org, err)
+		}
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("the Snyk API rate limit was exceeded, try again later or lower the concurrency: %w", err)
+	}
+
+	return err
+}
@@ -0,0 +1,43 @@
+package app_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/app"
+)
+
+var _ = Describe("ExplainAPIError", func() {
+	orgs := []api.Organization{{ID: "org-id-1", Name: "Platform"}}
+
+	apiError := func(status int, endpoint string) error {
+		return fmt.Errorf("failed to get targets from API: %w", &api.APIError{StatusCode: status, Method: "GET", Endpoint: endpoint})
+	}
+
+	It("suggests logging in again when the token is rejected", func() {
+		err := app.ExplainAPIError(apiError(http.StatusUnauthorized, "https://api.snyk.io/rest/orgs"), orgs)
+		Expect(err).To(MatchError(ContainSubstring("run `snyk auth`")))
+
+		var apiErr *api.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+	})
+
+	It("names the organization the user lacks access to", func() {
+		err := app.ExplainAPIError(apiError(http.StatusForbidden, "https://api.snyk.io/rest/orgs/org-id-1/targets"), orgs)
+		Expect(err).To(MatchError(ContainSubstring("you don't have access to organization Platform (org-id-1)")))
+	})
+
+	It("flags unknown organization IDs", func() {
+		err := app.ExplainAPIError(apiError(http.StatusNotFound, "https://api.snyk.io/rest/orgs/org-id-9/targets"), orgs)
+		Expect(err).To(MatchError(ContainSubstring("organization org-id-9 was not found")))
+	})
+
+	It("leaves other errors alone", func() {
+		err := errors.New("network is down")
+		Expect(app.ExplainAPIError(err, orgs)).To(Equal(err))
+	})
+})
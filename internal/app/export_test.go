@@ -0,0 +1,20 @@
+package app
+
+// Export unexported functions for testing
+var ScanOrganizations = scanOrganizations
+var FilterOrgsByGroup = filterOrgsByGroup
+var FindOrganization = findOrganization
+var PrintOrganizations = printOrganizations
+var ScoreOrganizations = scoreOrganizations
+var ScoreProjects = scoreProjects
+var ManifestFromArgs = manifestFromArgs
+var IsMonitorCommand = isMonitorCommand
+var MonitorMatchScore = monitorMatchScore
+var TokenEnv = tokenEnv
+var ExplainAPIError = explainAPIError
+var NewTargetFilter = newTargetFilter
+var FilterTargets = filterTargets
+var FormatTarget = formatTarget
+var RestVersions = restVersions
+var Identify = identify
+var Login = login
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/cache"
+	"github.com/z4ce/snyk-auto-org/internal/config"
+)
+
+// authenticate creates the Snyk API client and makes sure the cache only holds
+// data of the user it is authenticated as, returning the client and a
+// description of the user
+func authenticate(ctx context.Context, cfg *config.Config, db *cache.SQLiteCache) (*api.SnykClient, string, error) {
+	client, err := newSnykClient(ctx, cfg, db)
+	if err != nil {
+		return nil, "", err
+	}
+
+	user, err := identify(ctx, cfg, db, client)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client, user, nil
+}
+
+// identify returns a description of the user the client is authenticated as.
+// Tokens that weren't seen before are looked up with the Snyk API, and the
+// cache is cleared if they belong to another user than the cached data.
+func identify(ctx context.Context, cfg *config.Config, db *cache.SQLiteCache, client *api.SnykClient) (string, error) {
+	identity, err := db.GetIdentity(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// A token always belongs to the same user
+	tokenHash := hashOf(client.APIToken)
+	if identity != nil && identity.TokenHash == tokenHash {
+		return identity.User, nil
+	}
+
+	user, err := client.GetSelf(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to identify the authenticated Snyk user: %w", err)
+	}
+
+	cleared, err := db.StoreIdentity(ctx, cache.Identity{
+		TokenHash: tokenHash,
+		UserHash:  hashOf(cfg.APIURL, user.ID),
+		User:      user.String(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if cleared {
+		slog.Info("Authenticated as another Snyk user, cleared the cache", "user", user.String())
+	}
+
+	return user.String(), nil
+}
+
+// hashOf returns the hex encoded SHA-256 hash of values, so that secrets and
+// personal data aren't stored in the cache
+func hashOf(values ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(values, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,78 @@
+package app_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/app"
+	"github.com/z4ce/snyk-auto-org/internal/cache"
+	"github.com/z4ce/snyk-auto-org/internal/config"
+	"github.com/z4ce/snyk-auto-org/internal/simulator"
+)
+
+var _ = Describe("Identify", func() {
+	var (
+		ctx    = context.Background()
+		sim    *simulator.Server
+		server *httptest.Server
+		db     *cache.SQLiteCache
+		cfg    *config.Config
+		client *api.SnykClient
+	)
+
+	BeforeEach(func() {
+		GinkgoT().Setenv("HOME", GinkgoT().TempDir())
+
+		fixture, err := simulator.LoadFixture(filepath.Join("..", "simulator", "testdata", "fixture.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		sim = simulator.New(fixture)
+		server = httptest.NewServer(sim)
+		DeferCleanup(server.Close)
+
+		db, err = cache.NewSQLiteCacheForEndpoint(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(db.Close)
+
+		cfg = &config.Config{APIURL: server.URL}
+		client = &api.SnykClient{APIToken: "alice-token", RestBaseURL: server.URL + "/rest", HTTPClient: http.DefaultClient}
+	})
+
+	It("looks up the user of a new token only once", func() {
+		user, err := app.Identify(ctx, cfg, db, client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user).To(Equal("Alice (alice@example.com)"))
+		Expect(sim.Requests()).To(Equal(1))
+
+		user, err = app.Identify(ctx, cfg, db, client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user).To(Equal("Alice (alice@example.com)"))
+		Expect(sim.Requests()).To(Equal(1))
+	})
+
+	It("clears the cache when another user authenticates", func() {
+		_, err := app.Identify(ctx, cfg, db, client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(db.StoreOrganizations(ctx, []api.Organization{{ID: "org-backend", Name: "Backend"}})).To(Succeed())
+
+		client.APIToken = "bob-token"
+		user, err := app.Identify(ctx, cfg, db, client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user).To(Equal("Bob (bob@example.com)"))
+
+		orgs, err := db.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orgs).To(BeEmpty())
+	})
+
+	It("fails if the user can't be looked up", func() {
+		sim.InjectFault(simulator.Fault{Path: "/rest/self", Status: http.StatusUnauthorized})
+
+		_, err := app.Identify(ctx, cfg, db, client)
+		Expect(err).To(MatchError(ContainSubstring("failed to identify the authenticated Snyk user")))
+	})
+})
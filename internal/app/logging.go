@@ -0,0 +1,82 @@
+package app
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/cache"
+	"github.com/z4ce/snyk-auto-org/internal/config"
+	"github.com/z4ce/snyk-auto-org/internal/logging"
+)
+
+// requestStats counts the Snyk API requests of every client of the invocation
+var requestStats = &api.RequestStats{}
+
+// httpTrace records the Snyk API traffic of the invocation with --trace-http
+var httpTrace *api.HARRecorder
+
+// setupLogging makes the log file the destination of the default logger, and
+// standard error too for warnings, or with --verbose for every message at the
+// info level and above. Nothing is logged to standard output, which belongs to
+// the Snyk CLI. The returned function restores the previous default logger.
+func setupLogging(cfg *config.Config) (func(), error) {
+	dir, err := config.LogDir()
+	if err != nil {
+		return nil, err
+	}
+
+	consoleLevel := slog.LevelWarn
+	if cfg.Verbose {
+		consoleLevel = min(slog.LevelInfo, cfg.LogLevel)
+	}
+
+	logger, file, err := logging.New(logging.Options{
+		Dir:          dir,
+		Level:        cfg.LogLevel,
+		Format:       cfg.LogFormat,
+		MaxSize:      int64(cfg.LogMaxSize) * 1024 * 1024,
+		MaxBackups:   cfg.LogMaxBackups,
+		Console:      os.Stderr,
+		ConsoleLevel: consoleLevel,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	return func() {
+		slog.SetDefault(previous)
+		file.Close()
+	}, nil
+}
+
+// logSummary logs the Snyk API requests and cache lookups of the invocation
+// that started at start
+func logSummary(start time.Time, db *cache.SQLiteCache) {
+	hits, misses := db.Stats()
+	slog.Info("Invocation summary",
+		"duration", time.Since(start),
+		"api_requests", requestStats.Requests(),
+		"api_duration", requestStats.Duration(),
+		"api_revalidated", requestStats.Revalidated(),
+		"cache_hits", hits,
+		"cache_misses", misses)
+}
+
+// startHTTPTrace records the Snyk API traffic of the HTTP clients created from
+// now on. The returned function writes it to a HAR file at path.
+func startHTTPTrace(path string) func() {
+	httpTrace = api.NewHARRecorder()
+
+	return func() {
+		if err := httpTrace.WriteFile(path); err != nil {
+			slog.Warn("Failed to write HTTP trace", "error", err)
+		} else {
+			slog.Info("Wrote HTTP trace", "file", path)
+		}
+		httpTrace = nil
+	}
+}
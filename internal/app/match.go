@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/cache"
+	"github.com/z4ce/snyk-auto-org/internal/config"
+)
+
+// How well an organization matches a Git repository, from worst to best
+const (
+	// scoreNoMatch means the organization has no target for the repository
+	scoreNoMatch = iota
+	// scoreTarget means the organization has a target for the repository, but
+	// none of its projects are active, or they couldn't be retrieved
+	scoreTarget
+	// scoreActiveProjects means the target has active projects
+	scoreActiveProjects
+	// scoreManifest means an active project covers the manifest being tested
+	scoreManifest
+)
+
+// maxMatchScore returns the best score an organization can get, which depends
+// on whether a manifest file is being tested
+func maxMatchScore(manifest string) int {
+	if manifest != "" {
+		return scoreManifest
+	}
+	return scoreActiveProjects
+}
+
+// monitorMatchScore returns the score of an organization matching the
+// repository when the Snyk command creates projects. Organizations where the
+// user's role can create them outrank every organization where it can't, which
+// are only chosen as a last resort.
+func monitorMatchScore(score int, role string, readOnlyRoles []string) int {
+	if score == scoreNoMatch || !canCreateProjects(role, readOnlyRoles) {
+		return score
+	}
+	return score + scoreManifest
+}
+
+// canCreateProjects reports whether a role can create projects, which is
+// assumed for roles that aren't known
+func canCreateProjects(role string, readOnlyRoles []string) bool {
+	for _, readOnly := range readOnlyRoles {
+		if strings.EqualFold(role, readOnly) {
+			return false
+		}
+	}
+	return true
+}
+
+// isMonitorCommand reports whether the Snyk CLI arguments run a command that
+// creates projects, snyk monitor or snyk container monitor
+func isMonitorCommand(args []string) bool {
+	var commands []string
+	for _, arg := range args {
+		if arg == "--" || len(commands) == 2 {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			commands = append(commands, arg)
+		}
+	}
+
+	switch {
+	case len(commands) > 0 && commands[0] == "monitor":
+		return true
+	case len(commands) > 1 && commands[0] == "container" && commands[1] == "monitor":
+		return true
+	}
+	return false
+}
+
+// scoreProjects rates the projects of a target matching the repository
+func scoreProjects(projects []api.Project, manifest string) int {
+	score := scoreTarget
+	for _, project := range projects {
+		if !project.IsActive() {
+			continue
+		}
+		if manifest != "" && project.CoversFile(manifest) {
+			return scoreManifest
+		}
+		score = scoreActiveProjects
+	}
+	return score
+}
+
+// scoreOrgTarget rates an organization's target matching the repository by its projects
+func scoreOrgTarget(ctx context.Context, orgID string, targetID string, manifest string, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) int {
+	projects, err := getProjects(ctx, orgID, targetID, db, cfg, client)
+	if err != nil {
+		// Still prefer the target over organizations without one
+		if ctx.Err() == nil {
+			slog.Info("Failed to get projects for target", "target_id", targetID, "org_id", orgID, "error", err)
+		}
+		return scoreTarget
+	}
+
+	return scoreProjects(projects, manifest)
+}
+
+// getProjects retrieves the projects of a target, using cache if available
+func getProjects(ctx context.Context, orgID string, targetID string, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) ([]api.Project, error) {
+	// Check if the projects cache for this target is expired
+	expired, err := db.IsProjectsCacheExpired(ctx, orgID, targetID, cfg.CacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check projects cache expiration: %w", err)
+	}
+
+	// If the cache is valid, use it, even if the target has no projects
+	if !expired {
+		projects, err := db.GetProjectsByTarget(ctx, orgID, targetID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get projects from cache: %w", err)
+		}
+		return projects, nil
+	}
+
+	slog.Info("Fetching projects of target", "target_id", targetID, "org_id", orgID)
+
+	projects, err := client.GetProjectsForTarget(ctx, orgID, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get projects from API: %w", err)
+	}
+
+	// Store the projects in the cache
+	if err := db.StoreProjects(ctx, orgID, targetID, projects); err != nil {
+		return nil, fmt.Errorf("failed to store projects in cache: %w", err)
+	}
+
+	return projects, nil
+}
+
+// manifestFromArgs returns the manifest file passed to the Snyk CLI with
+// --file, relative to the root of the repository given the path of the
+// working directory within it, or "" if there is none
+func manifestFromArgs(args []string, prefix string) string {
+	file := ""
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--file="); ok {
+			file = value
+			break
+		}
+		if arg == "--file" && i+1 < len(args) {
+			file = args[i+1]
+			break
+		}
+	}
+
+	if file == "" {
+		return ""
+	}
+
+	return api.NormalizeManifestPath(path.Join(prefix, strings.ReplaceAll(file, "\\", "/")))
+}
@@ -0,0 +1,93 @@
+package app_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/app"
+)
+
+var _ = Describe("Project matching", func() {
+	Describe("ScoreProjects", func() {
+		var projects []api.Project
+
+		BeforeEach(func() {
+			projects = []api.Project{
+				{ID: "project-1", Status: "inactive", TargetFile: "package.json"},
+				{ID: "project-2", Status: "active", TargetFile: "services/api/package.json"},
+			}
+		})
+
+		It("rates a target without active projects lowest", func() {
+			Expect(app.ScoreProjects(projects[:1], "")).To(Equal(1))
+			Expect(app.ScoreProjects(nil, "")).To(Equal(1))
+		})
+
+		It("rates a target with active projects higher", func() {
+			Expect(app.ScoreProjects(projects, "")).To(Equal(2))
+			Expect(app.ScoreProjects(projects, "services/web/package.json")).To(Equal(2))
+		})
+
+		It("rates a target with an active project for the manifest highest", func() {
+			Expect(app.ScoreProjects(projects, "services/api/package.json")).To(Equal(3))
+		})
+
+		It("ignores inactive projects for the manifest", func() {
+			Expect(app.ScoreProjects(projects[:1], "package.json")).To(Equal(1))
+		})
+	})
+
+	Describe("IsMonitorCommand", func() {
+		It("recognizes the commands creating projects", func() {
+			Expect(app.IsMonitorCommand([]string{"monitor"})).To(BeTrue())
+			Expect(app.IsMonitorCommand([]string{"--debug", "monitor", "--all-projects"})).To(BeTrue())
+			Expect(app.IsMonitorCommand([]string{"container", "monitor", "alpine:3"})).To(BeTrue())
+		})
+
+		It("ignores other commands", func() {
+			Expect(app.IsMonitorCommand(nil)).To(BeFalse())
+			Expect(app.IsMonitorCommand([]string{"test", "monitor"})).To(BeFalse())
+			Expect(app.IsMonitorCommand([]string{"container", "test", "monitor"})).To(BeFalse())
+			Expect(app.IsMonitorCommand([]string{"--", "monitor"})).To(BeFalse())
+		})
+	})
+
+	Describe("MonitorMatchScore", func() {
+		readOnlyRoles := []string{"Org Viewer"}
+
+		It("ranks every matching organization where the role can create projects first", func() {
+			writable := app.MonitorMatchScore(1, "Org Collaborator", readOnlyRoles)
+			readOnly := app.MonitorMatchScore(3, "org viewer", readOnlyRoles)
+			Expect(writable).To(BeNumerically(">", readOnly))
+			Expect(readOnly).To(Equal(3))
+		})
+
+		It("assumes unknown roles can create projects", func() {
+			Expect(app.MonitorMatchScore(1, "", readOnlyRoles)).To(Equal(app.MonitorMatchScore(1, "Org Admin", readOnlyRoles)))
+		})
+
+		It("leaves organizations without a matching target unmatched", func() {
+			Expect(app.MonitorMatchScore(0, "Org Admin", readOnlyRoles)).To(Equal(0))
+		})
+	})
+
+	Describe("ManifestFromArgs", func() {
+		It("returns nothing without a --file argument", func() {
+			Expect(app.ManifestFromArgs([]string{"test", "--all-projects"}, "")).To(BeEmpty())
+		})
+
+		It("reads both forms of the --file argument", func() {
+			Expect(app.ManifestFromArgs([]string{"test", "--file=services/api/package.json"}, "")).To(Equal("services/api/package.json"))
+			Expect(app.ManifestFromArgs([]string{"test", "--file", "./services/api/package.json"}, "")).To(Equal("services/api/package.json"))
+		})
+
+		It("makes the manifest relative to the root of the repository", func() {
+			Expect(app.ManifestFromArgs([]string{"test", "--file=package.json"}, "services/api/")).To(Equal("services/api/package.json"))
+			Expect(app.ManifestFromArgs([]string{"test", "--file=../web/package.json"}, "services/api/")).To(Equal("services/web/package.json"))
+		})
+
+		It("ignores arguments after --", func() {
+			Expect(app.ManifestFromArgs([]string{"test", "--", "--file=package.json"}, "")).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/cache"
+	"github.com/z4ce/snyk-auto-org/internal/config"
+)
+
+// getCandidateOrganizations retrieves the organizations that may be selected,
+// restricted to the configured Snyk group if there is one
+func getCandidateOrganizations(ctx context.Context, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) ([]api.Organization, error) {
+	organizations, err := getOrganizations(ctx, db, cfg, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Group == "" {
+		return organizations, nil
+	}
+
+	groups, err := db.GetGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get groups from cache: %w", err)
+	}
+
+	return filterOrgsByGroup(organizations, groups, cfg.Group)
+}
+
+// filterOrgsByGroup returns the organizations belonging to the group matching
+// the given ID, name or slug
+func filterOrgsByGroup(organizations []api.Organization, groups []api.Group, group string) ([]api.Organization, error) {
+	groupID, known := resolveGroupID(groups, group)
+
+	var filtered []api.Organization
+	for _, org := range organizations {
+		if org.GroupID == groupID {
+			filtered = append(filtered, org)
+		}
+	}
+
+	if !known && len(filtered) == 0 {
+		return nil, fmt.Errorf("group not found: %s", group)
+	}
+
+	return filtered, nil
+}
+
+// resolveGroupID returns the ID of the group matching the given ID, name or
+// slug, and whether it was found. Groups that couldn't be listed are assumed
+// to be given by ID.
+func resolveGroupID(groups []api.Group, group string) (string, bool) {
+	for _, g := range groups {
+		if g.ID == group || g.Name == group || g.Slug == group {
+			return g.ID, true
+		}
+	}
+	return group, false
+}
+
+// findOrganization finds the organization matching the given ID, name or slug.
+// Since organization names are only unique within a group, a name shared by
+// several organizations is reported as ambiguous.
+func findOrganization(organizations []api.Organization, option string) (*api.Organization, error) {
+	var matches []api.Organization
+	for _, org := range organizations {
+		// IDs and slugs are unique, so they win outright
+		if org.ID == option || org.Slug == option {
+			return &org, nil
+		}
+		if org.Name == option {
+			matches = append(matches, org)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("organization not found: %s", option)
+	case 1:
+		return &matches[0], nil
+	}
+
+	ids := make([]string, len(matches))
+	for i, org := range matches {
+		ids[i] = org.ID
+	}
+	return nil, fmt.Errorf("organization name %s is ambiguous, use --group or an organization ID: %s", option, strings.Join(ids, ", "))
+}
+
+// warnIfReadOnly warns that the user's role in the organization can't create
+// projects, which commands such as snyk monitor will fail for
+func warnIfReadOnly(org *api.Organization, cfg *config.Config) {
+	if !canCreateProjects(org.Role, cfg.ReadOnlyRoles) {
+		slog.Warn("Your role in the Snyk organization can't create projects", "org", org.Name, "role", org.Role)
+	}
+}
+
+// printOrganizations writes the organizations grouped by their Snyk group
+func printOrganizations(w io.Writer, organizations []api.Organization, groups []api.Group) {
+	fmt.Fprintln(w, "Available Snyk organizations:")
+
+	printed := make(map[string]bool)
+	for _, group := range groups {
+		var members []api.Organization
+		for _, org := range organizations {
+			if org.GroupID == group.ID {
+				members = append(members, org)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s (%s):\n", group.Name, group.ID)
+		for _, org := range members {
+			printOrganization(w, org)
+			printed[org.ID] = true
+		}
+	}
+
+	// Organizations outside any group we know of
+	var ungrouped []api.Organization
+	for _, org := range organizations {
+		if !printed[org.ID] {
+			ungrouped = append(ungrouped, org)
+		}
+	}
+	if len(ungrouped) == 0 {
+		return
+	}
+
+	if len(printed) > 0 {
+		fmt.Fprintln(w, "\nNo group:")
+	}
+	for _, org := range ungrouped {
+		printOrganization(w, org)
+	}
+}
+
+// printOrganization writes an organization with the user's role in it, if known
+func printOrganization(w io.Writer, org api.Organization) {
+	if org.Role == "" {
+		fmt.Fprintf(w, "- %s (%s)\n", org.Name, org.ID)
+		return
+	}
+	fmt.Fprintf(w, "- %s (%s) [%s]\n", org.Name, org.ID, org.Role)
+}
@@ -0,0 +1,122 @@
+package app_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/app"
+)
+
+var _ = Describe("Organizations", func() {
+	var (
+		orgs   []api.Organization
+		groups []api.Group
+	)
+
+	BeforeEach(func() {
+		groups = []api.Group{
+			{ID: "group-id-1", Name: "Group 1", Slug: "group-1"},
+			{ID: "group-id-2", Name: "Group 2", Slug: "group-2"},
+		}
+		orgs = []api.Organization{
+			{ID: "org-id-1", Name: "Platform", Slug: "platform-1", GroupID: "group-id-1"},
+			{ID: "org-id-2", Name: "Platform", Slug: "platform-2", GroupID: "group-id-2"},
+			{ID: "org-id-3", Name: "Web", Slug: "web", GroupID: "group-id-2"},
+			{ID: "org-id-4", Name: "Personal", Slug: "personal"},
+		}
+	})
+
+	Describe("FilterOrgsByGroup", func() {
+		It("keeps the organizations of a group given by name", func() {
+			filtered, err := app.FilterOrgsByGroup(orgs, groups, "Group 2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filtered).To(HaveLen(2))
+			Expect(filtered[0].ID).To(Equal("org-id-2"))
+			Expect(filtered[1].ID).To(Equal("org-id-3"))
+		})
+
+		It("accepts a group slug or ID", func() {
+			bySlug, err := app.FilterOrgsByGroup(orgs, groups, "group-1")
+			Expect(err).NotTo(HaveOccurred())
+			byID, err := app.FilterOrgsByGroup(orgs, groups, "group-id-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bySlug).To(Equal(byID))
+			Expect(byID).To(HaveLen(1))
+		})
+
+		It("falls back to the organizations' group IDs when the groups are unknown", func() {
+			filtered, err := app.FilterOrgsByGroup(orgs, nil, "group-id-2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filtered).To(HaveLen(2))
+		})
+
+		It("returns an error for an unknown group", func() {
+			_, err := app.FilterOrgsByGroup(orgs, groups, "Group 3")
+			Expect(err).To(MatchError(ContainSubstring("group not found: Group 3")))
+		})
+	})
+
+	Describe("FindOrganization", func() {
+		It("finds an organization by ID, slug or unique name", func() {
+			for _, option := range []string{"org-id-3", "web", "Web"} {
+				org, err := app.FindOrganization(orgs, option)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(org.ID).To(Equal("org-id-3"))
+			}
+		})
+
+		It("reports a name shared by several organizations as ambiguous", func() {
+			_, err := app.FindOrganization(orgs, "Platform")
+			Expect(err).To(MatchError(ContainSubstring("ambiguous")))
+			Expect(err.Error()).To(ContainSubstring("org-id-1, org-id-2"))
+		})
+
+		It("resolves a shared name once restricted to a group", func() {
+			filtered, err := app.FilterOrgsByGroup(orgs, groups, "Group 2")
+			Expect(err).NotTo(HaveOccurred())
+
+			org, err := app.FindOrganization(filtered, "Platform")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(org.ID).To(Equal("org-id-2"))
+		})
+
+		It("returns an error when no organization matches", func() {
+			_, err := app.FindOrganization(orgs, "Mobile")
+			Expect(err).To(MatchError("organization not found: Mobile"))
+		})
+	})
+
+	Describe("PrintOrganizations", func() {
+		It("lists the organizations under their groups", func() {
+			var out bytes.Buffer
+			app.PrintOrganizations(&out, orgs, groups)
+			Expect(out.String()).To(Equal(`Available Snyk organizations:
+
+Group 1 (group-id-1):
+- Platform (org-id-1)
+
+Group 2 (group-id-2):
+- Platform (org-id-2)
+- Web (org-id-3)
+
+No group:
+- Personal (org-id-4)
+`))
+		})
+
+		It("lists the organizations without headings when there are no groups", func() {
+			var out bytes.Buffer
+			app.PrintOrganizations(&out, orgs[3:], groups)
+			Expect(out.String()).To(Equal("Available Snyk organizations:\n- Personal (org-id-4)\n"))
+		})
+
+		It("shows the user's role in the organizations where it is known", func() {
+			orgs[3].Role = "Org Viewer"
+			var out bytes.Buffer
+			app.PrintOrganizations(&out, orgs[3:], groups)
+			Expect(out.String()).To(Equal("Available Snyk organizations:\n- Personal (org-id-4) [Org Viewer]\n"))
+		})
+	})
+})
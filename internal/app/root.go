@@ -1,9 +1,16 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -22,10 +29,17 @@ the SNYK_CFG_ORG environment variable based on available organizations
 from your Snyk account.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := run(cmd, args); err != nil {
+			// Exit quietly with the conventional status when interrupted
+			if errors.Is(err, context.Canceled) && cmd.Context().Err() != nil {
+				fmt.Fprintln(os.Stderr, "Interrupted")
+				os.Exit(130)
+			}
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 	},
+	// Pass any argument that isn't one of our subcommands to snyk
+	Args: cobra.ArbitraryArgs,
 	// Don't validate unknown flags, so we can pass them to snyk
 	FParseErrWhitelist: cobra.FParseErrWhitelist{
 		UnknownFlags: true,
@@ -37,8 +51,12 @@ from your Snyk account.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() error {
+	// Cancel everything in flight when the user presses Ctrl-C or we get terminated
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Execute the root command which will handle our flags
-	err := rootCmd.Execute()
+	err := rootCmd.ExecuteContext(ctx)
 
 	// If there's a custom error, it means the execute function used our flags
 	// correctly, so we return that error
@@ -52,12 +70,23 @@ func init() {
 	rootCmd.Flags().String("org", "", "Explicitly specify which organization to use by name or ID")
 	rootCmd.Flags().Bool("list-orgs", false, "Display available organizations and exit")
 	rootCmd.Flags().Bool("list-targets", false, "Display all available targets in the database and exit")
+	rootCmd.Flags().String("target-integration", "", "Only list targets imported with this integration type, such as github or cli")
+	rootCmd.Flags().String("target-visibility", "", "Only list private or public targets")
 	rootCmd.Flags().Bool("verbose", false, "Show additional information during execution")
 	rootCmd.Flags().String("git-url", "", "Specify a Git URL to automatically find the right organization")
 	rootCmd.Flags().Bool("auto-detect-git", true, "Automatically detect Git remote URL for organization selection")
+	rootCmd.Flags().Bool("sync-targets", false, "Download all targets of every organization into the cache")
+	rootCmd.Flags().Int("concurrency", 0, "Number of organizations to scan for targets in parallel")
+	rootCmd.Flags().String("group", "", "Only consider organizations in this Snyk group, by name, slug or ID")
+	rootCmd.Flags().String("rest-version", "", "Snyk REST API version to use, such as 2024-10-15")
+	rootCmd.Flags().String("trace-http", "", "Record the Snyk API requests and responses, with secrets redacted, into this HAR file")
+	rootCmd.Flags().Bool("migrate-token", false, "Move the OAuth token from the Snyk CLI config into an encrypted file and use it from there")
 }
 
-func run(cmd *cobra.Command, args []string) error {
+func run(cmd *cobra.Command, args []string) (err error) {
+	ctx := cmd.Context()
+	start := time.Now()
+
 	// Get all the original arguments, excluding the program name
 	allArgs := os.Args[1:]
 
@@ -95,6 +124,16 @@ func run(cmd *cobra.Command, args []string) error {
 		cfg.Verbose = true
 	}
 
+	// Check for concurrency flag
+	if concurrency, _ := cmd.Flags().GetInt("concurrency"); concurrency > 0 {
+		cfg.Concurrency = concurrency
+	}
+
+	// Check for group flag
+	if group, _ := cmd.Flags().GetString("group"); group != "" {
+		cfg.Group = group
+	}
+
 	// Check for cache-ttl flag
 	if cacheTTLStr, _ := cmd.Flags().GetString("cache-ttl"); cacheTTLStr != "" {
 		cacheTTL, err := time.ParseDuration(cacheTTLStr)
@@ -104,42 +143,123 @@ func run(cmd *cobra.Command, args []string) error {
 		cfg.CacheTTL = cacheTTL
 	}
 
-	// Create the cache
-	db, err := cache.NewSQLiteCache()
+	// Check for rest-version flag
+	if restVersion, _ := cmd.Flags().GetString("rest-version"); restVersion != "" {
+		if err := config.ValidateRestVersion(restVersion); err != nil {
+			return err
+		}
+		cfg.RestVersion = restVersion
+	}
+
+	// Log to the log file, keeping standard output for the Snyk CLI
+	restoreLogging, err := setupLogging(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
+	defer restoreLogging()
+
+	// Record the Snyk API traffic for troubleshooting if requested
+	if traceFile, _ := cmd.Flags().GetString("trace-http"); traceFile != "" {
+		defer startHTTPTrace(traceFile)()
+	}
+
+	// Check if the user requested to migrate the OAuth token
+	if migrate, _ := cmd.Flags().GetBool("migrate-token"); migrate {
+		if err := migrateToken(ctx, cfg); err != nil {
+			return fmt.Errorf("failed to migrate token: %w", err)
+		}
+		// If we're just migrating the token, exit here
+		return nil
+	}
+
+	// If no arguments or flags were provided, show help
+	if len(args) == 0 && len(allArgs) == 0 {
+		return cmd.Help()
+	}
+
+	// Determine which Snyk instance to talk to
+	endpoint, err := api.ResolveEndpoint(ctx, cfg.APIURL, api.GetConfiguredEndpoint)
+	if err != nil {
+		return err
+	}
+	slog.Info("Using Snyk API", "url", endpoint.API, "source", endpoint.Source)
+
+	// Pin the resolved endpoint so every client created below talks to the same instance
+	cfg.APIURL = endpoint.API
+
+	// Create the cache for this instance
+	db, err := cache.NewSQLiteCacheForEndpoint(endpoint.API)
 	if err != nil {
 		return fmt.Errorf("failed to create cache: %w", err)
 	}
 	defer db.Close()
 
+	// Log what this invocation did once it is done
+	defer logSummary(start, db)
+
+	// Explain common Snyk API errors, naming organizations we know of
+	defer func() {
+		if err != nil {
+			organizations, _ := db.GetOrganizations(ctx)
+			err = explainAPIError(err, organizations)
+		}
+	}()
+
 	// Check if the user requested a cache reset
 	if resetCache, _ := cmd.Flags().GetBool("reset-cache"); resetCache {
-		if err := db.ResetCache(); err != nil {
+		if err := db.ResetCache(ctx); err != nil {
 			return fmt.Errorf("failed to reset cache: %w", err)
 		}
-		if cfg.Verbose {
-			fmt.Println("Cache has been reset")
-		}
+		slog.Info("Cache has been reset")
 		// If we're just resetting the cache, exit here
 		return nil
 	}
 
+	// Create the Snyk client, clearing the cache if it belongs to another user
+	client, user, err := authenticate(ctx, cfg, db)
+	if err != nil {
+		return fmt.Errorf("failed to create Snyk client: %w", err)
+	}
+	slog.Info("Authenticated with Snyk", "user", user)
+
+	// Check if the user requested a full sync of all targets
+	if syncTargets, _ := cmd.Flags().GetBool("sync-targets"); syncTargets {
+		if err := syncAllTargets(ctx, db, cfg, client); err != nil {
+			return fmt.Errorf("failed to sync targets: %w", err)
+		}
+		// If we're just syncing targets, exit here
+		if len(snykArgs) == 0 {
+			return nil
+		}
+	}
+
 	// Check if the user requested to list organizations
 	if listOrgs, _ := cmd.Flags().GetBool("list-orgs"); listOrgs {
-		organizations, err := getOrganizations(db, cfg)
+		organizations, err := getCandidateOrganizations(ctx, db, cfg, client)
 		if err != nil {
 			return fmt.Errorf("failed to get organizations: %w", err)
 		}
 
-		fmt.Println("Available Snyk organizations:")
-		for _, org := range organizations {
-			fmt.Printf("- %s (%s)\n", org.Name, org.ID)
+		groups, err := db.GetGroups(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get groups from cache: %w", err)
 		}
+
+		fmt.Printf("Authenticated as %s\n\n", user)
+		printOrganizations(os.Stdout, organizations, groups)
 		return nil
 	}
 
 	// Check if the user requested to list targets
 	if listTargets, _ := cmd.Flags().GetBool("list-targets"); listTargets {
-		err := listAllTargets(db, cfg)
+		integration, _ := cmd.Flags().GetString("target-integration")
+		visibility, _ := cmd.Flags().GetString("target-visibility")
+		filter, err := newTargetFilter(integration, visibility)
+		if err != nil {
+			return err
+		}
+
+		err = listAllTargets(ctx, db, cfg, client, filter)
 		if err != nil {
 			return fmt.Errorf("failed to list targets: %w", err)
 		}
@@ -151,45 +271,29 @@ func run(cmd *cobra.Command, args []string) error {
 		return cmd.Help()
 	}
 
-	// If no arguments or flags were provided, show help
-	if len(args) == 0 && len(allArgs) == 0 {
-		return cmd.Help()
-	}
+	// Organizations where the user can't create projects are avoided for
+	// commands creating them
+	monitor := isMonitorCommand(snykArgs)
 
 	// If the user explicitly specified an organization, use that
 	if orgOption, _ := cmd.Flags().GetString("org"); orgOption != "" {
 		// Check if the org exists and get its ID
-		organizations, err := getOrganizations(db, cfg)
+		organizations, err := getCandidateOrganizations(ctx, db, cfg, client)
 		if err != nil {
 			return fmt.Errorf("failed to get organizations: %w", err)
 		}
 
-		var orgID string
-		found := false
-		for _, org := range organizations {
-			if org.ID == orgOption || org.Name == orgOption || org.Slug == orgOption {
-				orgID = org.ID
-				found = true
-				if cfg.Verbose {
-					fmt.Printf("Using specified Snyk organization: %s (%s)\n", org.Name, org.ID)
-				}
-				break
-			}
+		org, err := findOrganization(organizations, orgOption)
+		if err != nil {
+			return err
 		}
-
-		if !found {
-			return fmt.Errorf("organization not found: %s", orgOption)
+		slog.Info("Using specified Snyk organization", "org", org.Name, "org_id", org.ID)
+		if monitor {
+			warnIfReadOnly(org, cfg)
 		}
 
 		// Use the specified organization
-		executor := cmdpkg.NewSnykExecutor(orgID)
-		return executor.Execute(snykArgs)
-	}
-
-	// Create Snyk client
-	client, err := api.NewSnykClient()
-	if err != nil {
-		return fmt.Errorf("failed to create Snyk client: %w", err)
+		return runSnyk(ctx, cfg, org.ID, snykArgs)
 	}
 
 	// Check if Git URL detection is enabled/provided
@@ -201,52 +305,47 @@ func run(cmd *cobra.Command, args []string) error {
 		// If explicit URL provided, use it, otherwise try to detect
 		if gitURL == "" && autoDetectGit {
 			// Try to detect git remote URL
-			detectedURL, err := cmdpkg.GetGitRemoteURL()
+			detectedURL, err := cmdpkg.GetGitRemoteURL(ctx)
 			if err != nil {
-				if cfg.Verbose {
-					fmt.Printf("Could not detect Git remote URL: %v\n", err)
-				}
+				slog.Info("Could not detect Git remote URL", "error", err)
 				// Continue without setting org since we couldn't detect Git URL
-				if cfg.Verbose {
-					fmt.Println("Running Snyk command without organization")
-				}
-				executor := cmdpkg.NewSnykExecutor("")
-				return executor.Execute(snykArgs)
+				slog.Info("Running Snyk command without organization")
+				return runSnyk(ctx, cfg, "", snykArgs)
 			} else {
 				gitURL = detectedURL
-				if cfg.Verbose {
-					fmt.Printf("Detected Git remote URL: %s\n", gitURL)
-				}
+				slog.Info("Detected Git remote URL", "git_url", gitURL)
 			}
 		}
 
 		// If we have a Git URL (whether provided or detected), use it to find organization
 		if gitURL != "" {
-			if cfg.Verbose {
-				fmt.Printf("Looking for Snyk organization with target URL: %s\n", gitURL)
+			slog.Info("Looking for Snyk organization with target URL", "git_url", gitURL)
+
+			// Prefer the organization monitoring the manifest being tested, if any.
+			// Outside a Git repository, the manifest path is taken as it is.
+			prefix, _ := cmdpkg.GetGitPrefix(ctx)
+			manifest := manifestFromArgs(snykArgs, prefix)
+			if manifest != "" {
+				slog.Info("Looking for a project for manifest file", "manifest", manifest)
 			}
 
-			orgID, err := findOrgByGitURL(gitURL, db, cfg, client)
+			orgID, err := findOrgByGitURL(ctx, gitURL, manifest, monitor, db, cfg, client)
 			if err == nil {
 				// Found organization by URL, use it
-				if cfg.Verbose {
-					// Get organization name
-					organizations, err := getOrganizations(db, cfg)
-					if err == nil {
-						for _, org := range organizations {
-							if org.ID == orgID {
-								fmt.Printf("Using Snyk organization %s (%s) for Git URL: %s\n", org.Name, org.ID, gitURL)
-								break
-							}
+				organizations, err := db.GetOrganizations(ctx)
+				if err == nil {
+					for _, org := range organizations {
+						if org.ID == orgID {
+							slog.Info("Using Snyk organization for Git URL", "org", org.Name, "org_id", org.ID, "git_url", gitURL)
+							break
 						}
 					}
 				}
 
 				// Execute with the found organization
-				executor := cmdpkg.NewSnykExecutor(orgID)
-				return executor.Execute(snykArgs)
-			} else if cfg.Verbose {
-				fmt.Printf("Could not find organization for Git URL: %v\n", err)
+				return runSnyk(ctx, cfg, orgID, snykArgs)
+			} else {
+				slog.Info("Could not find organization for Git URL", "error", err)
 			}
 		}
 	}
@@ -256,42 +355,280 @@ func run(cmd *cobra.Command, args []string) error {
 
 	// Check if there's a default org in the config
 	if cfg.DefaultOrg != "" {
-		organizations, err := getOrganizations(db, cfg)
+		organizations, err := getCandidateOrganizations(ctx, db, cfg, client)
 		if err != nil {
 			return fmt.Errorf("failed to get organizations: %w", err)
 		}
 
 		// Try to find the default org
-		for _, org := range organizations {
-			if org.ID == cfg.DefaultOrg || org.Name == cfg.DefaultOrg || org.Slug == cfg.DefaultOrg {
-				if cfg.Verbose {
-					fmt.Printf("Using default organization from config: %s (%s)\n", org.Name, org.ID)
-				}
-				executor := cmdpkg.NewSnykExecutor(org.ID)
-				return executor.Execute(snykArgs)
+		org, err := findOrganization(organizations, cfg.DefaultOrg)
+		if err == nil {
+			slog.Info("Using default organization from config", "org", org.Name, "org_id", org.ID)
+			if monitor {
+				warnIfReadOnly(org, cfg)
 			}
+			return runSnyk(ctx, cfg, org.ID, snykArgs)
+		} else {
+			slog.Info("Could not use default organization from config", "error", err)
 		}
 	}
 
 	// Run the command without setting an organization
-	if cfg.Verbose {
-		fmt.Println("Running Snyk command without organization")
+	slog.Info("Running Snyk command without organization")
+	return runSnyk(ctx, cfg, "", snykArgs)
+}
+
+// newSnykClient creates a Snyk API client for the configured Snyk instance
+// using the retry settings from the configuration. Responses are revalidated
+// with the Snyk API rather than downloaded again when they are in the cache.
+func newSnykClient(ctx context.Context, cfg *config.Config, db *cache.SQLiteCache) (*api.SnykClient, error) {
+	endpoint, err := api.NewEndpoint(cfg.APIURL)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := newTokenProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = api.NewCachingTransport(httpClient.Transport, db)
+
+	client, err := api.NewSnykClient(ctx, endpoint, provider, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Retry.MaxAttempts = cfg.RetryMaxAttempts
+	client.Retry.MaxElapsed = cfg.RetryMaxWait
+	client.Stats = requestStats
+
+	// Use the REST API versions negotiated before unless configured otherwise
+	remembered, err := db.GetRestVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client.RestVersion = cfg.RestVersion
+	client.RestVersions = restVersions(cfg, remembered)
+	client.OnVersionFallback = func(resource string, version string) {
+		slog.Info("Snyk REST API version not supported, falling back", "resource", resource, "version", version)
+		// Failing to remember the version only costs negotiating it again
+		_ = db.StoreRestVersion(ctx, resource, version)
+	}
+
+	slog.Info("Authenticating with the Snyk token", "source", client.TokenSource)
+	client.OnRetry = func(event api.RetryEvent) {
+		slog.Info("Retrying Snyk API request", "method", event.Method, "url", event.URL,
+			"wait", event.Wait.Round(time.Millisecond), "reason", event.Reason,
+			"attempt", event.Attempt, "max_attempts", event.MaxAttempts, "retries", client.Retries())
+	}
+
+	return client, nil
+}
+
+// restVersions returns the REST API versions of single resources: those set in
+// the configuration, else those negotiated before, which a REST API version
+// set for every resource takes precedence over
+func restVersions(cfg *config.Config, remembered map[string]string) map[string]string {
+	versions := map[string]string{}
+	if cfg.RestVersion == "" {
+		for resource, version := range remembered {
+			versions[resource] = version
+		}
+	}
+	for resource, version := range cfg.RestVersions {
+		versions[resource] = version
+	}
+	return versions
+}
+
+// newHTTPClient creates the HTTP client for the Snyk API with the configured
+// timeout, CA certificates and client certificate
+func newHTTPClient(cfg *config.Config) (*http.Client, error) {
+	opts := api.HTTPOptions{
+		Timeout:        cfg.HTTPTimeout,
+		ClientCertFile: cfg.ClientCert,
+		ClientKeyFile:  cfg.ClientKey,
+	}
+	if cfg.CACert != "" {
+		opts.CACertFiles = append(opts.CACertFiles, cfg.CACert)
+	}
+
+	httpClient, err := api.NewHTTPClient(opts)
+	if err != nil {
+		return nil, err
 	}
-	executor := cmdpkg.NewSnykExecutor("")
-	return executor.Execute(snykArgs)
+
+	// Record the traffic of every client, including the token refresher
+	if httpTrace != nil {
+		httpClient.Transport = httpTrace.Transport(httpClient.Transport)
+	}
+
+	return httpClient, nil
+}
+
+// newTokenProvider returns the OAuth client of the configured service account,
+// if any, else the token providers for the configured token storage
+func newTokenProvider(cfg *config.Config) (api.NamedTokenProvider, error) {
+	clientID, clientSecret, err := api.ClientCredentialsFromEnv(cfg.OAuthClientID, cfg.OAuthClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if clientID != "" {
+		return newClientCredentialsTokenProvider(cfg, clientID, clientSecret)
+	}
+
+	if cfg.TokenStorage != config.TokenStorageEncrypted {
+		return api.NewDefaultTokenProvider(), nil
+	}
+
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	return api.NewEncryptedTokenProvider(dir, newSecretBackend(cfg)), nil
+}
+
+// newClientCredentialsTokenProvider returns the token provider of the OAuth
+// client of a service account. Its access tokens are kept in an encrypted file
+// of the client and Snyk instance, so that later runs reuse them until they expire.
+func newClientCredentialsTokenProvider(cfg *config.Config, clientID string, clientSecret string) (api.NamedTokenProvider, error) {
+	endpoint, err := api.NewEndpoint(cfg.APIURL)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	cache := api.NewEncryptedFileTokenProvider(dir, newSecretBackend(cfg))
+	cache.Path = filepath.Join(dir, "client-token-"+hashOf(endpoint.API, clientID)[:16]+".enc")
+
+	refresher := api.NewOAuth2TokenRefresher(endpoint.OAuthBaseURL, httpClient)
+	return api.NewClientCredentialsTokenProvider(clientID, clientSecret, refresher, cache), nil
+}
+
+// usesClientCredentials reports whether the OAuth client of a service account
+// is configured
+func usesClientCredentials(cfg *config.Config) bool {
+	clientID, _, err := api.ClientCredentialsFromEnv(cfg.OAuthClientID, cfg.OAuthClientSecret)
+	return err == nil && clientID != ""
+}
+
+// newSecretBackend returns the configured backend for the key of the
+// encrypted token file, or nil for the file next to it
+func newSecretBackend(cfg *config.Config) api.SecretBackend {
+	if cfg.SecretBackend == config.SecretBackendFile {
+		return nil
+	}
+	return api.NewKeyringSecretBackend()
+}
+
+// runSnyk runs a Snyk command with the organization, or without one if orgID
+// is empty. The Snyk CLI can't find an OAuth token kept outside its config or
+// issued to a service account's OAuth client, so the token is passed to it in
+// the environment.
+func runSnyk(ctx context.Context, cfg *config.Config, orgID string, args []string) error {
+	executor := cmdpkg.NewSnykExecutor(orgID)
+	if cfg.TokenStorage == config.TokenStorageEncrypted || usesClientCredentials(cfg) {
+		env, err := tokenEnv(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to get Snyk token: %w", err)
+		}
+		executor.Env = env
+	}
+
+	return executor.Execute(ctx, args)
+}
+
+// tokenEnv returns the environment variable passing the current token to the
+// Snyk CLI, refreshing the token first if it is about to expire
+func tokenEnv(ctx context.Context, cfg *config.Config) ([]string, error) {
+	endpoint, err := api.NewEndpoint(cfg.APIURL)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := newTokenProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := api.GetSnykToken(ctx, provider, api.NewOAuth2TokenRefresher(endpoint.OAuthBaseURL, httpClient))
+	if err != nil {
+		return nil, err
+	}
+
+	if token.AuthScheme() == api.AuthSchemeToken {
+		return []string{"SNYK_TOKEN=" + token.AccessToken}, nil
+	}
+	return []string{"SNYK_OAUTH_TOKEN=" + token.AccessToken}, nil
+}
+
+// migrateToken moves the OAuth token from the Snyk CLI config into the
+// encrypted token file and switches the configuration to use it
+func migrateToken(ctx context.Context, cfg *config.Config) error {
+	store, err := api.NewConfigStore()
+	if err != nil {
+		return err
+	}
+
+	dir, err := config.Dir()
+	if err != nil {
+		return err
+	}
+
+	source := &api.ConfigStoreTokenProvider{Store: store}
+	target := api.NewEncryptedFileTokenProvider(dir, newSecretBackend(cfg))
+	if err := source.MigrateToken(ctx, target); err != nil {
+		if errors.Is(err, api.ErrNoToken) {
+			return fmt.Errorf("no OAuth token in %s, run `snyk auth` first", store.Path)
+		}
+		return err
+	}
+
+	// Reload the configuration so values overridden by flags aren't saved
+	saved, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	saved.TokenStorage = config.TokenStorageEncrypted
+	saved.SecretBackend = cfg.SecretBackend
+	if err := config.SaveConfig(saved); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	cfg.TokenStorage = saved.TokenStorage
+
+	fmt.Printf("Moved the Snyk OAuth token from %s to %s\n", store.Path, target.Path)
+	return nil
 }
 
 // getOrganizations retrieves organizations from the cache or the Snyk API
-func getOrganizations(db *cache.SQLiteCache, cfg *config.Config) ([]api.Organization, error) {
+func getOrganizations(ctx context.Context, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) ([]api.Organization, error) {
 	// Check if the cache is expired
-	expired, err := db.IsExpired(cfg.CacheTTL)
+	expired, err := db.IsExpired(ctx, cfg.CacheTTL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check cache expiration: %w", err)
 	}
 
 	// If the cache is valid, use it
 	if !expired {
-		orgs, err := db.GetOrganizations()
+		orgs, err := db.GetOrganizations(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get organizations from cache: %w", err)
 		}
@@ -301,170 +638,320 @@ func getOrganizations(db *cache.SQLiteCache, cfg *config.Config) ([]api.Organiza
 	}
 
 	// Cache is expired or empty, fetch organizations from the API
-	client, err := api.NewSnykClient()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Snyk client: %w", err)
-	}
-
-	orgs, err := client.GetOrganizations()
+	orgs, err := client.GetOrganizations(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get organizations from API: %w", err)
 	}
 
 	// Store the organizations in the cache
-	if err := db.StoreOrganizations(orgs); err != nil {
+	if err := db.StoreOrganizations(ctx, orgs); err != nil {
 		return nil, fmt.Errorf("failed to store organizations in cache: %w", err)
 	}
 
+	// Refresh the groups along with the organizations. Groups are only used to
+	// scope and present organizations, so a failure here isn't fatal.
+	groups, err := client.GetGroups(ctx)
+	if err == nil {
+		err = db.StoreGroups(ctx, groups)
+	}
+	if err != nil {
+		slog.Info("Failed to refresh Snyk groups", "error", err)
+	}
+
+	// Return the organizations in the cache's order, so that ties between
+	// them are broken the same way whether or not they were just fetched
+	orgs, err = db.GetOrganizations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organizations from cache: %w", err)
+	}
 	return orgs, nil
 }
 
-// findOrgByGitURL attempts to find an organization by Git URL
-func findOrgByGitURL(gitURL string, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) (string, error) {
-	// Check if we have cached targets with this URL (cache already handles both HTTP/HTTPS variants)
-	cachedOrgTargets, err := db.GetTargetsByURL(gitURL)
-	if err == nil && len(cachedOrgTargets) > 0 {
-		// Found a match in cache
-		if cfg.Verbose {
-			fmt.Printf("Found cached target for URL %s in organization %s\n", gitURL, cachedOrgTargets[0].OrgName)
+// findOrgByGitURL attempts to find an organization by Git URL. Organizations
+// whose target for the repository has active projects are preferred, and if a
+// manifest file is given, the one with an active project for that file. For
+// commands creating projects, organizations where the user's role can create
+// them are preferred over all others.
+func findOrgByGitURL(ctx context.Context, gitURL string, manifest string, monitor bool, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) (string, error) {
+	maxScore := maxMatchScore(manifest)
+	roleScore := func(score int, role string) int {
+		return score
+	}
+	if monitor {
+		// Only organizations where the user's role can create projects score best
+		maxScore = monitorMatchScore(maxScore, "", nil)
+		roleScore = func(score int, role string) int {
+			return monitorMatchScore(score, role, cfg.ReadOnlyRoles)
 		}
-		return cachedOrgTargets[0].OrgID, nil
 	}
 
-	// Get all organizations
-	organizations, err := getOrganizations(db, cfg)
+	// Get the organizations we may choose from
+	organizations, err := getCandidateOrganizations(ctx, db, cfg, client)
 	if err != nil {
 		return "", fmt.Errorf("failed to get organizations: %w", err)
 	}
 
-	// Create both HTTP and HTTPS variants of the URL
-	httpVariant := gitURL
-	httpsVariant := gitURL
-
-	// Make sure we have both variants of the URL
-	if strings.HasPrefix(gitURL, "https://") {
-		httpVariant = "http://" + strings.TrimPrefix(gitURL, "https://")
-	} else if strings.HasPrefix(gitURL, "http://") {
-		httpsVariant = "https://" + strings.TrimPrefix(gitURL, "http://")
-	} else {
-		// If no protocol provided, default to both http:// and https:// prefixes
-		httpVariant = "http://" + gitURL
-		httpsVariant = "https://" + gitURL
+	// Check if we have cached targets with this URL (cache already handles both HTTP/HTTPS variants)
+	cachedTargets := make(map[string]string) // Target IDs by organization ID
+	cachedOrgTargets, err := db.GetTargetsByURL(ctx, gitURL)
+	if err == nil {
+		for _, orgTarget := range cachedOrgTargets {
+			if _, ok := cachedTargets[orgTarget.OrgID]; !ok {
+				cachedTargets[orgTarget.OrgID] = orgTarget.TargetID
+			}
+		}
 	}
 
-	// Check each organization for a matching target
-	for _, org := range organizations {
-		// Use our getTargets function which handles cache and API calls
-		targets, err := getTargets(org.ID, db, cfg, client)
-		if err != nil {
-			// Skip this org on error but log if verbose
-			if cfg.Verbose {
-				fmt.Printf("Warning: failed to get targets for organization %s: %v\n", org.Name, err)
-			}
+	// Score the cached matches like scoreOrganizations does, preferring the
+	// earliest candidate on a tie, and settle for the best one only if nothing
+	// could beat it
+	cachedScores := make(map[string]int) // Scores by organization ID
+	best, bestScore := -1, scoreNoMatch
+	for i, org := range organizations {
+		targetID, ok := cachedTargets[org.ID]
+		if !ok {
 			continue
 		}
+		score := roleScore(scoreOrgTarget(ctx, org.ID, targetID, manifest, db, cfg, client), org.Role)
+		cachedScores[org.ID] = score
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best >= 0 && bestScore >= maxScore {
+		slog.Info("Found cached target for URL", "git_url", gitURL, "org", organizations[best].Name)
+		return organizations[best].ID, nil
+	}
+
+	// Check the organizations for a matching target, several at a time
+	rateOrg := func(ctx context.Context, org api.Organization) (int, error) {
+		if score, ok := cachedScores[org.ID]; ok {
+			return score, nil
+		}
 
-		// Check each target for a URL match
-		for _, target := range targets {
-			if target.Attributes.URL == httpVariant || target.Attributes.URL == httpsVariant {
-				if cfg.Verbose {
-					fmt.Printf("Found target for URL %s in organization %s\n", gitURL, org.Name)
-				}
-				return org.ID, nil
-			}
+		target, err := findTarget(ctx, org.ID, gitURL, db, cfg, client)
+		if err != nil || target == nil {
+			return scoreNoMatch, err
+		}
+
+		return roleScore(scoreOrgTarget(ctx, org.ID, target.ID, manifest, db, cfg, client), org.Role), nil
+	}
+
+	// Skip orgs on error but log if verbose
+	warn := func(org api.Organization, err error) {
+		slog.Info("Failed to get targets for organization", "org", org.Name, "error", err)
+	}
+
+	index, err := scoreOrganizations(ctx, organizations, cfg.Concurrency, maxScore, rateOrg, warn)
+	if err != nil {
+		return "", err
+	}
+
+	if index >= 0 {
+		org := organizations[index]
+		slog.Info("Found target for URL", "git_url", gitURL, "org", org.Name)
+		if monitor {
+			warnIfReadOnly(&org, cfg)
 		}
+		return org.ID, nil
 	}
 
 	// If we get here, we haven't found a matching target in any organization
 	return "", fmt.Errorf("no organization found with a target matching URL: %s", gitURL)
 }
 
+// findTarget returns an organization's target matching the Git URL, or nil if
+// it has none
+func findTarget(ctx context.Context, orgID string, gitURL string, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) (*api.Target, error) {
+	// Unless full lookups were requested, only ask the API for the targets
+	// matching the URL when we don't have the organization's targets cached
+	if cfg.TargetLookup != config.TargetLookupFull {
+		expired, err := db.IsTargetsCacheExpired(ctx, orgID, cfg.CacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check targets cache expiration: %w", err)
+		}
+		if expired {
+			return probeTargets(ctx, orgID, gitURL, db, cfg, client)
+		}
+	}
+
+	// Use our getTargets function which handles cache and API calls
+	targets, err := getTargets(ctx, orgID, db, cfg, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check each target for a URL match against both HTTP and HTTPS variants
+	variants := api.URLVariants(gitURL)
+	for i := range targets {
+		if api.MatchesURL(targets[i].Attributes.URL, variants) {
+			return &targets[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// probeTargets asks the Snyk API for an organization's target matching the Git
+// URL, caching the matching target and remembering that the organization was
+// asked until the cache TTL expires
+func probeTargets(ctx context.Context, orgID string, gitURL string, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) (*api.Target, error) {
+	expired, err := db.IsTargetsProbeExpired(ctx, orgID, gitURL, cfg.CacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check targets probe expiration: %w", err)
+	}
+
+	// A matching target found by an earlier lookup would already have been
+	// found in the cache, so a recent lookup means there is no match
+	if !expired {
+		return nil, nil
+	}
+
+	slog.Info("Looking up targets matching URL", "git_url", gitURL, "org_id", orgID)
+
+	target, err := client.FindTargetByURL(ctx, orgID, gitURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up targets from API: %w", err)
+	}
+
+	// Store the matching target in the cache
+	if target != nil {
+		if err := db.UpsertTargets(ctx, orgID, []api.Target{*target}); err != nil {
+			return nil, fmt.Errorf("failed to store targets in cache: %w", err)
+		}
+	}
+
+	if err := db.MarkTargetsProbed(ctx, orgID, gitURL); err != nil {
+		return nil, fmt.Errorf("failed to store targets probe in cache: %w", err)
+	}
+
+	return target, nil
+}
+
+// syncAllTargets downloads the complete list of targets of every organization into the cache
+func syncAllTargets(ctx context.Context, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) error {
+	organizations, err := getOrganizations(ctx, db, cfg, client)
+	if err != nil {
+		return fmt.Errorf("failed to get organizations: %w", err)
+	}
+
+	var synced, failed atomic.Int64
+	syncOrg := func(ctx context.Context, org api.Organization) (bool, error) {
+		slog.Info("Fetching all targets for organization", "org_id", org.ID)
+
+		targets, err := fetchTargets(ctx, org.ID, db, cfg, client)
+		if err != nil {
+			return false, err
+		}
+
+		synced.Add(int64(len(targets)))
+		return false, nil
+	}
+
+	warn := func(org api.Organization, err error) {
+		failed.Add(1)
+		slog.Warn("Failed to sync targets for organization", "org", org.Name, "error", err)
+	}
+
+	if _, err := scanOrganizations(ctx, organizations, cfg.Concurrency, syncOrg, warn); err != nil {
+		return err
+	}
+
+	slog.Info("Synced targets", "targets", synced.Load(), "organizations", len(organizations)-int(failed.Load()))
+
+	return nil
+}
+
 // getTargets retrieves targets for an organization, using cache if available
-func getTargets(orgID string, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) ([]api.Target, error) {
+func getTargets(ctx context.Context, orgID string, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) ([]api.Target, error) {
 	// Check if the targets cache for this org is expired
-	expired, err := db.IsTargetsCacheExpired(orgID, cfg.CacheTTL)
+	expired, err := db.IsTargetsCacheExpired(ctx, orgID, cfg.CacheTTL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check targets cache expiration: %w", err)
 	}
 
 	// If the cache is valid, use it
 	if !expired {
-		targets, err := db.GetTargetsByOrgID(orgID)
+		targets, err := db.GetTargetsByOrgID(ctx, orgID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get targets from cache: %w", err)
 		}
 		if len(targets) > 0 {
-			if cfg.Verbose {
-				fmt.Printf("Using cached targets for organization %s\n", orgID)
-			}
+			slog.Info("Using cached targets for organization", "org_id", orgID)
 			return targets, nil
 		}
 	}
 
 	// Cache is expired or empty, fetch all targets from the API
-	if cfg.Verbose {
-		fmt.Printf("Fetching all targets for organization %s\n", orgID)
-	}
+	slog.Info("Fetching all targets for organization", "org_id", orgID)
+
+	return fetchTargets(ctx, orgID, db, cfg, client)
+}
 
-	targets, err := client.GetTargets(orgID)
+// fetchTargets downloads all targets of an organization into the cache. When
+// the Snyk API reports they didn't change, the cached targets are only marked
+// as up to date.
+func fetchTargets(ctx context.Context, orgID string, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient) ([]api.Target, error) {
+	targets, modified, err := client.GetTargetsIfModified(ctx, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get targets from API: %w", err)
 	}
 
+	if !modified {
+		slog.Info("Targets for organization haven't changed", "org_id", orgID)
+		if err := db.TouchTargets(ctx, orgID); err != nil {
+			return nil, fmt.Errorf("failed to update targets in cache: %w", err)
+		}
+		return targets, nil
+	}
+
 	// Store the targets in the cache
-	if err := db.StoreTargets(orgID, targets); err != nil {
+	if err := db.StoreTargets(ctx, orgID, targets); err != nil {
 		return nil, fmt.Errorf("failed to store targets in cache: %w", err)
 	}
 
 	return targets, nil
 }
 
-// listAllTargets retrieves and displays all targets from all organizations in the cache
-func listAllTargets(db *cache.SQLiteCache, cfg *config.Config) error {
-	// First get all organizations to map IDs to names
-	organizations, err := getOrganizations(db, cfg)
+// listAllTargets retrieves and displays the targets passing the filter from
+// all organizations in the cache, most recently created first
+func listAllTargets(ctx context.Context, db *cache.SQLiteCache, cfg *config.Config, client *api.SnykClient, filter targetFilter) error {
+	// First get all organizations to list their targets
+	organizations, err := getOrganizations(ctx, db, cfg, client)
 	if err != nil {
 		return fmt.Errorf("failed to get organizations: %w", err)
 	}
 
-	// Create a map of org IDs to org names for quick lookup
-	orgMap := make(map[string]string)
-	for _, org := range organizations {
-		orgMap[org.ID] = org.Name
-	}
-
-	// Get all targets from all organizations
+	// Get the targets of each organization, keeping the organizations' order
+	var listed []api.Organization
 	allTargets := make(map[string][]api.Target)
 	for _, org := range organizations {
-		targets, err := db.GetTargetsByOrgID(org.ID)
+		targets, err := db.GetTargetsByOrgID(ctx, org.ID)
 		if err != nil {
-			fmt.Printf("Warning: could not get targets for organization %s: %v\n", org.Name, err)
+			slog.Warn("Could not get targets for organization", "org", org.Name, "error", err)
 			continue
 		}
-		allTargets[org.ID] = targets
+		listed = append(listed, org)
+		allTargets[org.ID] = filterTargets(targets, filter)
 	}
 
 	// Display the targets
-	if len(allTargets) == 0 {
+	if len(listed) == 0 {
 		fmt.Println("No targets found in the cache")
 		return nil
 	}
 
 	fmt.Println("Available Snyk targets by organization:")
-	for orgID, targets := range allTargets {
-		orgName := orgMap[orgID]
-		if orgName == "" {
-			orgName = orgID
-		}
+	for _, org := range listed {
+		fmt.Printf("\n%s (%s):\n", org.Name, org.ID)
 
-		fmt.Printf("\n%s (%s):\n", orgName, orgID)
+		targets := allTargets[org.ID]
 		if len(targets) == 0 {
 			fmt.Println("  No targets found")
 			continue
 		}
 
 		for _, target := range targets {
-			fmt.Printf("  - %s (%s)\n", target.Attributes.DisplayName, target.Attributes.URL)
+			fmt.Printf("  - %s\n", formatTarget(target))
 		}
 	}
 
@@ -2,31 +2,37 @@ package app_test
 
 import (
 	"bytes"
+	"context"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
 	"github.com/spf13/cobra"
+	"github.com/z4ce/snyk-auto-org/internal/api"
 	"github.com/z4ce/snyk-auto-org/internal/app"
 	"github.com/z4ce/snyk-auto-org/internal/cmd"
+	"github.com/z4ce/snyk-auto-org/internal/config"
+	"github.com/z4ce/snyk-auto-org/internal/simulator"
 )
 
 // Mock the exec.Command function
 var (
 	origExecCommand = cmd.ExecCommand
-	mockExecCommand func(command string, args ...string) *exec.Cmd
+	mockExecCommand func(ctx context.Context, command string, args ...string) *exec.Cmd
 )
 
 func init() {
-	cmd.ExecCommand = func(command string, args ...string) *exec.Cmd {
+	cmd.ExecCommand = func(ctx context.Context, command string, args ...string) *exec.Cmd {
 		if mockExecCommand != nil {
-			return mockExecCommand(command, args...)
+			return mockExecCommand(ctx, command, args...)
 		}
-		return origExecCommand(command, args...)
+		return origExecCommand(ctx, command, args...)
 	}
 }
 
@@ -169,3 +175,76 @@ func executeCommand(root *cobra.Command, args ...string) (string, error) {
 	err := root.Execute()
 	return strings.TrimSpace(buf.String()), err
 }
+
+var _ = Describe("TokenEnv", func() {
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		home := GinkgoT().TempDir()
+		GinkgoT().Setenv("HOME", home)
+		GinkgoT().Setenv("SNYK_TOKEN", "")
+		GinkgoT().Setenv("SNYK_OAUTH_TOKEN", "")
+		GinkgoT().Setenv(api.ClientIDEnvVar, "")
+		GinkgoT().Setenv(api.ClientSecretEnvVar, "")
+
+		// An empty Snyk config, so no API token is found there
+		configHome := GinkgoT().TempDir()
+		GinkgoT().Setenv("XDG_CONFIG_HOME", configHome)
+		Expect(os.MkdirAll(filepath.Join(configHome, "configstore"), 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(configHome, "configstore", "snyk.json"), []byte("{}"), 0600)).To(Succeed())
+	})
+
+	It("passes the OAuth token from the encrypted file to the Snyk CLI", func() {
+		dir, err := config.Dir()
+		Expect(err).NotTo(HaveOccurred())
+		provider := api.NewEncryptedFileTokenProvider(dir, nil)
+		Expect(provider.SaveToken(ctx, &api.TokenStorage{
+			AccessToken:  "oauth-token",
+			TokenType:    "bearer",
+			RefreshToken: "refresh-token",
+			Expiry:       time.Now().Add(time.Hour),
+		})).To(Succeed())
+
+		cfg := &config.Config{TokenStorage: config.TokenStorageEncrypted, SecretBackend: config.SecretBackendFile}
+		env, err := app.TokenEnv(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(Equal([]string{"SNYK_OAUTH_TOKEN=oauth-token"}))
+	})
+
+	It("passes the access token of the service account's OAuth client to the Snyk CLI", func() {
+		fixture, err := simulator.LoadFixture(filepath.Join("..", "simulator", "testdata", "fixture.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		server := httptest.NewServer(simulator.New(fixture))
+		DeferCleanup(server.Close)
+
+		GinkgoT().Setenv(api.ClientIDEnvVar, "ci-client")
+		GinkgoT().Setenv(api.ClientSecretEnvVar, "ci-secret")
+
+		cfg := &config.Config{APIURL: server.URL, TokenStorage: config.TokenStorageSnyk, SecretBackend: config.SecretBackendFile}
+		env, err := app.TokenEnv(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(Equal([]string{"SNYK_OAUTH_TOKEN=simulated-access-token-1"}))
+
+		// The cached access token is reused
+		env, err = app.TokenEnv(ctx, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(Equal([]string{"SNYK_OAUTH_TOKEN=simulated-access-token-1"}))
+	})
+})
+
+var _ = Describe("RestVersions", func() {
+	remembered := map[string]string{"orgs": "2024-06-21", "targets": "2024-01-23"}
+
+	It("uses the negotiated versions unless configured otherwise", func() {
+		cfg := &config.Config{RestVersions: map[string]string{"targets": "2024-10-15~beta"}}
+		Expect(app.RestVersions(cfg, remembered)).To(Equal(map[string]string{
+			"orgs":    "2024-06-21",
+			"targets": "2024-10-15~beta",
+		}))
+	})
+
+	It("ignores the negotiated versions when a version is set for every resource", func() {
+		cfg := &config.Config{RestVersion: "2024-10-15"}
+		Expect(app.RestVersions(cfg, remembered)).To(BeEmpty())
+	})
+})
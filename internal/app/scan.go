@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+// orgCheckFunc reports whether an organization matches what we're looking for
+type orgCheckFunc func(ctx context.Context, org api.Organization) (bool, error)
+
+// orgScoreFunc rates how well an organization matches what we're looking for,
+// where 0 means it doesn't match at all
+type orgScoreFunc func(ctx context.Context, org api.Organization) (int, error)
+
+// scanOrganizations runs check for each organization using at most concurrency
+// workers and returns the index of the first organization, in list order, that
+// matched, or -1 if none did. As soon as an organization matches, the workers
+// still busy with organizations later in the list are cancelled, while earlier
+// ones are allowed to finish so the result doesn't depend on timing. Errors for
+// individual organizations are passed to onError and don't stop the scan.
+func scanOrganizations(ctx context.Context, orgs []api.Organization, concurrency int, check orgCheckFunc, onError func(api.Organization, error)) (int, error) {
+	score := func(ctx context.Context, org api.Organization) (int, error) {
+		matched, err := check(ctx, org)
+		if matched {
+			return 1, err
+		}
+		return 0, err
+	}
+
+	return scoreOrganizations(ctx, orgs, concurrency, 1, score, onError)
+}
+
+// scoreOrganizations works like scanOrganizations, but returns the index of the
+// organization with the highest score, preferring the earliest one on a tie.
+// Only an organization reaching maxScore cancels the organizations after it,
+// since any other match may still be beaten by one of them.
+func scoreOrganizations(ctx context.Context, orgs []api.Organization, concurrency int, maxScore int, score orgScoreFunc, onError func(api.Organization, error)) (int, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	scanCtx, cancelScan := context.WithCancel(ctx)
+	defer cancelScan()
+
+	var (
+		mu        sync.Mutex
+		best      = -1        // Index of the best match so far
+		bestScore = 0         // Score of the best match so far
+		last      = len(orgs) // Organizations after this index can't beat the best match
+		cancels   = make([]context.CancelFunc, len(orgs))
+		wg        sync.WaitGroup
+	)
+
+	jobs := make(chan int)
+	for w := 0; w < concurrency && w < len(orgs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// Skip organizations that can no longer beat the current match
+				mu.Lock()
+				if i > last {
+					mu.Unlock()
+					continue
+				}
+				orgCtx, cancel := context.WithCancel(scanCtx)
+				cancels[i] = cancel
+				mu.Unlock()
+
+				s, err := score(orgCtx, orgs[i])
+				cancelled := orgCtx.Err() != nil
+				cancel()
+
+				mu.Lock()
+				if s > bestScore || (s > 0 && s == bestScore && i < best) {
+					best, bestScore = i, s
+				}
+				if s >= maxScore && i < last {
+					last = i
+					// Cancel the organizations later in the list that are still running
+					for j := i + 1; j < len(orgs); j++ {
+						if cancels[j] != nil {
+							cancels[j]()
+						}
+					}
+				}
+				mu.Unlock()
+
+				if err != nil && s == 0 && !cancelled && onError != nil {
+					onError(orgs[i], err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range orgs {
+		mu.Lock()
+		done := i > last
+		mu.Unlock()
+		if done {
+			break
+		}
+
+		select {
+		case jobs <- i:
+		case <-scanCtx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+
+	return best, nil
+}
@@ -0,0 +1,193 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/app"
+)
+
+var _ = Describe("ScanOrganizations", func() {
+	var orgs []api.Organization
+
+	BeforeEach(func() {
+		orgs = []api.Organization{
+			{ID: "org-id-1", Name: "Organization 1"},
+			{ID: "org-id-2", Name: "Organization 2"},
+			{ID: "org-id-3", Name: "Organization 3"},
+			{ID: "org-id-4", Name: "Organization 4"},
+			{ID: "org-id-5", Name: "Organization 5"},
+		}
+	})
+
+	It("returns -1 when no organization matches", func() {
+		index, err := app.ScanOrganizations(context.Background(), orgs, 3, func(ctx context.Context, org api.Organization) (bool, error) {
+			return false, nil
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(index).To(Equal(-1))
+	})
+
+	It("never runs more checks at once than the concurrency limit", func() {
+		var running, peak atomic.Int32
+		_, err := app.ScanOrganizations(context.Background(), orgs, 2, func(ctx context.Context, org api.Organization) (bool, error) {
+			now := running.Add(1)
+			defer running.Add(-1)
+			for {
+				old := peak.Load()
+				if now <= old || peak.CompareAndSwap(old, now) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return false, nil
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(peak.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("prefers the earliest matching organization regardless of timing", func() {
+		index, err := app.ScanOrganizations(context.Background(), orgs, 5, func(ctx context.Context, org api.Organization) (bool, error) {
+			switch org.ID {
+			case "org-id-2":
+				// The earlier match finishes last
+				time.Sleep(50 * time.Millisecond)
+				return true, nil
+			case "org-id-4":
+				return true, nil
+			}
+			return false, nil
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(index).To(Equal(1))
+	})
+
+	It("cancels the organizations after a match", func() {
+		var cancelled atomic.Bool
+		started := make(chan struct{}, len(orgs))
+		index, err := app.ScanOrganizations(context.Background(), orgs, 5, func(ctx context.Context, org api.Organization) (bool, error) {
+			if org.ID == "org-id-1" {
+				// Only match once a later organization is in flight
+				<-started
+				return true, nil
+			}
+			started <- struct{}{}
+			select {
+			case <-ctx.Done():
+				cancelled.Store(true)
+				return false, ctx.Err()
+			case <-time.After(5 * time.Second):
+				return false, nil
+			}
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(index).To(Equal(0))
+		Expect(cancelled.Load()).To(BeTrue())
+	})
+
+	It("reports errors and keeps scanning", func() {
+		var mu sync.Mutex
+		var failed []string
+		index, err := app.ScanOrganizations(context.Background(), orgs, 2, func(ctx context.Context, org api.Organization) (bool, error) {
+			switch org.ID {
+			case "org-id-1":
+				return false, errors.New("forbidden")
+			case "org-id-3":
+				return true, nil
+			}
+			return false, nil
+		}, func(org api.Organization, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, org.ID)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(index).To(Equal(2))
+		Expect(failed).To(ConsistOf("org-id-1"))
+	})
+
+	It("returns the context error when cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := app.ScanOrganizations(ctx, orgs, 2, func(ctx context.Context, org api.Organization) (bool, error) {
+			cancel()
+			<-ctx.Done()
+			return false, ctx.Err()
+		}, nil)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
+
+var _ = Describe("ScoreOrganizations", func() {
+	var orgs []api.Organization
+
+	BeforeEach(func() {
+		orgs = []api.Organization{
+			{ID: "org-id-1", Name: "Organization 1"},
+			{ID: "org-id-2", Name: "Organization 2"},
+			{ID: "org-id-3", Name: "Organization 3"},
+			{ID: "org-id-4", Name: "Organization 4"},
+		}
+	})
+
+	It("prefers a later organization with a higher score", func() {
+		index, err := app.ScoreOrganizations(context.Background(), orgs, 2, 2, func(ctx context.Context, org api.Organization) (int, error) {
+			switch org.ID {
+			case "org-id-1":
+				return 1, nil
+			case "org-id-3":
+				return 2, nil
+			}
+			return 0, nil
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(index).To(Equal(2))
+	})
+
+	It("prefers the earliest organization on a tie", func() {
+		index, err := app.ScoreOrganizations(context.Background(), orgs, 4, 2, func(ctx context.Context, org api.Organization) (int, error) {
+			if org.ID == "org-id-2" {
+				time.Sleep(50 * time.Millisecond)
+			}
+			if org.ID == "org-id-2" || org.ID == "org-id-4" {
+				return 1, nil
+			}
+			return 0, nil
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(index).To(Equal(1))
+	})
+
+	It("keeps scanning after a match below the maximum score", func() {
+		var checked atomic.Int32
+		index, err := app.ScoreOrganizations(context.Background(), orgs, 1, 2, func(ctx context.Context, org api.Organization) (int, error) {
+			checked.Add(1)
+			if org.ID == "org-id-1" {
+				return 1, nil
+			}
+			return 0, nil
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(index).To(Equal(0))
+		Expect(checked.Load()).To(BeEquivalentTo(4))
+	})
+
+	It("stops scanning after a match with the maximum score", func() {
+		var checked atomic.Int32
+		index, err := app.ScoreOrganizations(context.Background(), orgs, 1, 2, func(ctx context.Context, org api.Organization) (int, error) {
+			checked.Add(1)
+			if org.ID == "org-id-2" {
+				return 2, nil
+			}
+			return 0, nil
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(index).To(Equal(1))
+		Expect(checked.Load()).To(BeEquivalentTo(2))
+	})
+})
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/cobra"
+	"github.com/z4ce/snyk-auto-org/internal/simulator"
+)
+
+// simulateCmd serves a fake Snyk API for local development and demos
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Serve a simulated Snyk API from a YAML fixture",
+	Long: `Serve the organizations, groups, targets and projects of a YAML fixture
+through a simulated Snyk REST and OAuth API, to try snyk-auto-org without a
+real Snyk tenant. Point snyk-auto-org at it with SNYK_API or api_url.`,
+	Args: cobra.NoArgs,
+	// main prints the error
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dataFile, _ := cmd.Flags().GetString("data")
+		addr, _ := cmd.Flags().GetString("addr")
+
+		fixture, err := simulator.LoadFixture(dataFile)
+		if err != nil {
+			return err
+		}
+
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+
+		// Any token works unless the fixture lists the accepted ones
+		token := "simulated"
+		if len(fixture.Tokens) > 0 {
+			token = fixture.Tokens[0]
+		}
+
+		apiURL := "http://" + listener.Addr().String()
+		fmt.Fprintf(cmd.OutOrStdout(), "Serving the simulated Snyk API at %s, press Ctrl-C to stop\n", apiURL)
+		fmt.Fprintf(cmd.OutOrStdout(), "Try: SNYK_API=%s SNYK_TOKEN=%s snyk-auto-org --list-orgs\n", apiURL, token)
+
+		return simulator.New(fixture).Serve(cmd.Context(), listener)
+	},
+}
+
+func init() {
+	simulateCmd.Flags().String("data", "", "YAML fixture with the organizations, groups, targets and projects to serve")
+	simulateCmd.Flags().String("addr", "127.0.0.1:8080", "Address to listen on")
+	simulateCmd.MarkFlagRequired("data")
+
+	rootCmd.AddCommand(simulateCmd)
+}
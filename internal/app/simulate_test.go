@@ -0,0 +1,35 @@
+package app_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/app"
+)
+
+var _ = Describe("Simulate", func() {
+	var origArgs []string
+
+	BeforeEach(func() {
+		origArgs = os.Args
+	})
+
+	AfterEach(func() {
+		os.Args = origArgs
+	})
+
+	It("fails without a readable fixture", func() {
+		os.Args = []string{"snyk-auto-org", "simulate", "--data", filepath.Join(GinkgoT().TempDir(), "missing.yaml")}
+		Expect(app.Execute()).To(MatchError(ContainSubstring("failed to read fixture")))
+	})
+
+	It("fails on an invalid fixture", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "fixture.yaml")
+		Expect(os.WriteFile(file, []byte("faults:\n  - status: 200\n"), 0600)).To(Succeed())
+
+		os.Args = []string{"snyk-auto-org", "simulate", "--data", file}
+		Expect(app.Execute()).To(MatchError(ContainSubstring("invalid fault status")))
+	})
+})
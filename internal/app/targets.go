@@ -0,0 +1,86 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/z4ce/snyk-auto-org/internal/api"
+)
+
+// Target visibilities accepted by --target-visibility
+const (
+	visibilityPrivate = "private"
+	visibilityPublic  = "public"
+)
+
+// targetFilter selects the targets listed by --list-targets
+type targetFilter struct {
+	// Integration is the integration type targets must have, such as github
+	Integration string
+	// Visibility is private or public, or empty for both
+	Visibility string
+}
+
+// newTargetFilter creates a targetFilter, validating the visibility
+func newTargetFilter(integration string, visibility string) (targetFilter, error) {
+	visibility = strings.ToLower(visibility)
+	if visibility != "" && visibility != visibilityPrivate && visibility != visibilityPublic {
+		return targetFilter{}, fmt.Errorf("invalid target visibility: %s (must be %q or %q)", visibility, visibilityPrivate, visibilityPublic)
+	}
+
+	return targetFilter{Integration: integration, Visibility: visibility}, nil
+}
+
+// matches reports whether the target passes the filter
+func (f targetFilter) matches(target api.Target) bool {
+	if f.Integration != "" && !strings.EqualFold(target.IntegrationType(), f.Integration) {
+		return false
+	}
+
+	switch f.Visibility {
+	case visibilityPrivate:
+		return target.Attributes.IsPrivate
+	case visibilityPublic:
+		return !target.Attributes.IsPrivate
+	}
+	return true
+}
+
+// filterTargets returns the targets passing the filter, most recently created
+// first. Targets without a creation time come last, in their original order.
+func filterTargets(targets []api.Target, filter targetFilter) []api.Target {
+	var filtered []api.Target
+	for _, target := range targets {
+		if filter.matches(target) {
+			filtered = append(filtered, target)
+		}
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].Attributes.CreatedAt.After(filtered[j].Attributes.CreatedAt)
+	})
+
+	return filtered
+}
+
+// formatTarget describes a target on one line with its integration,
+// visibility and creation date, as far as they are known
+func formatTarget(target api.Target) string {
+	var details []string
+	if integration := target.IntegrationType(); integration != "" {
+		details = append(details, integration)
+	}
+	if target.Attributes.IsPrivate {
+		details = append(details, visibilityPrivate)
+	}
+	if !target.Attributes.CreatedAt.IsZero() {
+		details = append(details, "created "+target.Attributes.CreatedAt.Format("2006-01-02"))
+	}
+
+	line := fmt.Sprintf("%s (%s)", target.Attributes.DisplayName, target.Attributes.URL)
+	if len(details) > 0 {
+		line += " [" + strings.Join(details, ", ") + "]"
+	}
+	return line
+}
@@ -0,0 +1,67 @@
+package app_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/app"
+)
+
+// newTarget creates a target with the given attributes
+func newTarget(id string, integration string, private bool, createdAt time.Time) api.Target {
+	target := api.Target{ID: id}
+	target.Attributes.DisplayName = "org/" + id
+	target.Attributes.URL = "https://github.com/org/" + id
+	target.Attributes.IsPrivate = private
+	target.Attributes.CreatedAt = createdAt
+	target.Relationships.Integration.Data.Attributes.IntegrationType = integration
+	return target
+}
+
+var _ = Describe("Targets", func() {
+	var targets []api.Target
+
+	BeforeEach(func() {
+		targets = []api.Target{
+			newTarget("old", "github", false, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)),
+			newTarget("undated", "cli", false, time.Time{}),
+			newTarget("new", "github-enterprise", true, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)),
+		}
+	})
+
+	ids := func(targets []api.Target) []string {
+		var ids []string
+		for _, target := range targets {
+			ids = append(ids, target.ID)
+		}
+		return ids
+	}
+
+	It("lists the most recently created targets first", func() {
+		filter, err := app.NewTargetFilter("", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(app.FilterTargets(targets, filter))).To(Equal([]string{"new", "old", "undated"}))
+	})
+
+	It("filters by integration type", func() {
+		filter, err := app.NewTargetFilter("GitHub", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(app.FilterTargets(targets, filter))).To(Equal([]string{"old"}))
+	})
+
+	It("filters by visibility", func() {
+		filter, err := app.NewTargetFilter("", "public")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(app.FilterTargets(targets, filter))).To(Equal([]string{"old", "undated"}))
+
+		_, err = app.NewTargetFilter("", "internal")
+		Expect(err).To(MatchError(ContainSubstring("invalid target visibility")))
+	})
+
+	It("shows the known target attributes", func() {
+		Expect(app.FormatTarget(targets[2])).To(Equal("org/new (https://github.com/org/new) [github-enterprise, private, created 2024-06-01]"))
+		Expect(app.FormatTarget(targets[1])).To(Equal("org/undated (https://github.com/org/undated) [cli]"))
+	})
+})
@@ -1,10 +1,15 @@
 package cache
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -14,6 +19,15 @@ import (
 const (
 	createOrgsTableSQL = `
 CREATE TABLE IF NOT EXISTS organizations (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	slug TEXT NOT NULL,
+	group_id TEXT NOT NULL DEFAULT '',
+	role TEXT NOT NULL DEFAULT ''
+);`
+
+	createGroupsTableSQL = `
+CREATE TABLE IF NOT EXISTS groups (
 	id TEXT PRIMARY KEY,
 	name TEXT NOT NULL,
 	slug TEXT NOT NULL
@@ -31,11 +45,43 @@ CREATE TABLE IF NOT EXISTS targets (
 	org_id TEXT NOT NULL,
 	display_name TEXT NOT NULL,
 	url TEXT NOT NULL,
+	integration_type TEXT NOT NULL DEFAULT '',
+	integration_id TEXT NOT NULL DEFAULT '',
+	is_private INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL DEFAULT '',
+	raw TEXT NOT NULL DEFAULT '',
 	FOREIGN KEY (org_id) REFERENCES organizations(id)
 );`
 
+	createProjectsTableSQL = `
+CREATE TABLE IF NOT EXISTS projects (
+	id TEXT PRIMARY KEY,
+	org_id TEXT NOT NULL,
+	target_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	status TEXT NOT NULL,
+	origin TEXT NOT NULL,
+	target_file TEXT NOT NULL,
+	target_reference TEXT NOT NULL,
+	FOREIGN KEY (org_id) REFERENCES organizations(id),
+	FOREIGN KEY (target_id) REFERENCES targets(id)
+);`
+
+	createResponsesTableSQL = `
+CREATE TABLE IF NOT EXISTS http_responses (
+	url TEXT PRIMARY KEY,
+	etag TEXT NOT NULL,
+	last_modified TEXT NOT NULL,
+	body BLOB NOT NULL
+);`
+
 	insertOrgSQL = `
-INSERT OR REPLACE INTO organizations (id, name, slug)
+INSERT OR REPLACE INTO organizations (id, name, slug, group_id, role)
+VALUES (?, ?, ?, ?, ?);`
+
+	insertGroupSQL = `
+INSERT OR REPLACE INTO groups (id, name, slug)
 VALUES (?, ?, ?);`
 
 	insertMetadataSQL = `
@@ -43,12 +89,30 @@ INSERT OR REPLACE INTO metadata (key, value)
 VALUES (?, ?);`
 
 	insertTargetSQL = `
-INSERT OR REPLACE INTO targets (id, org_id, display_name, url)
+INSERT OR REPLACE INTO targets (id, org_id, display_name, url, integration_type, integration_id, is_private, created_at, raw)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+	insertProjectSQL = `
+INSERT OR REPLACE INTO projects (id, org_id, target_id, name, type, status, origin, target_file, target_reference)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+	insertResponseSQL = `
+INSERT OR REPLACE INTO http_responses (url, etag, last_modified, body)
 VALUES (?, ?, ?, ?);`
 
+	deleteTargetProjectsSQL = `
+DELETE FROM projects
+WHERE org_id = ? AND target_id = ?;`
+
 	selectOrgsSQL = `
+SELECT id, name, slug, group_id, role
+FROM organizations
+ORDER BY name, id;`
+
+	selectGroupsSQL = `
 SELECT id, name, slug
-FROM organizations;`
+FROM groups
+ORDER BY name;`
 
 	selectMetadataSQL = `
 SELECT value
@@ -56,28 +120,52 @@ FROM metadata
 WHERE key = ?;`
 
 	selectTargetsSQL = `
-SELECT id, org_id, display_name, url
+SELECT ` + targetColumns + `
 FROM targets;`
 
 	selectTargetsByOrgIDSQL = `
-SELECT id, org_id, display_name, url
+SELECT ` + targetColumns + `
 FROM targets
 WHERE org_id = ?;`
 
 	selectTargetsByURLSQL = `
-SELECT t.id, t.org_id, t.display_name, t.url, o.name as org_name
+SELECT t.id, t.org_id, t.display_name, t.url, o.name as org_name, o.group_id, o.role
 FROM targets t
 JOIN organizations o ON t.org_id = o.id
-WHERE LOWER(t.url) = LOWER(?) OR LOWER(t.url) = LOWER(?);`
+WHERE LOWER(t.url) = LOWER(?) OR LOWER(t.url) = LOWER(?)
+ORDER BY o.name, o.id, t.id;`
+
+	selectResponseSQL = `
+SELECT etag, last_modified, body
+FROM http_responses
+WHERE url = ?;`
+
+	selectProjectsByTargetSQL = `
+SELECT id, org_id, target_id, name, type, status, origin, target_file, target_reference
+FROM projects
+WHERE org_id = ? AND target_id = ?
+ORDER BY name;`
 )
 
+// targetColumns are the columns of the targets table read by scanTarget
+const targetColumns = "id, display_name, url, integration_type, integration_id, is_private, created_at, raw"
+
 // SQLiteCache implements caching of Snyk organizations using SQLite
 type SQLiteCache struct {
-	db *sqlx.DB
+	db     *sqlx.DB
+	hits   atomic.Int64
+	misses atomic.Int64
 }
 
-// NewSQLiteCache creates a new SQLite cache
+// NewSQLiteCache creates a new SQLite cache for the default Snyk instance
 func NewSQLiteCache() (*SQLiteCache, error) {
+	return NewSQLiteCacheForEndpoint(api.DefaultSnykEndpoint)
+}
+
+// NewSQLiteCacheForEndpoint creates a new SQLite cache for the Snyk instance
+// with the given API URL. Each instance has its own database, so switching
+// regions never returns another region's organizations.
+func NewSQLiteCacheForEndpoint(apiURL string) (*SQLiteCache, error) {
 	// Get user's home directory
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -90,13 +178,18 @@ func NewSQLiteCache() (*SQLiteCache, error) {
 		return nil, fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
-	// Connect to the SQLite database
-	dbPath := filepath.Join(cacheDir, "cache.db")
-	db, err := sqlx.Connect("sqlite3", dbPath)
+	// Connect to the SQLite database, waiting for locks held by other
+	// snyk-auto-org processes rather than failing right away
+	dbPath := filepath.Join(cacheDir, cacheFileName(apiURL))
+	db, err := sqlx.Connect("sqlite3", dbPath+"?_busy_timeout=5000")
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to SQLite database: %w", err)
 	}
 
+	// SQLite allows a single writer at a time, so funnel every goroutine
+	// through one connection instead of failing with "database is locked"
+	db.SetMaxOpenConns(1)
+
 	// Create the tables if they don't exist
 	if _, err := db.Exec(createOrgsTableSQL); err != nil {
 		return nil, fmt.Errorf("failed to create organizations table: %w", err)
@@ -110,6 +203,36 @@ func NewSQLiteCache() (*SQLiteCache, error) {
 		return nil, fmt.Errorf("failed to create targets table: %w", err)
 	}
 
+	if _, err := db.Exec(createGroupsTableSQL); err != nil {
+		return nil, fmt.Errorf("failed to create groups table: %w", err)
+	}
+
+	if _, err := db.Exec(createProjectsTableSQL); err != nil {
+		return nil, fmt.Errorf("failed to create projects table: %w", err)
+	}
+
+	if _, err := db.Exec(createResponsesTableSQL); err != nil {
+		return nil, fmt.Errorf("failed to create HTTP responses table: %w", err)
+	}
+
+	// Add the columns introduced after the tables were first created
+	for _, column := range []string{"group_id", "role"} {
+		if err := addColumnIfMissing(db, "organizations", column, "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return nil, err
+		}
+	}
+	for _, column := range []struct{ name, definition string }{
+		{"integration_type", "TEXT NOT NULL DEFAULT ''"},
+		{"integration_id", "TEXT NOT NULL DEFAULT ''"},
+		{"is_private", "INTEGER NOT NULL DEFAULT 0"},
+		{"created_at", "TEXT NOT NULL DEFAULT ''"},
+		{"raw", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := addColumnIfMissing(db, "targets", column.name, column.definition); err != nil {
+			return nil, err
+		}
+	}
+
 	return &SQLiteCache{
 		db: db,
 	}, nil
@@ -121,9 +244,9 @@ func (c *SQLiteCache) Close() error {
 }
 
 // StoreOrganizations stores the organizations in the cache
-func (c *SQLiteCache) StoreOrganizations(orgs []api.Organization) error {
-	// Begin a transaction
-	tx, err := c.db.Beginx()
+func (c *SQLiteCache) StoreOrganizations(ctx context.Context, orgs []api.Organization) error {
+	// Begin a transaction, which is rolled back if the context is cancelled
+	tx, err := c.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -131,13 +254,13 @@ func (c *SQLiteCache) StoreOrganizations(orgs []api.Organization) error {
 
 	// Insert each organization
 	for _, org := range orgs {
-		if _, err := tx.Exec(insertOrgSQL, org.ID, org.Name, org.Slug); err != nil {
+		if _, err := tx.ExecContext(ctx, insertOrgSQL, org.ID, org.Name, org.Slug, org.GroupID, org.Role); err != nil {
 			return fmt.Errorf("failed to insert organization: %w", err)
 		}
 	}
 
 	// Store the update timestamp
-	if _, err := tx.Exec(insertMetadataSQL, "last_update", time.Now().Format(time.RFC3339)); err != nil {
+	if _, err := tx.ExecContext(ctx, insertMetadataSQL, "last_update", time.Now().Format(time.RFC3339)); err != nil {
 		return fmt.Errorf("failed to update timestamp: %w", err)
 	}
 
@@ -149,24 +272,71 @@ func (c *SQLiteCache) StoreOrganizations(orgs []api.Organization) error {
 	return nil
 }
 
-// GetOrganizations retrieves the organizations from the cache
-func (c *SQLiteCache) GetOrganizations() ([]api.Organization, error) {
+// GetOrganizations retrieves the organizations from the cache, ordered by
+// name
+func (c *SQLiteCache) GetOrganizations(ctx context.Context) ([]api.Organization, error) {
 	var orgs []api.Organization
-	if err := c.db.Select(&orgs, selectOrgsSQL); err != nil {
+	if err := c.db.SelectContext(ctx, &orgs, selectOrgsSQL); err != nil {
 		return nil, fmt.Errorf("failed to select organizations: %w", err)
 	}
 
 	return orgs, nil
 }
 
-// StoreTargets stores targets for an organization in the cache
-func (c *SQLiteCache) StoreTargets(orgID string, targets []api.Target) error {
+// StoreGroups stores the groups in the cache
+func (c *SQLiteCache) StoreGroups(ctx context.Context, groups []api.Group) error {
+	// Begin a transaction, which is rolled back if the context is cancelled
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Insert each group
+	for _, group := range groups {
+		if _, err := tx.ExecContext(ctx, insertGroupSQL, group.ID, group.Name, group.Slug); err != nil {
+			return fmt.Errorf("failed to insert group: %w", err)
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetGroups retrieves the groups from the cache, ordered by name
+func (c *SQLiteCache) GetGroups(ctx context.Context) ([]api.Group, error) {
+	var groups []api.Group
+	if err := c.db.SelectContext(ctx, &groups, selectGroupsSQL); err != nil {
+		return nil, fmt.Errorf("failed to select groups: %w", err)
+	}
+
+	return groups, nil
+}
+
+// StoreTargets stores the complete list of targets for an organization in the
+// cache and marks the organization's targets as up to date
+func (c *SQLiteCache) StoreTargets(ctx context.Context, orgID string, targets []api.Target) error {
+	return c.storeTargets(ctx, orgID, targets, true)
+}
+
+// UpsertTargets stores some of the targets of an organization in the cache,
+// such as the results of a filtered lookup, without marking the organization's
+// targets as up to date
+func (c *SQLiteCache) UpsertTargets(ctx context.Context, orgID string, targets []api.Target) error {
+	return c.storeTargets(ctx, orgID, targets, false)
+}
+
+func (c *SQLiteCache) storeTargets(ctx context.Context, orgID string, targets []api.Target, complete bool) error {
 	if len(targets) == 0 {
 		return nil // Nothing to store
 	}
 
-	// Begin a transaction
-	tx, err := c.db.Beginx()
+	// Begin a transaction, which is rolled back if the context is cancelled
+	tx, err := c.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -174,14 +344,21 @@ func (c *SQLiteCache) StoreTargets(orgID string, targets []api.Target) error {
 
 	// Insert each target
 	for _, target := range targets {
-		if _, err := tx.Exec(insertTargetSQL, target.ID, orgID, target.Attributes.DisplayName, target.Attributes.URL); err != nil {
+		createdAt := ""
+		if !target.Attributes.CreatedAt.IsZero() {
+			createdAt = target.Attributes.CreatedAt.UTC().Format(time.RFC3339)
+		}
+		if _, err := tx.ExecContext(ctx, insertTargetSQL, target.ID, orgID, target.Attributes.DisplayName, target.Attributes.URL,
+			target.IntegrationType(), target.IntegrationID(), target.Attributes.IsPrivate, createdAt, string(target.Raw)); err != nil {
 			return fmt.Errorf("failed to insert target: %w", err)
 		}
 	}
 
 	// Store the targets update timestamp for this org
-	if _, err := tx.Exec(insertMetadataSQL, fmt.Sprintf("targets_update_%s", orgID), time.Now().Format(time.RFC3339)); err != nil {
-		return fmt.Errorf("failed to update targets timestamp: %w", err)
+	if complete {
+		if _, err := tx.ExecContext(ctx, insertMetadataSQL, fmt.Sprintf("targets_update_%s", orgID), time.Now().Format(time.RFC3339)); err != nil {
+			return fmt.Errorf("failed to update targets timestamp: %w", err)
+		}
 	}
 
 	// Commit the transaction
@@ -192,79 +369,75 @@ func (c *SQLiteCache) StoreTargets(orgID string, targets []api.Target) error {
 	return nil
 }
 
+// TouchTargets marks the cached targets of an organization as up to date
+// without changing them, such as when the Snyk API reports they didn't change
+func (c *SQLiteCache) TouchTargets(ctx context.Context, orgID string) error {
+	if _, err := c.db.ExecContext(ctx, insertMetadataSQL, fmt.Sprintf("targets_update_%s", orgID), time.Now().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to update targets timestamp: %w", err)
+	}
+
+	return nil
+}
+
 // GetTargets retrieves all targets from the cache
-func (c *SQLiteCache) GetTargets() ([]api.Target, error) {
-	rows, err := c.db.Query(selectTargetsSQL)
+func (c *SQLiteCache) GetTargets(ctx context.Context) ([]api.Target, error) {
+	rows, err := c.db.QueryContext(ctx, selectTargetsSQL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to select targets: %w", err)
 	}
 	defer rows.Close()
 
-	var targets []api.Target
-	for rows.Next() {
-		var id, orgID, displayName, url string
-		if err := rows.Scan(&id, &orgID, &displayName, &url); err != nil {
-			return nil, fmt.Errorf("failed to scan target row: %w", err)
-		}
-
-		target := api.Target{
-			ID: id,
-		}
-		target.Attributes.DisplayName = displayName
-		target.Attributes.URL = url
-
-		targets = append(targets, target)
-	}
-
-	return targets, nil
+	return scanTargets(rows)
 }
 
 // GetTargetsByOrgID retrieves targets for a specific organization from the cache
-func (c *SQLiteCache) GetTargetsByOrgID(orgID string) ([]api.Target, error) {
-	rows, err := c.db.Query(selectTargetsByOrgIDSQL, orgID)
+func (c *SQLiteCache) GetTargetsByOrgID(ctx context.Context, orgID string) ([]api.Target, error) {
+	rows, err := c.db.QueryContext(ctx, selectTargetsByOrgIDSQL, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to select targets for org %s: %w", orgID, err)
 	}
 	defer rows.Close()
 
+	return scanTargets(rows)
+}
+
+// scanTargets reads targets selected with targetColumns
+func scanTargets(rows *sql.Rows) ([]api.Target, error) {
 	var targets []api.Target
 	for rows.Next() {
-		var id, orgID, displayName, url string
-		if err := rows.Scan(&id, &orgID, &displayName, &url); err != nil {
+		var target api.Target
+		var integrationType, integrationID, createdAt, raw string
+		if err := rows.Scan(&target.ID, &target.Attributes.DisplayName, &target.Attributes.URL,
+			&integrationType, &integrationID, &target.Attributes.IsPrivate, &createdAt, &raw); err != nil {
 			return nil, fmt.Errorf("failed to scan target row: %w", err)
 		}
 
-		target := api.Target{
-			ID: id,
+		target.Relationships.Integration.Data.ID = integrationID
+		target.Relationships.Integration.Data.Attributes.IntegrationType = integrationType
+		if createdAt != "" {
+			target.Attributes.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		}
+		if raw != "" {
+			target.Raw = json.RawMessage(raw)
 		}
-		target.Attributes.DisplayName = displayName
-		target.Attributes.URL = url
 
 		targets = append(targets, target)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read target rows: %w", err)
+	}
+
 	return targets, nil
 }
 
 // GetTargetsByURL retrieves targets with a specific URL from the cache
 // This function now checks for both HTTP and HTTPS variants of the URL
-func (c *SQLiteCache) GetTargetsByURL(url string) ([]api.OrgTarget, error) {
-	// Create both HTTP and HTTPS variants of the URL
-	httpVariant := url
-	httpsVariant := url
-
-	// Make sure we have both variants of the URL
-	if strings.HasPrefix(url, "https://") {
-		httpVariant = "http://" + strings.TrimPrefix(url, "https://")
-	} else if strings.HasPrefix(url, "http://") {
-		httpsVariant = "https://" + strings.TrimPrefix(url, "http://")
-	} else {
-		// If no protocol provided, default to both http:// and https:// prefixes
-		httpVariant = "http://" + url
-		httpsVariant = "https://" + url
-	}
+func (c *SQLiteCache) GetTargetsByURL(ctx context.Context, url string) ([]api.OrgTarget, error) {
+	// Look for both HTTP and HTTPS variants of the URL
+	variants := api.URLVariants(url)
 
-	rows, err := c.db.Query(selectTargetsByURLSQL, httpVariant, httpsVariant)
+	rows, err := c.db.QueryContext(ctx, selectTargetsByURLSQL, variants[0], variants[1])
 	if err != nil {
 		return nil, fmt.Errorf("failed to select targets for URL %s: %w", url, err)
 	}
@@ -272,14 +445,17 @@ func (c *SQLiteCache) GetTargetsByURL(url string) ([]api.OrgTarget, error) {
 
 	var orgTargets []api.OrgTarget
 	for rows.Next() {
-		var id, orgID, displayName, url, orgName string
-		if err := rows.Scan(&id, &orgID, &displayName, &url, &orgName); err != nil {
+		var id, orgID, displayName, url, orgName, groupID, role string
+		if err := rows.Scan(&id, &orgID, &displayName, &url, &orgName, &groupID, &role); err != nil {
 			return nil, fmt.Errorf("failed to scan target row: %w", err)
 		}
 
 		orgTarget := api.OrgTarget{
 			OrgID:      orgID,
 			OrgName:    orgName,
+			OrgRole:    role,
+			GroupID:    groupID,
+			TargetID:   id,
 			TargetURL:  url,
 			TargetName: displayName,
 		}
@@ -291,55 +467,360 @@ func (c *SQLiteCache) GetTargetsByURL(url string) ([]api.OrgTarget, error) {
 }
 
 // IsExpired checks if the cache has expired
-func (c *SQLiteCache) IsExpired(ttl time.Duration) (bool, error) {
-	var lastUpdateStr string
-	err := c.db.Get(&lastUpdateStr, selectMetadataSQL, "last_update")
+func (c *SQLiteCache) IsExpired(ctx context.Context, ttl time.Duration) (bool, error) {
+	return c.isTimestampExpired(ctx, "last_update", ttl, "last update timestamp")
+}
+
+// IsTargetsCacheExpired checks if the targets cache for an organization has expired
+func (c *SQLiteCache) IsTargetsCacheExpired(ctx context.Context, orgID string, ttl time.Duration) (bool, error) {
+	return c.isTimestampExpired(ctx, fmt.Sprintf("targets_update_%s", orgID), ttl, "targets last update timestamp")
+}
+
+// isTimestampExpired checks if the timestamp stored in the metadata under key
+// is older than ttl, counting the lookup as a cache hit or miss
+func (c *SQLiteCache) isTimestampExpired(ctx context.Context, key string, ttl time.Duration, what string) (bool, error) {
+	var timestampStr string
+	err := c.db.GetContext(ctx, &timestampStr, selectMetadataSQL, key)
 	if err != nil {
 		// If the key doesn't exist, the cache is expired
+		c.misses.Add(1)
 		return true, nil
 	}
 
-	lastUpdate, err := time.Parse(time.RFC3339, lastUpdateStr)
+	timestamp, err := time.Parse(time.RFC3339, timestampStr)
 	if err != nil {
-		return true, fmt.Errorf("failed to parse last update timestamp: %w", err)
+		c.misses.Add(1)
+		return true, fmt.Errorf("failed to parse %s: %w", what, err)
+	}
+
+	expired := time.Since(timestamp) > ttl
+	if expired {
+		c.misses.Add(1)
+	} else {
+		c.hits.Add(1)
 	}
+	return expired, nil
+}
 
-	return time.Since(lastUpdate) > ttl, nil
+// Stats returns the number of lookups that found fresh data in the cache, and
+// of those that found it missing or expired
+func (c *SQLiteCache) Stats() (hits int64, misses int64) {
+	return c.hits.Load(), c.misses.Load()
 }
 
-// IsTargetsCacheExpired checks if the targets cache for an organization has expired
-func (c *SQLiteCache) IsTargetsCacheExpired(orgID string, ttl time.Duration) (bool, error) {
-	var lastUpdateStr string
-	err := c.db.Get(&lastUpdateStr, selectMetadataSQL, fmt.Sprintf("targets_update_%s", orgID))
+// StoreProjects replaces the cached projects of a target in an organization and
+// marks them as up to date
+func (c *SQLiteCache) StoreProjects(ctx context.Context, orgID string, targetID string, projects []api.Project) error {
+	// Begin a transaction, which is rolled back if the context is cancelled
+	tx, err := c.db.BeginTxx(ctx, nil)
 	if err != nil {
-		// If the key doesn't exist, the cache is expired
-		return true, nil
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Remove the projects that no longer exist
+	if _, err := tx.ExecContext(ctx, deleteTargetProjectsSQL, orgID, targetID); err != nil {
+		return fmt.Errorf("failed to delete projects: %w", err)
+	}
+
+	// Insert each project
+	for _, p := range projects {
+		if _, err := tx.ExecContext(ctx, insertProjectSQL, p.ID, orgID, targetID, p.Name, p.Type, p.Status, p.Origin, p.TargetFile, p.TargetReference); err != nil {
+			return fmt.Errorf("failed to insert project: %w", err)
+		}
+	}
+
+	// Store the projects update timestamp for this target
+	if _, err := tx.ExecContext(ctx, insertMetadataSQL, projectsUpdateKey(orgID, targetID), time.Now().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to update projects timestamp: %w", err)
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetProjectsByTarget retrieves the projects of a target in an organization from the cache
+func (c *SQLiteCache) GetProjectsByTarget(ctx context.Context, orgID string, targetID string) ([]api.Project, error) {
+	var projects []api.Project
+	if err := c.db.SelectContext(ctx, &projects, selectProjectsByTargetSQL, orgID, targetID); err != nil {
+		return nil, fmt.Errorf("failed to select projects for target %s: %w", targetID, err)
+	}
+
+	return projects, nil
+}
+
+// IsProjectsCacheExpired checks if the projects cache for a target in an organization has expired
+func (c *SQLiteCache) IsProjectsCacheExpired(ctx context.Context, orgID string, targetID string, ttl time.Duration) (bool, error) {
+	return c.isTimestampExpired(ctx, projectsUpdateKey(orgID, targetID), ttl, "projects last update timestamp")
+}
+
+// projectsUpdateKey returns the metadata key of the projects of a target
+func projectsUpdateKey(orgID string, targetID string) string {
+	return fmt.Sprintf("projects_update_%s_%s", orgID, targetID)
+}
+
+// MarkTargetsProbed records that an organization was asked for targets matching
+// a URL, so that a lookup finding nothing isn't repeated until the TTL expires
+func (c *SQLiteCache) MarkTargetsProbed(ctx context.Context, orgID string, url string) error {
+	if _, err := c.db.ExecContext(ctx, insertMetadataSQL, targetsProbeKey(orgID, url), time.Now().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to update targets probe timestamp: %w", err)
+	}
+
+	return nil
+}
+
+// IsTargetsProbeExpired checks if the lookup of targets matching a URL in an
+// organization has expired
+func (c *SQLiteCache) IsTargetsProbeExpired(ctx context.Context, orgID string, url string, ttl time.Duration) (bool, error) {
+	return c.isTimestampExpired(ctx, targetsProbeKey(orgID, url), ttl, "targets probe timestamp")
+}
+
+// targetsProbeKey returns the metadata key of a URL lookup in an organization.
+// The HTTPS variant is used so that both schemes share the same key.
+func targetsProbeKey(orgID string, url string) string {
+	return fmt.Sprintf("targets_probe_%s_%s", orgID, strings.ToLower(api.URLVariants(url)[0]))
+}
+
+// StoreRestVersion remembers the REST API version that worked for a resource,
+// such as api.ResourceTargets
+func (c *SQLiteCache) StoreRestVersion(ctx context.Context, resource string, version string) error {
+	if _, err := c.db.ExecContext(ctx, insertMetadataSQL, restVersionKey(resource), version); err != nil {
+		return fmt.Errorf("failed to store REST API version: %w", err)
+	}
+
+	return nil
+}
+
+// GetRestVersions returns the remembered REST API versions by resource
+func (c *SQLiteCache) GetRestVersions(ctx context.Context) (map[string]string, error) {
+	versions := map[string]string{}
+	for _, resource := range api.RestResources {
+		var version string
+		err := c.db.GetContext(ctx, &version, selectMetadataSQL, restVersionKey(resource))
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to select REST API version: %w", err)
+		}
+		versions[resource] = version
 	}
 
-	lastUpdate, err := time.Parse(time.RFC3339, lastUpdateStr)
+	return versions, nil
+}
+
+// restVersionKey returns the metadata key of the REST API version of a resource
+func restVersionKey(resource string) string {
+	return fmt.Sprintf("rest_version_%s", resource)
+}
+
+// Identity describes the Snyk user the cached data belongs to
+type Identity struct {
+	// TokenHash is a hash of the token the user was identified by
+	TokenHash string
+	// UserHash is a hash of the user's ID and the API URL of the Snyk instance
+	UserHash string
+	// User describes the user, as shown to them
+	User string
+}
+
+// Metadata keys of the Identity
+const (
+	identityTokenHashKey = "auth_token_hash"
+	identityUserHashKey  = "auth_user_hash"
+	identityUserKey      = "auth_user"
+)
+
+// GetIdentity returns the identity the cached data belongs to, or nil if it
+// isn't known
+func (c *SQLiteCache) GetIdentity(ctx context.Context) (*Identity, error) {
+	var identity Identity
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{
+		{identityTokenHashKey, &identity.TokenHash},
+		{identityUserHashKey, &identity.UserHash},
+		{identityUserKey, &identity.User},
+	} {
+		err := c.db.GetContext(ctx, field.value, selectMetadataSQL, field.key)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to select identity: %w", err)
+		}
+	}
+
+	return &identity, nil
+}
+
+// StoreIdentity records the identity the cached data belongs to. If the
+// cached data belongs to another user, it is deleted first, reporting true.
+func (c *SQLiteCache) StoreIdentity(ctx context.Context, identity Identity) (bool, error) {
+	// Begin a transaction so no other user's data survives an interruption
+	tx, err := c.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return true, fmt.Errorf("failed to parse targets last update timestamp: %w", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.GetContext(ctx, &previous, selectMetadataSQL, identityUserHashKey)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("failed to select identity: %w", err)
+	}
+
+	cleared := previous != "" && previous != identity.UserHash
+	if cleared {
+		if err := clearTables(ctx, tx); err != nil {
+			return false, err
+		}
+	}
+
+	for key, value := range map[string]string{
+		identityTokenHashKey: identity.TokenHash,
+		identityUserHashKey:  identity.UserHash,
+		identityUserKey:      identity.User,
+	} {
+		if _, err := tx.ExecContext(ctx, insertMetadataSQL, key, value); err != nil {
+			return false, fmt.Errorf("failed to store identity: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return time.Since(lastUpdate) > ttl, nil
+	return cleared, nil
+}
+
+// GetResponse returns the Snyk API response stored for a URL, or nil if there is none
+func (c *SQLiteCache) GetResponse(ctx context.Context, url string) (*api.CachedResponse, error) {
+	var resp api.CachedResponse
+	err := c.db.QueryRowContext(ctx, selectResponseSQL, url).Scan(&resp.ETag, &resp.LastModified, &resp.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to select HTTP response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// StoreResponse stores a Snyk API response for a URL with its validators
+func (c *SQLiteCache) StoreResponse(ctx context.Context, url string, resp *api.CachedResponse) error {
+	// An empty body must not be stored as NULL
+	body := resp.Body
+	if body == nil {
+		body = []byte{}
+	}
+
+	if _, err := c.db.ExecContext(ctx, insertResponseSQL, url, resp.ETag, resp.LastModified, body); err != nil {
+		return fmt.Errorf("failed to insert HTTP response: %w", err)
+	}
+
+	return nil
 }
 
 // ResetCache clears all cached data
-func (c *SQLiteCache) ResetCache() error {
-	_, err := c.db.Exec("DELETE FROM targets")
+func (c *SQLiteCache) ResetCache(ctx context.Context) error {
+	// Begin a transaction so an interrupted reset leaves the cache untouched
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := clearTables(ctx, tx); err != nil {
+		return err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// clearTables deletes every row of every table in a transaction
+func clearTables(ctx context.Context, tx *sqlx.Tx) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM projects")
+	if err != nil {
+		return fmt.Errorf("failed to delete projects: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM targets")
 	if err != nil {
 		return fmt.Errorf("failed to delete targets: %w", err)
 	}
 
-	_, err = c.db.Exec("DELETE FROM organizations")
+	_, err = tx.ExecContext(ctx, "DELETE FROM organizations")
 	if err != nil {
 		return fmt.Errorf("failed to delete organizations: %w", err)
 	}
 
-	_, err = c.db.Exec("DELETE FROM metadata")
+	_, err = tx.ExecContext(ctx, "DELETE FROM groups")
+	if err != nil {
+		return fmt.Errorf("failed to delete groups: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM metadata")
 	if err != nil {
 		return fmt.Errorf("failed to delete metadata: %w", err)
 	}
 
+	_, err = tx.ExecContext(ctx, "DELETE FROM http_responses")
+	if err != nil {
+		return fmt.Errorf("failed to delete HTTP responses: %w", err)
+	}
+
+	return nil
+}
+
+// cacheFileName returns the name of the database file for the Snyk instance
+// with the given API URL. The default instance keeps the original file name.
+func cacheFileName(apiURL string) string {
+	apiURL = strings.TrimSuffix(strings.ToLower(apiURL), "/")
+	if apiURL == "" || apiURL == api.DefaultSnykEndpoint {
+		return "cache.db"
+	}
+
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.TrimPrefix(strings.TrimPrefix(apiURL, "https://"), "http://"))
+
+	return "cache-" + name + ".db"
+}
+
+// addColumnIfMissing adds a column to a table created by an older version of
+// snyk-auto-org, since CREATE TABLE IF NOT EXISTS leaves existing tables alone
+func addColumnIfMissing(db *sqlx.DB, table string, column string, definition string) error {
+	var columns []struct {
+		Name string `db:"name"`
+	}
+	if err := db.Select(&columns, fmt.Sprintf("SELECT name FROM pragma_table_info('%s');", table)); err != nil {
+		return fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+
+	for _, existing := range columns {
+		if existing.Name == column {
+			return nil
+		}
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add %s column to %s table: %w", column, table, err)
+	}
+
 	return nil
 }
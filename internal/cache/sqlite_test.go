@@ -1,8 +1,13 @@
 package cache_test
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -12,16 +17,18 @@ import (
 	"github.com/z4ce/snyk-auto-org/internal/cache"
 )
 
+var ctx = context.Background()
+
 // Helper function to force a specific organization's targets cache to expire
 func resetTargetsCacheTimestamp(db *cache.SQLiteCache) func(orgID string) {
 	return func(orgID string) {
 		// We can simply remove the timestamp from the metadata table
 		// This is a testing-only function
-		err := db.ResetCache() // We'll just reset the entire cache for simplicity
+		err := db.ResetCache(ctx) // We'll just reset the entire cache for simplicity
 		Expect(err).NotTo(HaveOccurred())
 
 		// Then re-add the org data and other org's targets
-		Expect(db.StoreOrganizations([]api.Organization{
+		Expect(db.StoreOrganizations(ctx, []api.Organization{
 			{ID: "org-id-1", Name: "Organization 1", Slug: "org-1"},
 			{ID: "org-id-2", Name: "Organization 2", Slug: "org-2"},
 		})).To(Succeed())
@@ -31,16 +38,13 @@ func resetTargetsCacheTimestamp(db *cache.SQLiteCache) func(orgID string) {
 			targets := []api.Target{
 				{
 					ID: "target-id-2",
-					Attributes: struct {
-						DisplayName string `json:"displayName"`
-						URL         string `json:"url"`
-					}{
+					Attributes: api.TargetAttributes{
 						DisplayName: "Target 2",
 						URL:         "https://github.com/org1/repo2",
 					},
 				},
 			}
-			Expect(db.StoreTargets("org-id-2", targets)).To(Succeed())
+			Expect(db.StoreTargets(ctx, "org-id-2", targets)).To(Succeed())
 		}
 	}
 }
@@ -76,9 +80,11 @@ var _ = Describe("SQLiteCache", func() {
 		// Sample test organizations
 		organizations = []api.Organization{
 			{
-				ID:   "org-id-1",
-				Name: "Organization 1",
-				Slug: "org-1",
+				ID:      "org-id-1",
+				Name:    "Organization 1",
+				Slug:    "org-1",
+				GroupID: "group-id-1",
+				Role:    "Org Admin",
 			},
 			{
 				ID:   "org-id-2",
@@ -91,20 +97,14 @@ var _ = Describe("SQLiteCache", func() {
 		targets = []api.Target{
 			{
 				ID: "target-id-1",
-				Attributes: struct {
-					DisplayName string `json:"displayName"`
-					URL         string `json:"url"`
-				}{
+				Attributes: api.TargetAttributes{
 					DisplayName: "Target 1",
 					URL:         "https://github.com/org1/repo1",
 				},
 			},
 			{
 				ID: "target-id-2",
-				Attributes: struct {
-					DisplayName string `json:"displayName"`
-					URL         string `json:"url"`
-				}{
+				Attributes: api.TargetAttributes{
 					DisplayName: "Target 2",
 					URL:         "https://github.com/org1/repo2",
 				},
@@ -129,34 +129,176 @@ var _ = Describe("SQLiteCache", func() {
 	Describe("StoreOrganizations and GetOrganizations", func() {
 		It("should store and retrieve organizations", func() {
 			// Store the test organizations
-			err := dbCache.StoreOrganizations(organizations)
+			err := dbCache.StoreOrganizations(ctx, organizations)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Retrieve the organizations
-			retrievedOrgs, err := dbCache.GetOrganizations()
+			retrievedOrgs, err := dbCache.GetOrganizations(ctx)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(retrievedOrgs).To(HaveLen(2))
 			Expect(retrievedOrgs[0].ID).To(Equal("org-id-1"))
 			Expect(retrievedOrgs[0].Name).To(Equal("Organization 1"))
+			Expect(retrievedOrgs[0].GroupID).To(Equal("group-id-1"))
+			Expect(retrievedOrgs[0].Role).To(Equal("Org Admin"))
 			Expect(retrievedOrgs[1].ID).To(Equal("org-id-2"))
 			Expect(retrievedOrgs[1].Name).To(Equal("Organization 2"))
+			Expect(retrievedOrgs[1].GroupID).To(BeEmpty())
+		})
+
+		It("should retrieve organizations ordered by name", func() {
+			// Store the organizations in reverse order
+			err := dbCache.StoreOrganizations(ctx, []api.Organization{organizations[1], organizations[0]})
+			Expect(err).NotTo(HaveOccurred())
+
+			retrievedOrgs, err := dbCache.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(retrievedOrgs).To(HaveLen(2))
+			Expect(retrievedOrgs[0].ID).To(Equal("org-id-1"))
+			Expect(retrievedOrgs[1].ID).To(Equal("org-id-2"))
+		})
+	})
+
+	Describe("NewSQLiteCacheForEndpoint", func() {
+		It("should keep the data of each Snyk instance apart", func() {
+			Expect(dbCache.StoreOrganizations(ctx, organizations)).To(Succeed())
+
+			euCache, err := cache.NewSQLiteCacheForEndpoint("https://api.eu.snyk.io")
+			Expect(err).NotTo(HaveOccurred())
+			defer euCache.Close()
+
+			orgs, err := euCache.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgs).To(BeEmpty())
+			Expect(filepath.Join(cacheDir, "cache-api.eu.snyk.io.db")).To(BeARegularFile())
+		})
+
+		It("should use the original cache for the default instance", func() {
+			Expect(dbCache.StoreOrganizations(ctx, organizations)).To(Succeed())
+
+			defaultCache, err := cache.NewSQLiteCacheForEndpoint(api.DefaultSnykEndpoint)
+			Expect(err).NotTo(HaveOccurred())
+			defer defaultCache.Close()
+
+			orgs, err := defaultCache.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgs).To(HaveLen(2))
+		})
+	})
+
+	Describe("StoreGroups and GetGroups", func() {
+		It("should store and retrieve groups ordered by name", func() {
+			err := dbCache.StoreGroups(ctx, []api.Group{
+				{ID: "group-id-2", Name: "Group B", Slug: "group-b"},
+				{ID: "group-id-1", Name: "Group A", Slug: "group-a"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			groups, err := dbCache.GetGroups(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(groups).To(HaveLen(2))
+			Expect(groups[0].ID).To(Equal("group-id-1"))
+			Expect(groups[0].Name).To(Equal("Group A"))
+			Expect(groups[0].Slug).To(Equal("group-a"))
+			Expect(groups[1].ID).To(Equal("group-id-2"))
+		})
+	})
+
+	Describe("Schema migration", func() {
+		It("should add the group column to a cache created by an older version", func() {
+			// Replace the cache with one using the original organizations table
+			Expect(dbCache.Close()).To(Succeed())
+			dbCache = nil
+
+			dbPath := filepath.Join(cacheDir, "cache.db")
+			Expect(os.Remove(dbPath)).To(Succeed())
+
+			oldDB, err := sql.Open("sqlite3", dbPath)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = oldDB.Exec(`CREATE TABLE organizations (id TEXT PRIMARY KEY, name TEXT NOT NULL, slug TEXT NOT NULL);`)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = oldDB.Exec(`INSERT INTO organizations (id, name, slug) VALUES ('org-id-1', 'Organization 1', 'org-1');`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(oldDB.Close()).To(Succeed())
+
+			dbCache, err = cache.NewSQLiteCache()
+			Expect(err).NotTo(HaveOccurred())
+
+			orgs, err := dbCache.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgs).To(HaveLen(1))
+			Expect(orgs[0].ID).To(Equal("org-id-1"))
+			Expect(orgs[0].GroupID).To(BeEmpty())
+			Expect(orgs[0].Role).To(BeEmpty())
+
+			// Organizations can be stored with their group and role from now on
+			Expect(dbCache.StoreOrganizations(ctx, organizations)).To(Succeed())
+			orgs, err = dbCache.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgs[0].GroupID).To(Equal("group-id-1"))
+			Expect(orgs[0].Role).To(Equal("Org Admin"))
+		})
+
+		It("should add the target attribute columns to a cache created by an older version", func() {
+			Expect(dbCache.Close()).To(Succeed())
+			dbCache = nil
+
+			dbPath := filepath.Join(cacheDir, "cache.db")
+			Expect(os.Remove(dbPath)).To(Succeed())
+
+			oldDB, err := sql.Open("sqlite3", dbPath)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = oldDB.Exec(`CREATE TABLE targets (id TEXT PRIMARY KEY, org_id TEXT NOT NULL, display_name TEXT NOT NULL, url TEXT NOT NULL);`)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = oldDB.Exec(`INSERT INTO targets (id, org_id, display_name, url) VALUES ('target-id-1', 'org-id-1', 'Target 1', 'https://github.com/org1/repo1');`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(oldDB.Close()).To(Succeed())
+
+			dbCache, err = cache.NewSQLiteCache()
+			Expect(err).NotTo(HaveOccurred())
+
+			stored, err := dbCache.GetTargetsByOrgID(ctx, "org-id-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).To(HaveLen(1))
+			Expect(stored[0].Attributes.URL).To(Equal("https://github.com/org1/repo1"))
+			Expect(stored[0].IntegrationType()).To(BeEmpty())
+			Expect(stored[0].Raw).To(BeNil())
 		})
 	})
 
 	Describe("StoreTargets and GetTargets", func() {
 		BeforeEach(func() {
 			// Store organizations first (for foreign key constraint)
-			err := dbCache.StoreOrganizations(organizations)
+			err := dbCache.StoreOrganizations(ctx, organizations)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("should store the full target attributes", func() {
+			var target api.Target
+			Expect(json.Unmarshal([]byte(`{
+				"id": "target-id-3",
+				"attributes": {"displayName": "org1/repo3", "url": "https://github.com/org1/repo3", "is_private": true, "created_at": "2024-05-01T10:00:00Z"},
+				"relationships": {"integration": {"data": {"id": "integration-id-1", "attributes": {"integration_type": "github-enterprise"}}}}
+			}`), &target)).To(Succeed())
+
+			Expect(dbCache.StoreTargets(ctx, "org-id-1", []api.Target{target})).To(Succeed())
+
+			stored, err := dbCache.GetTargetsByOrgID(ctx, "org-id-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).To(HaveLen(1))
+			Expect(stored[0].IntegrationType()).To(Equal("github-enterprise"))
+			Expect(stored[0].IntegrationID()).To(Equal("integration-id-1"))
+			Expect(stored[0].Attributes.IsPrivate).To(BeTrue())
+			Expect(stored[0].Attributes.CreatedAt).To(Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)))
+			Expect(stored[0].Raw).To(MatchJSON(target.Raw))
+		})
+
 		It("should store and retrieve targets", func() {
 			// Store the test targets for the first organization
-			err := dbCache.StoreTargets("org-id-1", targets)
+			err := dbCache.StoreTargets(ctx, "org-id-1", targets)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Retrieve all targets
-			retrievedTargets, err := dbCache.GetTargets()
+			retrievedTargets, err := dbCache.GetTargets(ctx)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(retrievedTargets).To(HaveLen(2))
 			Expect(retrievedTargets[0].ID).To(Equal("target-id-1"))
@@ -169,17 +311,14 @@ var _ = Describe("SQLiteCache", func() {
 
 		It("should update existing targets when storing again", func() {
 			// Store initial targets
-			err := dbCache.StoreTargets("org-id-1", targets)
+			err := dbCache.StoreTargets(ctx, "org-id-1", targets)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Modify targets
 			modifiedTargets := []api.Target{
 				{
 					ID: "target-id-1", // Same ID
-					Attributes: struct {
-						DisplayName string `json:"displayName"`
-						URL         string `json:"url"`
-					}{
+					Attributes: api.TargetAttributes{
 						DisplayName: "Modified Target 1", // New name
 						URL:         "https://github.com/org1/repo1",
 					},
@@ -187,11 +326,11 @@ var _ = Describe("SQLiteCache", func() {
 			}
 
 			// Store modified targets
-			err = dbCache.StoreTargets("org-id-1", modifiedTargets)
+			err = dbCache.StoreTargets(ctx, "org-id-1", modifiedTargets)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Retrieve and verify
-			retrievedTargets, err := dbCache.GetTargetsByOrgID("org-id-1")
+			retrievedTargets, err := dbCache.GetTargetsByOrgID(ctx, "org-id-1")
 			Expect(err).NotTo(HaveOccurred())
 
 			// Should find the updated target
@@ -207,21 +346,21 @@ var _ = Describe("SQLiteCache", func() {
 
 		It("should retrieve targets by organization ID", func() {
 			// Store targets for both organizations
-			err := dbCache.StoreTargets("org-id-1", targets[:1]) // First target for org1
+			err := dbCache.StoreTargets(ctx, "org-id-1", targets[:1]) // First target for org1
 			Expect(err).NotTo(HaveOccurred())
 
-			err = dbCache.StoreTargets("org-id-2", targets[1:]) // Second target for org2
+			err = dbCache.StoreTargets(ctx, "org-id-2", targets[1:]) // Second target for org2
 			Expect(err).NotTo(HaveOccurred())
 
 			// Retrieve targets for the first organization
-			retrievedTargets, err := dbCache.GetTargetsByOrgID("org-id-1")
+			retrievedTargets, err := dbCache.GetTargetsByOrgID(ctx, "org-id-1")
 			Expect(err).NotTo(HaveOccurred())
 			Expect(retrievedTargets).To(HaveLen(1))
 			Expect(retrievedTargets[0].ID).To(Equal("target-id-1"))
 			Expect(retrievedTargets[0].Attributes.DisplayName).To(Equal("Target 1"))
 
 			// Retrieve targets for the second organization
-			retrievedTargets, err = dbCache.GetTargetsByOrgID("org-id-2")
+			retrievedTargets, err = dbCache.GetTargetsByOrgID(ctx, "org-id-2")
 			Expect(err).NotTo(HaveOccurred())
 			Expect(retrievedTargets).To(HaveLen(1))
 			Expect(retrievedTargets[0].ID).To(Equal("target-id-2"))
@@ -233,29 +372,29 @@ var _ = Describe("SQLiteCache", func() {
 			targetWithSameURL := []api.Target{
 				{
 					ID: "target-id-3",
-					Attributes: struct {
-						DisplayName string `json:"displayName"`
-						URL         string `json:"url"`
-					}{
+					Attributes: api.TargetAttributes{
 						DisplayName: "Common Target",
 						URL:         "https://github.com/common/repo",
 					},
 				},
 			}
 
-			err := dbCache.StoreTargets("org-id-1", targetWithSameURL)
+			err := dbCache.StoreTargets(ctx, "org-id-1", targetWithSameURL)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Store the original targets for the first organization as well
-			err = dbCache.StoreTargets("org-id-1", targets)
+			err = dbCache.StoreTargets(ctx, "org-id-1", targets)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Retrieve targets by URL
-			orgTargets, err := dbCache.GetTargetsByURL("https://github.com/org1/repo1")
+			orgTargets, err := dbCache.GetTargetsByURL(ctx, "https://github.com/org1/repo1")
 			Expect(err).NotTo(HaveOccurred())
 			Expect(orgTargets).To(HaveLen(1))
 			Expect(orgTargets[0].OrgID).To(Equal("org-id-1"))
 			Expect(orgTargets[0].OrgName).To(Equal("Organization 1"))
+			Expect(orgTargets[0].OrgRole).To(Equal("Org Admin"))
+			Expect(orgTargets[0].GroupID).To(Equal("group-id-1"))
+			Expect(orgTargets[0].TargetID).To(Equal("target-id-1"))
 			Expect(orgTargets[0].TargetURL).To(Equal("https://github.com/org1/repo1"))
 			Expect(orgTargets[0].TargetName).To(Equal("Target 1"))
 		})
@@ -267,10 +406,7 @@ var _ = Describe("SQLiteCache", func() {
 			targetsOrg1 := []api.Target{
 				{
 					ID: "target-org1",
-					Attributes: struct {
-						DisplayName string `json:"displayName"`
-						URL         string `json:"url"`
-					}{
+					Attributes: api.TargetAttributes{
 						DisplayName: "Common Repo in Org 1",
 						URL:         commonURL,
 					},
@@ -280,25 +416,22 @@ var _ = Describe("SQLiteCache", func() {
 			targetsOrg2 := []api.Target{
 				{
 					ID: "target-org2",
-					Attributes: struct {
-						DisplayName string `json:"displayName"`
-						URL         string `json:"url"`
-					}{
+					Attributes: api.TargetAttributes{
 						DisplayName: "Common Repo in Org 2",
 						URL:         commonURL,
 					},
 				},
 			}
 
-			// Store targets in both organizations
-			err := dbCache.StoreTargets("org-id-1", targetsOrg1)
+			// Store targets in both organizations, the second one first
+			err := dbCache.StoreTargets(ctx, "org-id-2", targetsOrg2)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = dbCache.StoreTargets("org-id-2", targetsOrg2)
+			err = dbCache.StoreTargets(ctx, "org-id-1", targetsOrg1)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Retrieve by URL
-			orgTargets, err := dbCache.GetTargetsByURL(commonURL)
+			orgTargets, err := dbCache.GetTargetsByURL(ctx, commonURL)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Should find both targets
@@ -313,13 +446,17 @@ var _ = Describe("SQLiteCache", func() {
 
 			Expect(orgIDs).To(HaveKey("org-id-1"))
 			Expect(orgIDs).To(HaveKey("org-id-2"))
+
+			// Targets are ordered by the name of their organization
+			Expect(orgTargets[0].OrgID).To(Equal("org-id-1"))
+			Expect(orgTargets[1].OrgID).To(Equal("org-id-2"))
 		})
 	})
 
 	Describe("IsExpired", func() {
 		Context("when the cache is empty", func() {
 			It("should report as expired", func() {
-				expired, err := dbCache.IsExpired(24 * time.Hour)
+				expired, err := dbCache.IsExpired(ctx, 24*time.Hour)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expired).To(BeTrue())
 			})
@@ -327,12 +464,12 @@ var _ = Describe("SQLiteCache", func() {
 
 		Context("when the cache is fresh", func() {
 			BeforeEach(func() {
-				err := dbCache.StoreOrganizations(organizations)
+				err := dbCache.StoreOrganizations(ctx, organizations)
 				Expect(err).NotTo(HaveOccurred())
 			})
 
 			It("should not report as expired", func() {
-				expired, err := dbCache.IsExpired(24 * time.Hour)
+				expired, err := dbCache.IsExpired(ctx, 24*time.Hour)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expired).To(BeFalse())
 			})
@@ -350,7 +487,7 @@ var _ = Describe("SQLiteCache", func() {
 	Describe("IsTargetsCacheExpired", func() {
 		Context("when the targets cache is empty", func() {
 			It("should report as expired", func() {
-				expired, err := dbCache.IsTargetsCacheExpired("org-id-1", 24*time.Hour)
+				expired, err := dbCache.IsTargetsCacheExpired(ctx, "org-id-1", 24*time.Hour)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expired).To(BeTrue())
 			})
@@ -359,16 +496,16 @@ var _ = Describe("SQLiteCache", func() {
 		Context("when the targets cache is fresh", func() {
 			BeforeEach(func() {
 				// Store organizations first (for foreign key constraint)
-				err := dbCache.StoreOrganizations(organizations)
+				err := dbCache.StoreOrganizations(ctx, organizations)
 				Expect(err).NotTo(HaveOccurred())
 
 				// Store targets to set the timestamp
-				err = dbCache.StoreTargets("org-id-1", targets)
+				err = dbCache.StoreTargets(ctx, "org-id-1", targets)
 				Expect(err).NotTo(HaveOccurred())
 			})
 
 			It("should not report as expired", func() {
-				expired, err := dbCache.IsTargetsCacheExpired("org-id-1", 24*time.Hour)
+				expired, err := dbCache.IsTargetsCacheExpired(ctx, "org-id-1", 24*time.Hour)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expired).To(BeFalse())
 			})
@@ -377,24 +514,24 @@ var _ = Describe("SQLiteCache", func() {
 		Context("when updating only one organization's targets", func() {
 			BeforeEach(func() {
 				// Store organizations first
-				err := dbCache.StoreOrganizations(organizations)
+				err := dbCache.StoreOrganizations(ctx, organizations)
 				Expect(err).NotTo(HaveOccurred())
 
 				// Store targets for both orgs
-				err = dbCache.StoreTargets("org-id-1", targets[:1])
+				err = dbCache.StoreTargets(ctx, "org-id-1", targets[:1])
 				Expect(err).NotTo(HaveOccurred())
 
-				err = dbCache.StoreTargets("org-id-2", targets[1:])
+				err = dbCache.StoreTargets(ctx, "org-id-2", targets[1:])
 				Expect(err).NotTo(HaveOccurred())
 			})
 
 			It("should track expiration separately for each organization", func() {
 				// Both should be fresh
-				expired1, err := dbCache.IsTargetsCacheExpired("org-id-1", 24*time.Hour)
+				expired1, err := dbCache.IsTargetsCacheExpired(ctx, "org-id-1", 24*time.Hour)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expired1).To(BeFalse())
 
-				expired2, err := dbCache.IsTargetsCacheExpired("org-id-2", 24*time.Hour)
+				expired2, err := dbCache.IsTargetsCacheExpired(ctx, "org-id-2", 24*time.Hour)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expired2).To(BeFalse())
 
@@ -402,10 +539,7 @@ var _ = Describe("SQLiteCache", func() {
 				newTarget := []api.Target{
 					{
 						ID: "target-id-3",
-						Attributes: struct {
-							DisplayName string `json:"displayName"`
-							URL         string `json:"url"`
-						}{
+						Attributes: api.TargetAttributes{
 							DisplayName: "New Target",
 							URL:         "https://github.com/org1/repo3",
 						},
@@ -416,15 +550,15 @@ var _ = Describe("SQLiteCache", func() {
 				time.Sleep(10 * time.Millisecond)
 
 				// Update only org-id-1
-				err = dbCache.StoreTargets("org-id-1", newTarget)
+				err = dbCache.StoreTargets(ctx, "org-id-1", newTarget)
 				Expect(err).NotTo(HaveOccurred())
 
 				// Check if both caches are still fresh
-				expired1, err = dbCache.IsTargetsCacheExpired("org-id-1", 24*time.Hour)
+				expired1, err = dbCache.IsTargetsCacheExpired(ctx, "org-id-1", 24*time.Hour)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expired1).To(BeFalse(), "Org 1 targets cache should still be fresh")
 
-				expired2, err = dbCache.IsTargetsCacheExpired("org-id-2", 24*time.Hour)
+				expired2, err = dbCache.IsTargetsCacheExpired(ctx, "org-id-2", 24*time.Hour)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expired2).To(BeFalse(), "Org 2 targets cache should still be fresh")
 
@@ -432,50 +566,381 @@ var _ = Describe("SQLiteCache", func() {
 				resetOrgTargetsCache("org-id-1")
 
 				// Now org-id-1 should be expired, but org-id-2 still fresh
-				expired1, err = dbCache.IsTargetsCacheExpired("org-id-1", 24*time.Hour)
+				expired1, err = dbCache.IsTargetsCacheExpired(ctx, "org-id-1", 24*time.Hour)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expired1).To(BeTrue(), "Org 1 targets cache should be expired after reset")
 
-				expired2, err = dbCache.IsTargetsCacheExpired("org-id-2", 24*time.Hour)
+				expired2, err = dbCache.IsTargetsCacheExpired(ctx, "org-id-2", 24*time.Hour)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(expired2).To(BeFalse(), "Org 2 targets cache should still be fresh")
 			})
 		})
 	})
 
+	Describe("UpsertTargets", func() {
+		BeforeEach(func() {
+			err := dbCache.StoreOrganizations(ctx, organizations)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should store targets without marking the organization's targets as up to date", func() {
+			err := dbCache.UpsertTargets(ctx, "org-id-1", targets[:1])
+			Expect(err).NotTo(HaveOccurred())
+
+			orgTargets, err := dbCache.GetTargetsByURL(ctx, "https://github.com/org1/repo1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgTargets).To(HaveLen(1))
+
+			expired, err := dbCache.IsTargetsCacheExpired(ctx, "org-id-1", 24*time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeTrue())
+		})
+	})
+
+	Describe("Projects", func() {
+		var projects []api.Project
+
+		BeforeEach(func() {
+			Expect(dbCache.StoreOrganizations(ctx, organizations)).To(Succeed())
+			Expect(dbCache.StoreTargets(ctx, "org-id-1", targets)).To(Succeed())
+
+			projects = []api.Project{
+				{ID: "project-id-2", Name: "repo1:go.mod", Type: "gomodules", Status: "inactive", Origin: "github", TargetFile: "go.mod", TargetReference: "main"},
+				{ID: "project-id-1", Name: "repo1:package.json", Type: "npm", Status: "active", Origin: "github", TargetFile: "package.json", TargetReference: "main"},
+			}
+		})
+
+		It("should store and retrieve the projects of a target", func() {
+			Expect(dbCache.StoreProjects(ctx, "org-id-1", "target-id-1", projects)).To(Succeed())
+
+			stored, err := dbCache.GetProjectsByTarget(ctx, "org-id-1", "target-id-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).To(HaveLen(2))
+			Expect(stored[0].ID).To(Equal("project-id-2"))
+			Expect(stored[1].ID).To(Equal("project-id-1"))
+			Expect(stored[1].OrgID).To(Equal("org-id-1"))
+			Expect(stored[1].TargetID).To(Equal("target-id-1"))
+			Expect(stored[1].Type).To(Equal("npm"))
+			Expect(stored[1].Status).To(Equal("active"))
+			Expect(stored[1].Origin).To(Equal("github"))
+			Expect(stored[1].TargetFile).To(Equal("package.json"))
+			Expect(stored[1].TargetReference).To(Equal("main"))
+
+			other, err := dbCache.GetProjectsByTarget(ctx, "org-id-1", "target-id-2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other).To(BeEmpty())
+		})
+
+		It("should replace the projects of a target when storing again", func() {
+			Expect(dbCache.StoreProjects(ctx, "org-id-1", "target-id-1", projects)).To(Succeed())
+			Expect(dbCache.StoreProjects(ctx, "org-id-1", "target-id-1", projects[1:])).To(Succeed())
+
+			stored, err := dbCache.GetProjectsByTarget(ctx, "org-id-1", "target-id-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).To(HaveLen(1))
+			Expect(stored[0].ID).To(Equal("project-id-1"))
+		})
+
+		It("should track expiration of the projects of each target, even without projects", func() {
+			expired, err := dbCache.IsProjectsCacheExpired(ctx, "org-id-1", "target-id-2", time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeTrue())
+
+			Expect(dbCache.StoreProjects(ctx, "org-id-1", "target-id-2", nil)).To(Succeed())
+
+			expired, err = dbCache.IsProjectsCacheExpired(ctx, "org-id-1", "target-id-2", time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeFalse())
+
+			expired, err = dbCache.IsProjectsCacheExpired(ctx, "org-id-1", "target-id-1", time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeTrue())
+		})
+	})
+
+	Describe("Targets probes", func() {
+		It("should report a probe as expired until it is marked", func() {
+			expired, err := dbCache.IsTargetsProbeExpired(ctx, "org-id-1", "https://github.com/org1/repo1", 24*time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeTrue())
+
+			Expect(dbCache.MarkTargetsProbed(ctx, "org-id-1", "https://github.com/org1/repo1")).To(Succeed())
+
+			expired, err = dbCache.IsTargetsProbeExpired(ctx, "org-id-1", "https://github.com/org1/repo1", 24*time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeFalse())
+		})
+
+		It("should share probes between the HTTP and HTTPS variants of a URL", func() {
+			Expect(dbCache.MarkTargetsProbed(ctx, "org-id-1", "http://github.com/org1/repo1")).To(Succeed())
+
+			expired, err := dbCache.IsTargetsProbeExpired(ctx, "org-id-1", "https://github.com/org1/repo1", 24*time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeFalse())
+
+			expired, err = dbCache.IsTargetsProbeExpired(ctx, "org-id-2", "https://github.com/org1/repo1", 24*time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeTrue())
+		})
+	})
+
+	Describe("HTTP responses", func() {
+		It("should round-trip responses by URL", func() {
+			resp, err := dbCache.GetResponse(ctx, "https://api.snyk.io/rest/orgs")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp).To(BeNil())
+
+			Expect(dbCache.StoreResponse(ctx, "https://api.snyk.io/rest/orgs", &api.CachedResponse{
+				ETag: `W/"1"`,
+				Body: []byte(`{"data": []}`),
+			})).To(Succeed())
+
+			resp, err = dbCache.GetResponse(ctx, "https://api.snyk.io/rest/orgs")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.ETag).To(Equal(`W/"1"`))
+			Expect(resp.LastModified).To(BeEmpty())
+			Expect(string(resp.Body)).To(Equal(`{"data": []}`))
+		})
+	})
+
+	Describe("Stats", func() {
+		It("should count fresh lookups as hits and the others as misses", func() {
+			_, err := dbCache.IsTargetsCacheExpired(ctx, "org-id-1", time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(dbCache.StoreOrganizations(ctx, organizations)).To(Succeed())
+			expired, err := dbCache.IsExpired(ctx, time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeFalse())
+
+			hits, misses := dbCache.Stats()
+			Expect(hits).To(Equal(int64(1)))
+			Expect(misses).To(Equal(int64(1)))
+		})
+	})
+
+	Describe("REST API versions", func() {
+		It("should remember the version of each resource", func() {
+			versions, err := dbCache.GetRestVersions(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(BeEmpty())
+
+			Expect(dbCache.StoreRestVersion(ctx, api.ResourceTargets, "2024-06-21")).To(Succeed())
+			Expect(dbCache.StoreRestVersion(ctx, api.ResourceTargets, "2024-01-23")).To(Succeed())
+
+			versions, err = dbCache.GetRestVersions(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(versions).To(Equal(map[string]string{api.ResourceTargets: "2024-01-23"}))
+		})
+	})
+
+	Describe("Identity", func() {
+		alice := cache.Identity{TokenHash: "token-1", UserHash: "alice", User: "Alice"}
+
+		BeforeEach(func() {
+			Expect(dbCache.StoreOrganizations(ctx, organizations)).To(Succeed())
+			Expect(dbCache.StoreTargets(ctx, "org-id-1", targets)).To(Succeed())
+		})
+
+		It("is unknown until stored", func() {
+			identity, err := dbCache.GetIdentity(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(identity).To(BeNil())
+
+			cleared, err := dbCache.StoreIdentity(ctx, alice)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cleared).To(BeFalse())
+
+			identity, err = dbCache.GetIdentity(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*identity).To(Equal(alice))
+
+			// The data cached before the identity was known is kept
+			orgs, err := dbCache.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgs).To(HaveLen(2))
+		})
+
+		It("keeps the cached data when the same user uses another token", func() {
+			Expect(dbCache.StoreIdentity(ctx, alice)).Error().NotTo(HaveOccurred())
+
+			cleared, err := dbCache.StoreIdentity(ctx, cache.Identity{TokenHash: "token-2", UserHash: "alice", User: "Alice"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cleared).To(BeFalse())
+
+			identity, err := dbCache.GetIdentity(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(identity.TokenHash).To(Equal("token-2"))
+
+			orgs, err := dbCache.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgs).To(HaveLen(2))
+		})
+
+		It("clears the cached data of another user", func() {
+			Expect(dbCache.StoreIdentity(ctx, alice)).Error().NotTo(HaveOccurred())
+			Expect(dbCache.StoreRestVersion(ctx, api.ResourceOrgs, "2024-06-21")).To(Succeed())
+
+			bob := cache.Identity{TokenHash: "token-3", UserHash: "bob", User: "Bob"}
+			cleared, err := dbCache.StoreIdentity(ctx, bob)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cleared).To(BeTrue())
+
+			orgs, err := dbCache.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(orgs).To(BeEmpty())
+
+			cachedTargets, err := dbCache.GetTargets(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cachedTargets).To(BeEmpty())
+
+			expired, err := dbCache.IsExpired(ctx, time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeTrue())
+
+			identity, err := dbCache.GetIdentity(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*identity).To(Equal(bob))
+		})
+
+		It("is forgotten when the cache is reset", func() {
+			Expect(dbCache.StoreIdentity(ctx, alice)).Error().NotTo(HaveOccurred())
+			Expect(dbCache.ResetCache(ctx)).To(Succeed())
+
+			identity, err := dbCache.GetIdentity(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(identity).To(BeNil())
+		})
+	})
+
+	Describe("TouchTargets", func() {
+		It("should mark the targets as up to date without changing them", func() {
+			Expect(dbCache.StoreOrganizations(ctx, organizations)).To(Succeed())
+			Expect(dbCache.UpsertTargets(ctx, "org-id-1", targets)).To(Succeed())
+
+			expired, err := dbCache.IsTargetsCacheExpired(ctx, "org-id-1", time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeTrue())
+
+			Expect(dbCache.TouchTargets(ctx, "org-id-1")).To(Succeed())
+
+			expired, err = dbCache.IsTargetsCacheExpired(ctx, "org-id-1", time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeFalse())
+
+			stored, err := dbCache.GetTargetsByOrgID(ctx, "org-id-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).To(HaveLen(2))
+		})
+	})
+
+	Describe("Concurrent writes", func() {
+		BeforeEach(func() {
+			err := dbCache.StoreOrganizations(ctx, organizations)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should store targets from many goroutines at once", func() {
+			var wg sync.WaitGroup
+			errs := make(chan error, 20)
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					orgID := organizations[i%2].ID
+					target := api.Target{ID: fmt.Sprintf("target-%d", i)}
+					target.Attributes.DisplayName = fmt.Sprintf("Target %d", i)
+					target.Attributes.URL = fmt.Sprintf("https://github.com/org/repo%d", i)
+					errs <- dbCache.StoreTargets(ctx, orgID, []api.Target{target})
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			storedTargets, err := dbCache.GetTargets(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storedTargets).To(HaveLen(20))
+		})
+	})
+
+	Describe("Cancellation", func() {
+		BeforeEach(func() {
+			err := dbCache.StoreOrganizations(ctx, organizations)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should not store anything when the context is cancelled", func() {
+			cancelledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+
+			err := dbCache.StoreTargets(cancelledCtx, "org-id-1", targets)
+			Expect(err).To(HaveOccurred())
+
+			storedTargets, err := dbCache.GetTargets(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storedTargets).To(BeEmpty())
+
+			expired, err := dbCache.IsTargetsCacheExpired(ctx, "org-id-1", 24*time.Hour)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(expired).To(BeTrue())
+		})
+	})
+
 	Describe("ResetCache", func() {
 		BeforeEach(func() {
 			// Store some data first
-			err := dbCache.StoreOrganizations(organizations)
+			err := dbCache.StoreOrganizations(ctx, organizations)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Store targets
-			err = dbCache.StoreTargets("org-id-1", targets)
+			err = dbCache.StoreTargets(ctx, "org-id-1", targets)
+			Expect(err).NotTo(HaveOccurred())
+
+			// Store groups
+			err = dbCache.StoreGroups(ctx, []api.Group{{ID: "group-id-1", Name: "Group 1", Slug: "group-1"}})
 			Expect(err).NotTo(HaveOccurred())
 
 			// Verify data is stored
-			storedOrgs, err := dbCache.GetOrganizations()
+			storedOrgs, err := dbCache.GetOrganizations(ctx)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(storedOrgs).To(HaveLen(2))
 
-			storedTargets, err := dbCache.GetTargets()
+			storedTargets, err := dbCache.GetTargets(ctx)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(storedTargets).To(HaveLen(2))
 		})
 
 		It("should clear all cached data", func() {
 			// Reset the cache
-			err := dbCache.ResetCache()
+			err := dbCache.ResetCache(ctx)
 			Expect(err).NotTo(HaveOccurred())
 
 			// Verify data is cleared
-			orgs, err := dbCache.GetOrganizations()
+			orgs, err := dbCache.GetOrganizations(ctx)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(orgs).To(BeEmpty())
 
-			targets, err := dbCache.GetTargets()
+			targets, err := dbCache.GetTargets(ctx)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(targets).To(BeEmpty())
+
+			groups, err := dbCache.GetGroups(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(groups).To(BeEmpty())
+		})
+
+		It("should clear cached HTTP responses", func() {
+			Expect(dbCache.StoreResponse(ctx, "https://api.snyk.io/rest/orgs", &api.CachedResponse{ETag: `"1"`})).To(Succeed())
+
+			Expect(dbCache.ResetCache(ctx)).To(Succeed())
+
+			resp, err := dbCache.GetResponse(ctx, "https://api.snyk.io/rest/orgs")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp).To(BeNil())
 		})
 	})
 })
@@ -1,18 +1,27 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"time"
 )
 
 // ExecCommand is a variable that can be overridden for testing
-var ExecCommand = exec.Command
+var ExecCommand = exec.CommandContext
+
+// interruptGracePeriod is how long a Snyk command gets to exit after being
+// interrupted before it is killed
+const interruptGracePeriod = 5 * time.Second
 
 // SnykExecutor executes Snyk CLI commands
 type SnykExecutor struct {
 	// The organization ID to use for Snyk commands
 	OrgID string
+	// Env holds extra environment variables for Snyk commands, in the form
+	// "key=value", such as the token when it isn't kept in the Snyk config
+	Env []string
 }
 
 // NewSnykExecutor creates a new Snyk executor
@@ -22,14 +31,22 @@ func NewSnykExecutor(orgID string) *SnykExecutor {
 	}
 }
 
-// Execute runs a Snyk command with the configured organization
-func (e *SnykExecutor) Execute(args []string) error {
+// Execute runs a Snyk command with the configured organization. Cancelling the
+// context interrupts the command.
+func (e *SnykExecutor) Execute(ctx context.Context, args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("no arguments provided")
 	}
 
 	// Create the command to execute
-	cmd := ExecCommand("snyk", args...)
+	cmd := ExecCommand(ctx, "snyk", args...)
+
+	// Interrupt rather than kill the command when the context is cancelled,
+	// so Snyk gets a chance to clean up
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = interruptGracePeriod
 
 	// Copy the current environment
 	env := os.Environ()
@@ -38,6 +55,7 @@ func (e *SnykExecutor) Execute(args []string) error {
 	if e.OrgID != "" {
 		env = append(env, fmt.Sprintf("SNYK_CFG_ORG=%s", e.OrgID))
 	}
+	env = append(env, e.Env...)
 	cmd.Env = env
 
 	// Connect standard I/O
@@ -1,8 +1,10 @@
 package cmd_test
 
 import (
+	"context"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -26,11 +28,19 @@ var _ = Describe("SnykExecutor", func() {
 	})
 
 	It("should return an error when no arguments are provided", func() {
-		err := executor.Execute([]string{})
+		err := executor.Execute(context.Background(), []string{})
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("no arguments provided"))
 	})
 
+	It("should not start the command when the context is already cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := executor.Execute(ctx, []string{"--version"})
+		Expect(err).To(HaveOccurred())
+	})
+
 	Context("when setting environment variables", func() {
 		It("should set the SNYK_CFG_ORG environment variable", func() {
 			// Skip in CI environments
@@ -50,6 +60,26 @@ var _ = Describe("SnykExecutor", func() {
 		})
 	})
 
+	Context("when passing extra environment variables", func() {
+		AfterEach(func() {
+			cmd.ExecCommand = exec.CommandContext
+		})
+
+		It("should add them to the environment of the Snyk command", func() {
+			out := filepath.Join(GinkgoT().TempDir(), "env")
+			cmd.ExecCommand = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+				return exec.CommandContext(ctx, "sh", "-c", `printf '%s %s' "$SNYK_CFG_ORG" "$SNYK_OAUTH_TOKEN" > "$1"`, "sh", out)
+			}
+
+			executor.Env = []string{"SNYK_OAUTH_TOKEN=oauth-token"}
+			Expect(executor.Execute(context.Background(), []string{"test"})).To(Succeed())
+
+			data, err := os.ReadFile(out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal(orgID + " oauth-token"))
+		})
+	})
+
 	Context("when executing Snyk commands", func() {
 		It("should pass arguments to the Snyk CLI", func() {
 			// This test would require either mocking exec.Command or actually running Snyk
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
@@ -55,8 +56,8 @@ func NormalizeRepoURL(url string) (string, error) {
 
 // GetGitRemoteURL returns the URL of the git remote named 'origin'
 // from the current working directory
-func GetGitRemoteURL() (string, error) {
-	cmd := exec.Command("git", "remote", "get-url", "origin")
+func GetGitRemoteURL(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "remote", "get-url", "origin")
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -72,3 +73,18 @@ func GetGitRemoteURL() (string, error) {
 
 	return NormalizeRepoURL(url)
 }
+
+// GetGitPrefix returns the path of the current working directory relative to
+// the root of the git repository, with a trailing slash unless it is the root
+func GetGitPrefix(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--show-prefix")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to get git prefix: %w, stderr: %s", err, stderr.String())
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -2,13 +2,55 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
+	"github.com/z4ce/snyk-auto-org/internal/logging"
 )
 
+// Target lookup modes used when resolving an organization from a Git URL
+const (
+	// TargetLookupFiltered asks each organization only for targets matching the
+	// URL unless its complete list of targets is already cached
+	TargetLookupFiltered = "filtered"
+	// TargetLookupFull downloads and caches every target of each organization
+	TargetLookupFull = "full"
+)
+
+// Token storage backends for the OAuth token
+const (
+	// TokenStorageSnyk keeps the OAuth token in the Snyk CLI configuration
+	TokenStorageSnyk = "snyk"
+	// TokenStorageEncrypted keeps the OAuth token in an encrypted file in the
+	// snyk-auto-org configuration directory
+	TokenStorageEncrypted = "encrypted"
+)
+
+// Backends for the key of the encrypted token file
+const (
+	// SecretBackendKeyring keeps the key in the OS keyring
+	SecretBackendKeyring = "keyring"
+	// SecretBackendFile keeps the key in a file next to the token, which only
+	// obfuscates the token
+	SecretBackendFile = "file"
+)
+
+// DefaultReadOnlyRoles are the Snyk organization roles that can't create
+// projects unless read_only_roles says otherwise
+var DefaultReadOnlyRoles = []string{"Org Viewer", "Org Read Only"}
+
+// Resources whose REST API version can be set in rest_versions
+var restVersionResources = []string{"orgs", "groups", "targets", "projects", "self"}
+
+// restVersionPattern matches REST API versions such as 2024-10-15 or 2024-10-15~beta
+var restVersionPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(~(beta|experimental))?$`)
+
 // Config represents the application configuration
 type Config struct {
 	// CacheTTL is the time-to-live for cached data
@@ -17,6 +59,71 @@ type Config struct {
 	DefaultOrg string
 	// Verbose enables verbose logging
 	Verbose bool
+	// RetryMaxAttempts is the maximum number of attempts per Snyk API request
+	RetryMaxAttempts int
+	// RetryMaxWait is the total time budget for retrying a Snyk API request
+	RetryMaxWait time.Duration
+	// Concurrency is the number of organizations scanned for targets in parallel
+	Concurrency int
+	// TargetLookup is how targets are looked up when resolving a Git URL
+	TargetLookup string
+	// Group restricts the candidate organizations to a Snyk group, by ID, name or slug
+	Group string
+	// APIURL is the API URL of the Snyk instance, such as https://api.eu.snyk.io
+	APIURL string
+	// TokenStorage is where the OAuth token is stored
+	TokenStorage string
+	// SecretBackend is where the key of the encrypted token file is stored
+	SecretBackend string
+	// HTTPTimeout is the time limit of a single Snyk API request
+	HTTPTimeout time.Duration
+	// CACert is a PEM file of extra CA certificates to trust, such as that of
+	// a TLS-intercepting proxy
+	CACert string
+	// ClientCert and ClientKey are the PEM files of a client certificate to
+	// present to the Snyk API
+	ClientCert string
+	ClientKey  string
+	// RestVersion is the Snyk REST API version to use, the built-in one if empty
+	RestVersion string
+	// RestVersions are the REST API versions of single resources (orgs,
+	// groups, targets and projects), overriding RestVersion
+	RestVersions map[string]string
+	// LogLevel is the minimum level of messages written to the log file
+	LogLevel slog.Level
+	// LogFormat is the format of the log file, logging.FormatText or logging.FormatJSON
+	LogFormat string
+	// LogMaxSize is the size in megabytes at which the log file is rotated
+	LogMaxSize int
+	// LogMaxBackups is the number of rotated log files kept
+	LogMaxBackups int
+	// ReadOnlyRoles are the organization roles that can't create projects,
+	// avoided when resolving an organization for snyk monitor
+	ReadOnlyRoles []string
+	// OAuthClientID and OAuthClientSecret are the OAuth client of a Snyk
+	// service account to authenticate as with the client credentials grant
+	OAuthClientID     string
+	OAuthClientSecret string
+}
+
+// Dir returns the snyk-auto-org configuration directory, ~/.config/snyk-auto-org
+func Dir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".config", "snyk-auto-org"), nil
+}
+
+// LogDir returns the directory of the log files, ~/.config/snyk-auto-org/logs
+func LogDir() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "logs"), nil
 }
 
 // LoadConfig loads the configuration from the default location
@@ -25,19 +132,37 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("cache_ttl", "24h")
 	viper.SetDefault("default_org", "")
 	viper.SetDefault("verbose", false)
+	viper.SetDefault("retry_max_attempts", 5)
+	viper.SetDefault("retry_max_wait", "2m")
+	viper.SetDefault("concurrency", 8)
+	viper.SetDefault("target_lookup", TargetLookupFiltered)
+	viper.SetDefault("group", "")
+	viper.SetDefault("api_url", "")
+	viper.SetDefault("token_storage", TokenStorageSnyk)
+	viper.SetDefault("secret_backend", SecretBackendKeyring)
+	viper.SetDefault("http_timeout", "10s")
+	viper.SetDefault("ca_cert", "")
+	viper.SetDefault("client_cert", "")
+	viper.SetDefault("client_key", "")
+	viper.SetDefault("rest_version", "")
+	viper.SetDefault("rest_versions", map[string]string{})
+	viper.SetDefault("log_level", "info")
+	viper.SetDefault("log_format", logging.FormatText)
+	viper.SetDefault("log_max_size", 10)
+	viper.SetDefault("log_max_backups", 3)
+	viper.SetDefault("read_only_roles", DefaultReadOnlyRoles)
+	viper.SetDefault("oauth_client_id", "")
+	viper.SetDefault("oauth_client_secret", "")
 
 	// Set configuration file name and location
 	viper.SetConfigName("config")
 	viper.SetConfigType("json")
 
-	// Get user's home directory
-	homeDir, err := os.UserHomeDir()
+	// Add the config directory to the search path
+	configDir, err := Dir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+		return nil, err
 	}
-
-	// Add the config directory to the search path
-	configDir := filepath.Join(homeDir, ".config", "snyk-auto-org")
 	viper.AddConfigPath(configDir)
 
 	// Create the config directory if it doesn't exist
@@ -65,11 +190,115 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("invalid cache TTL: %w", err)
 	}
 
+	// Parse the retry time budget
+	retryMaxWait, err := time.ParseDuration(viper.GetString("retry_max_wait"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry max wait: %w", err)
+	}
+
+	// Parse the request timeout
+	httpTimeout, err := time.ParseDuration(viper.GetString("http_timeout"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTP timeout: %w", err)
+	}
+
+	// A client certificate needs both its certificate and key
+	clientCert, clientKey := viper.GetString("client_cert"), viper.GetString("client_key")
+	if (clientCert == "") != (clientKey == "") {
+		return nil, fmt.Errorf("client_cert and client_key must be set together")
+	}
+
+	// A service account's OAuth client needs both its ID and secret
+	oauthClientID, oauthClientSecret := viper.GetString("oauth_client_id"), viper.GetString("oauth_client_secret")
+	if (oauthClientID == "") != (oauthClientSecret == "") {
+		return nil, fmt.Errorf("oauth_client_id and oauth_client_secret must be set together")
+	}
+
+	// Validate the target lookup mode
+	targetLookup := viper.GetString("target_lookup")
+	if targetLookup == "" {
+		targetLookup = TargetLookupFiltered
+	}
+	if targetLookup != TargetLookupFiltered && targetLookup != TargetLookupFull {
+		return nil, fmt.Errorf("invalid target lookup mode: %s (must be %q or %q)", targetLookup, TargetLookupFiltered, TargetLookupFull)
+	}
+
+	// Validate the token storage backend
+	tokenStorage := viper.GetString("token_storage")
+	if tokenStorage == "" {
+		tokenStorage = TokenStorageSnyk
+	}
+	if tokenStorage != TokenStorageSnyk && tokenStorage != TokenStorageEncrypted {
+		return nil, fmt.Errorf("invalid token storage: %s (must be %q or %q)", tokenStorage, TokenStorageSnyk, TokenStorageEncrypted)
+	}
+
+	// Validate the secret backend
+	secretBackend := viper.GetString("secret_backend")
+	if secretBackend == "" {
+		secretBackend = SecretBackendKeyring
+	}
+	if secretBackend != SecretBackendKeyring && secretBackend != SecretBackendFile {
+		return nil, fmt.Errorf("invalid secret backend: %s (must be %q or %q)", secretBackend, SecretBackendKeyring, SecretBackendFile)
+	}
+
+	// Validate the REST API versions
+	restVersion := viper.GetString("rest_version")
+	if restVersion != "" {
+		if err := ValidateRestVersion(restVersion); err != nil {
+			return nil, err
+		}
+	}
+	restVersions := viper.GetStringMapString("rest_versions")
+	for resource, version := range restVersions {
+		if !slices.Contains(restVersionResources, resource) {
+			return nil, fmt.Errorf("invalid rest_versions resource: %s (must be one of %v)", resource, restVersionResources)
+		}
+		if err := ValidateRestVersion(version); err != nil {
+			return nil, err
+		}
+	}
+
+	// Parse the log level
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(viper.GetString("log_level"))); err != nil {
+		return nil, fmt.Errorf("invalid log level: %s (must be \"debug\", \"info\", \"warn\" or \"error\")", viper.GetString("log_level"))
+	}
+
+	// Validate the log format
+	logFormat := viper.GetString("log_format")
+	if logFormat == "" {
+		logFormat = logging.FormatText
+	}
+	if logFormat != logging.FormatText && logFormat != logging.FormatJSON {
+		return nil, fmt.Errorf("invalid log format: %s (must be %q or %q)", logFormat, logging.FormatText, logging.FormatJSON)
+	}
+
 	// Create and return the config
 	return &Config{
-		CacheTTL:   cacheTTL,
-		DefaultOrg: viper.GetString("default_org"),
-		Verbose:    viper.GetBool("verbose"),
+		CacheTTL:          cacheTTL,
+		DefaultOrg:        viper.GetString("default_org"),
+		Verbose:           viper.GetBool("verbose"),
+		RetryMaxAttempts:  viper.GetInt("retry_max_attempts"),
+		RetryMaxWait:      retryMaxWait,
+		Concurrency:       viper.GetInt("concurrency"),
+		TargetLookup:      targetLookup,
+		Group:             viper.GetString("group"),
+		APIURL:            viper.GetString("api_url"),
+		TokenStorage:      tokenStorage,
+		SecretBackend:     secretBackend,
+		HTTPTimeout:       httpTimeout,
+		CACert:            viper.GetString("ca_cert"),
+		ClientCert:        clientCert,
+		ClientKey:         clientKey,
+		RestVersion:       restVersion,
+		RestVersions:      restVersions,
+		LogLevel:          logLevel,
+		LogFormat:         logFormat,
+		LogMaxSize:        viper.GetInt("log_max_size"),
+		LogMaxBackups:     viper.GetInt("log_max_backups"),
+		ReadOnlyRoles:     viper.GetStringSlice("read_only_roles"),
+		OAuthClientID:     oauthClientID,
+		OAuthClientSecret: oauthClientSecret,
 	}, nil
 }
 
@@ -78,6 +307,36 @@ func SaveConfig(cfg *Config) error {
 	viper.Set("cache_ttl", cfg.CacheTTL.String())
 	viper.Set("default_org", cfg.DefaultOrg)
 	viper.Set("verbose", cfg.Verbose)
+	viper.Set("retry_max_attempts", cfg.RetryMaxAttempts)
+	viper.Set("retry_max_wait", cfg.RetryMaxWait.String())
+	viper.Set("concurrency", cfg.Concurrency)
+	viper.Set("target_lookup", cfg.TargetLookup)
+	viper.Set("group", cfg.Group)
+	viper.Set("api_url", cfg.APIURL)
+	viper.Set("token_storage", cfg.TokenStorage)
+	viper.Set("secret_backend", cfg.SecretBackend)
+	viper.Set("http_timeout", cfg.HTTPTimeout.String())
+	viper.Set("ca_cert", cfg.CACert)
+	viper.Set("client_cert", cfg.ClientCert)
+	viper.Set("client_key", cfg.ClientKey)
+	viper.Set("rest_version", cfg.RestVersion)
+	viper.Set("rest_versions", cfg.RestVersions)
+	viper.Set("log_level", strings.ToLower(cfg.LogLevel.String()))
+	viper.Set("log_format", cfg.LogFormat)
+	viper.Set("log_max_size", cfg.LogMaxSize)
+	viper.Set("log_max_backups", cfg.LogMaxBackups)
+	viper.Set("read_only_roles", cfg.ReadOnlyRoles)
+	viper.Set("oauth_client_id", cfg.OAuthClientID)
+	viper.Set("oauth_client_secret", cfg.OAuthClientSecret)
 
 	return viper.WriteConfig()
 }
+
+// ValidateRestVersion checks that version is a Snyk REST API version, a date
+// such as 2024-10-15 optionally followed by ~beta or ~experimental
+func ValidateRestVersion(version string) error {
+	if !restVersionPattern.MatchString(version) {
+		return fmt.Errorf("invalid REST API version: %s (must be a date such as 2024-10-15)", version)
+	}
+	return nil
+}
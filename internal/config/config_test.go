@@ -2,6 +2,7 @@ package config_test
 
 import (
 	"encoding/json"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"time"
@@ -10,6 +11,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/spf13/viper"
 	"github.com/z4ce/snyk-auto-org/internal/config"
+	"github.com/z4ce/snyk-auto-org/internal/logging"
 )
 
 var _ = Describe("Config", func() {
@@ -54,6 +56,20 @@ var _ = Describe("Config", func() {
 				Expect(cfg.CacheTTL).To(Equal(24 * time.Hour))
 				Expect(cfg.DefaultOrg).To(Equal(""))
 				Expect(cfg.Verbose).To(BeFalse())
+				Expect(cfg.RetryMaxAttempts).To(Equal(5))
+				Expect(cfg.RetryMaxWait).To(Equal(2 * time.Minute))
+				Expect(cfg.TargetLookup).To(Equal(config.TargetLookupFiltered))
+				Expect(cfg.Group).To(BeEmpty())
+				Expect(cfg.APIURL).To(BeEmpty())
+				Expect(cfg.TokenStorage).To(Equal(config.TokenStorageSnyk))
+				Expect(cfg.SecretBackend).To(Equal(config.SecretBackendKeyring))
+				Expect(cfg.HTTPTimeout).To(Equal(10 * time.Second))
+				Expect(cfg.CACert).To(BeEmpty())
+				Expect(cfg.LogLevel).To(Equal(slog.LevelInfo))
+				Expect(cfg.LogFormat).To(Equal(logging.FormatText))
+				Expect(cfg.LogMaxSize).To(Equal(10))
+				Expect(cfg.LogMaxBackups).To(Equal(3))
+				Expect(cfg.ReadOnlyRoles).To(Equal(config.DefaultReadOnlyRoles))
 
 				// Verify the config file was created
 				configFile := filepath.Join(configDir, "config.json")
@@ -121,6 +137,152 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Context("when the config file contains an invalid target lookup mode", func() {
+		BeforeEach(func() {
+			configFile := filepath.Join(configDir, "config.json")
+			content := `{
+				"cache_ttl": "24h",
+				"target_lookup": "sometimes"
+			}`
+			err := os.WriteFile(configFile, []byte(content), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should return an error", func() {
+			cfg, err := config.LoadConfig()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid target lookup mode"))
+			Expect(cfg).To(BeNil())
+		})
+	})
+
+	Context("when the config file contains an invalid token storage", func() {
+		BeforeEach(func() {
+			configFile := filepath.Join(configDir, "config.json")
+			content := `{
+				"cache_ttl": "24h",
+				"token_storage": "keychain"
+			}`
+			err := os.WriteFile(configFile, []byte(content), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should return an error", func() {
+			cfg, err := config.LoadConfig()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid token storage"))
+			Expect(cfg).To(BeNil())
+		})
+	})
+
+	Context("when the config file has a client certificate without a key", func() {
+		BeforeEach(func() {
+			configFile := filepath.Join(configDir, "config.json")
+			content := `{
+				"cache_ttl": "24h",
+				"client_cert": "/etc/snyk/client.pem"
+			}`
+			err := os.WriteFile(configFile, []byte(content), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should return an error", func() {
+			cfg, err := config.LoadConfig()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("client_cert and client_key must be set together"))
+			Expect(cfg).To(BeNil())
+		})
+	})
+
+	Context("when the config file has an OAuth client ID without a secret", func() {
+		BeforeEach(func() {
+			configFile := filepath.Join(configDir, "config.json")
+			content := `{
+				"cache_ttl": "24h",
+				"oauth_client_id": "service-account-client"
+			}`
+			err := os.WriteFile(configFile, []byte(content), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should return an error", func() {
+			cfg, err := config.LoadConfig()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("oauth_client_id and oauth_client_secret must be set together"))
+			Expect(cfg).To(BeNil())
+		})
+	})
+
+	Context("when the config file contains an invalid log level", func() {
+		BeforeEach(func() {
+			configFile := filepath.Join(configDir, "config.json")
+			content := `{
+				"cache_ttl": "24h",
+				"log_level": "chatty"
+			}`
+			err := os.WriteFile(configFile, []byte(content), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should return an error", func() {
+			cfg, err := config.LoadConfig()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid log level"))
+			Expect(cfg).To(BeNil())
+		})
+	})
+
+	Context("when the config file sets REST API versions", func() {
+		BeforeEach(func() {
+			configFile := filepath.Join(configDir, "config.json")
+			content := `{
+				"cache_ttl": "24h",
+				"rest_version": "2024-06-21",
+				"rest_versions": {"targets": "2024-10-15~beta"}
+			}`
+			err := os.WriteFile(configFile, []byte(content), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should load them", func() {
+			cfg, err := config.LoadConfig()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cfg.RestVersion).To(Equal("2024-06-21"))
+			Expect(cfg.RestVersions).To(Equal(map[string]string{"targets": "2024-10-15~beta"}))
+		})
+	})
+
+	Context("when the config file sets the REST API version of an unknown resource", func() {
+		BeforeEach(func() {
+			configFile := filepath.Join(configDir, "config.json")
+			content := `{
+				"cache_ttl": "24h",
+				"rest_versions": {"issues": "2024-10-15"}
+			}`
+			err := os.WriteFile(configFile, []byte(content), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should return an error", func() {
+			cfg, err := config.LoadConfig()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid rest_versions resource"))
+			Expect(cfg).To(BeNil())
+		})
+	})
+
+	Describe("ValidateRestVersion", func() {
+		It("should accept dated versions with an optional stability", func() {
+			Expect(config.ValidateRestVersion("2024-10-15")).To(Succeed())
+			Expect(config.ValidateRestVersion("2024-10-15~experimental")).To(Succeed())
+		})
+
+		It("should reject anything else", func() {
+			Expect(config.ValidateRestVersion("latest")).To(MatchError(ContainSubstring("invalid REST API version")))
+			Expect(config.ValidateRestVersion("2024-10-15~ga")).To(HaveOccurred())
+		})
+	})
+
 	Describe("SaveConfig", func() {
 		It("should save the configuration to disk", func() {
 			// Create a configuration
@@ -0,0 +1,111 @@
+// Package logging sets up the leveled, structured log of snyk-auto-org, which
+// is written to a rotating file so that nothing reaches the standard output of
+// the wrapped Snyk command.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+)
+
+// Formats of the log file
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// FileName is the name of the log file in its directory
+const FileName = "snyk-auto-org.log"
+
+// Options configures the logger created by New
+type Options struct {
+	// Dir is the directory of the log file
+	Dir string
+	// Level is the minimum level of messages written to the log file
+	Level slog.Level
+	// Format is FormatText or FormatJSON
+	Format string
+	// MaxSize is the size in bytes at which the log file is rotated
+	MaxSize int64
+	// MaxBackups is the number of rotated log files kept
+	MaxBackups int
+	// Console, such as os.Stderr, also receives the messages at ConsoleLevel
+	// and above in text format, if set
+	Console      io.Writer
+	ConsoleLevel slog.Level
+}
+
+// New creates a logger writing to the log file in opts.Dir, and to
+// opts.Console if set. The returned io.Closer closes the log file.
+func New(opts Options) (*slog.Logger, io.Closer, error) {
+	file := NewRotatingFile(filepath.Join(opts.Dir, FileName), opts.MaxSize, opts.MaxBackups)
+
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+	var handler slog.Handler
+	switch opts.Format {
+	case FormatText, "":
+		handler = slog.NewTextHandler(file, handlerOpts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(file, handlerOpts)
+	default:
+		return nil, nil, fmt.Errorf("invalid log format: %s (must be %q or %q)", opts.Format, FormatText, FormatJSON)
+	}
+
+	if opts.Console != nil {
+		console := slog.NewTextHandler(opts.Console, &slog.HandlerOptions{
+			Level: opts.ConsoleLevel,
+			// The time is only interesting in the log file
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})
+		handler = multiHandler{handler, console}
+	}
+
+	return slog.New(handler), file, nil
+}
+
+// multiHandler passes each record to every handler enabled for its level
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
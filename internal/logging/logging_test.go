@@ -0,0 +1,134 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/logging"
+)
+
+var _ = Describe("New", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	readLog := func() string {
+		data, err := os.ReadFile(filepath.Join(dir, logging.FileName))
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	It("writes messages at the level and above to the log file", func() {
+		logger, file, err := logging.New(logging.Options{Dir: dir, Level: slog.LevelInfo})
+		Expect(err).NotTo(HaveOccurred())
+
+		logger.Debug("request", "url", "https://api.snyk.io/rest/orgs")
+		logger.Info("Using Snyk API", "url", "https://api.snyk.io")
+		Expect(file.Close()).To(Succeed())
+
+		content := readLog()
+		Expect(content).To(ContainSubstring(`msg="Using Snyk API" url=https://api.snyk.io`))
+		Expect(content).NotTo(ContainSubstring("request"))
+	})
+
+	It("writes JSON", func() {
+		logger, file, err := logging.New(logging.Options{Dir: dir, Format: logging.FormatJSON})
+		Expect(err).NotTo(HaveOccurred())
+
+		logger.Info("Synced targets", "targets", 3)
+		Expect(file.Close()).To(Succeed())
+
+		var record map[string]interface{}
+		Expect(json.Unmarshal([]byte(readLog()), &record)).To(Succeed())
+		Expect(record).To(HaveKeyWithValue("msg", "Synced targets"))
+		Expect(record).To(HaveKeyWithValue("targets", BeNumerically("==", 3)))
+	})
+
+	It("rejects unknown formats", func() {
+		_, _, err := logging.New(logging.Options{Dir: dir, Format: "xml"})
+		Expect(err).To(MatchError(ContainSubstring("invalid log format")))
+	})
+
+	It("also writes messages at the console level and above to the console", func() {
+		var console bytes.Buffer
+		logger, file, err := logging.New(logging.Options{
+			Dir:          dir,
+			Level:        slog.LevelDebug,
+			Console:      &console,
+			ConsoleLevel: slog.LevelWarn,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		logger.With("org", "Organization 1").Info("Fetching targets")
+		logger.With("org", "Organization 1").Warn("Failed to sync targets")
+		Expect(file.Close()).To(Succeed())
+
+		Expect(console.String()).To(Equal("level=WARN msg=\"Failed to sync targets\" org=\"Organization 1\"\n"))
+		Expect(strings.Count(readLog(), "\n")).To(Equal(2))
+	})
+})
+
+var _ = Describe("RotatingFile", func() {
+	var (
+		dir  string
+		path string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		path = filepath.Join(dir, "logs", "test.log")
+	})
+
+	read := func(path string) string {
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	It("creates the file and its directory", func() {
+		file := logging.NewRotatingFile(path, 100, 2)
+		_, err := file.Write([]byte("first\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+
+		Expect(read(path)).To(Equal("first\n"))
+		info, err := os.Stat(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("rotates the file when it would grow too large, keeping the backups", func() {
+		file := logging.NewRotatingFile(path, 10, 2)
+		for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+			_, err := file.Write([]byte(line))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(file.Close()).To(Succeed())
+
+		Expect(read(path)).To(Equal("line 4\n"))
+		Expect(read(path + ".1")).To(Equal("line 3\n"))
+		Expect(read(path + ".2")).To(Equal("line 2\n"))
+		Expect(path + ".3").NotTo(BeAnExistingFile())
+	})
+
+	It("appends to an existing file, counting its size", func() {
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(os.WriteFile(path, []byte("previous run\n"), 0600)).To(Succeed())
+
+		file := logging.NewRotatingFile(path, 20, 1)
+		_, err := file.Write([]byte("this run\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+
+		Expect(read(path)).To(Equal("this run\n"))
+		Expect(read(path + ".1")).To(Equal("previous run\n"))
+	})
+})
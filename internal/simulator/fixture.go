@@ -0,0 +1,206 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture describes the Snyk tenant served by a Server
+type Fixture struct {
+	Groups []Group `yaml:"groups"`
+	Orgs   []Org   `yaml:"orgs"`
+	// Users are the users the tokens of the server belong to
+	Users []User `yaml:"users"`
+	// Tokens are the API tokens the server accepts, in addition to those of
+	// the users and the access tokens it issues. Any token is accepted if
+	// there are none, belonging to DefaultUser unless it is a user's.
+	Tokens []string `yaml:"tokens"`
+	// Clients are the OAuth clients of service accounts, which get access
+	// tokens with the client credentials grant
+	Clients []Client `yaml:"clients"`
+	// Faults are the errors the server answers matching requests with
+	Faults []Fault `yaml:"faults"`
+}
+
+// User is a Snyk user of a Fixture
+type User struct {
+	ID       string `yaml:"id"`
+	Name     string `yaml:"name"`
+	Username string `yaml:"username"`
+	Email    string `yaml:"email"`
+	// Token is an API token of the user
+	Token string `yaml:"token"`
+}
+
+// Client is the OAuth client of a Snyk service account of a Fixture
+type Client struct {
+	ID     string `yaml:"id"`
+	Secret string `yaml:"secret"`
+}
+
+// Group is a Snyk group of a Fixture
+type Group struct {
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+	Slug string `yaml:"slug"`
+}
+
+// Org is a Snyk organization of a Fixture with its targets
+type Org struct {
+	ID      string `yaml:"id"`
+	Name    string `yaml:"name"`
+	Slug    string `yaml:"slug"`
+	GroupID string `yaml:"group_id"`
+	// Role is the role of the authenticated user in the organization, such as
+	// Org Admin or Org Viewer, served when member_role is expanded
+	Role    string   `yaml:"role"`
+	Targets []Target `yaml:"targets"`
+}
+
+// Target is a Snyk target of an Org with its projects
+type Target struct {
+	ID              string    `yaml:"id"`
+	DisplayName     string    `yaml:"display_name"`
+	URL             string    `yaml:"url"`
+	IntegrationType string    `yaml:"integration_type"`
+	IsPrivate       bool      `yaml:"is_private"`
+	CreatedAt       time.Time `yaml:"created_at"`
+	Projects        []Project `yaml:"projects"`
+}
+
+// Project is a Snyk project of a Target
+type Project struct {
+	ID              string `yaml:"id"`
+	Name            string `yaml:"name"`
+	Type            string `yaml:"type"`
+	Status          string `yaml:"status"`
+	Origin          string `yaml:"origin"`
+	TargetFile      string `yaml:"target_file"`
+	TargetReference string `yaml:"target_reference"`
+}
+
+// Fault makes the server answer matching requests with an error status
+type Fault struct {
+	// Path is a pattern, as accepted by path.Match, of the paths of the
+	// requests to fail, such as /rest/orgs/*/targets. Empty matches every request.
+	Path string `yaml:"path"`
+	// Status is the error status, such as 401, 429 or 503
+	Status int `yaml:"status"`
+	// Times is the number of requests to fail, every matching request if 0
+	Times int `yaml:"times"`
+	// RetryAfter is the Retry-After header of the response in seconds, if set
+	RetryAfter int `yaml:"retry_after"`
+}
+
+// LoadFixture reads a Fixture from a YAML file
+func LoadFixture(file string) (*Fixture, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	var fixture Fixture
+	if err := yaml.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", file, err)
+	}
+
+	if err := fixture.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", file, err)
+	}
+	return &fixture, nil
+}
+
+// Validate checks that the IDs of the fixture are unique, that organizations
+// belong to known groups and that faults are errors
+func (f *Fixture) Validate() error {
+	ids := map[string]bool{}
+	unique := func(kind, id string) error {
+		if id == "" {
+			return fmt.Errorf("%s without an id", kind)
+		}
+		if ids[id] {
+			return fmt.Errorf("duplicate id: %s", id)
+		}
+		ids[id] = true
+		return nil
+	}
+
+	for _, user := range f.Users {
+		if err := unique("user", user.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, client := range f.Clients {
+		if err := unique("client", client.ID); err != nil {
+			return err
+		}
+		if client.Secret == "" {
+			return fmt.Errorf("client %s without a secret", client.ID)
+		}
+	}
+
+	groups := map[string]bool{}
+	for _, group := range f.Groups {
+		if err := unique("group", group.ID); err != nil {
+			return err
+		}
+		groups[group.ID] = true
+	}
+
+	for _, org := range f.Orgs {
+		if err := unique("org", org.ID); err != nil {
+			return err
+		}
+		if org.GroupID != "" && !groups[org.GroupID] {
+			return fmt.Errorf("org %s belongs to unknown group: %s", org.ID, org.GroupID)
+		}
+		for _, target := range org.Targets {
+			if err := unique("target", target.ID); err != nil {
+				return err
+			}
+			for _, project := range target.Projects {
+				if err := unique("project", project.ID); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, fault := range f.Faults {
+		if fault.Status < http.StatusBadRequest || fault.Status > 599 {
+			return fmt.Errorf("invalid fault status: %d (must be between 400 and 599)", fault.Status)
+		}
+		if _, err := path.Match(fault.Path, "/"); err != nil {
+			return fmt.Errorf("invalid fault path: %s", fault.Path)
+		}
+	}
+
+	return nil
+}
+
+// acceptedTokens returns the API tokens of the fixture and its users
+func (f *Fixture) acceptedTokens() []string {
+	tokens := append([]string{}, f.Tokens...)
+	for _, user := range f.Users {
+		if user.Token != "" {
+			tokens = append(tokens, user.Token)
+		}
+	}
+	return tokens
+}
+
+// validClient reports whether a client ID and secret are those of a client
+func (f *Fixture) validClient(id string, secret string) bool {
+	for _, client := range f.Clients {
+		if client.ID == id && client.Secret == secret {
+			return true
+		}
+	}
+	return false
+}
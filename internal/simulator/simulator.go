@@ -0,0 +1,553 @@
+// Package simulator implements a fake Snyk REST and OAuth2 API serving the
+// organizations, groups, targets and projects of a Fixture, to exercise
+// snyk-auto-org end-to-end without a real Snyk tenant.
+package simulator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pagination limits of the REST API
+const (
+	DefaultPageLimit = 10
+	MaxPageLimit     = 100
+)
+
+// DefaultUser is the user of tokens that don't belong to a user of the fixture
+var DefaultUser = User{ID: "simulated-user", Name: "Simulated User", Username: "simulated"}
+
+// AccessTokenLifetime is how long the access tokens issued by the server are valid
+const AccessTokenLifetime = time.Hour
+
+// Server is an http.Handler simulating the Snyk REST API at /rest and its
+// OAuth2 endpoints at /oauth2, so that an api_url of its address points
+// snyk-auto-org at it
+type Server struct {
+	fixture *Fixture
+	mux     *http.ServeMux
+
+	mu       sync.Mutex
+	faults   []*fault
+	tokens   map[string]bool // Access tokens issued by the server
+	refresh  map[string]bool // Refresh tokens issued by the server
+	codes    map[string]authorization
+	issued   int
+	requests int
+}
+
+// authorization is a pending authorization code request, answered with a
+// code that can be exchanged for a token once
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+}
+
+// fault is a Fault with the number of requests it still fails
+type fault struct {
+	Fault
+	remaining int
+}
+
+// New creates a Server for a fixture
+func New(fixture *Fixture) *Server {
+	s := &Server{
+		fixture: fixture,
+		mux:     http.NewServeMux(),
+		tokens:  map[string]bool{},
+		refresh: map[string]bool{},
+		codes:   map[string]authorization{},
+	}
+	for _, f := range fixture.Faults {
+		s.InjectFault(f)
+	}
+
+	s.mux.HandleFunc("GET /rest/self", s.authenticated(s.handleSelf))
+	s.mux.HandleFunc("GET /rest/orgs", s.authenticated(s.handleOrgs))
+	s.mux.HandleFunc("GET /rest/groups", s.authenticated(s.handleGroups))
+	s.mux.HandleFunc("GET /rest/orgs/{org_id}/targets", s.authenticated(s.handleTargets))
+	s.mux.HandleFunc("GET /rest/orgs/{org_id}/projects", s.authenticated(s.handleProjects))
+	s.mux.HandleFunc("GET /oauth2/authorize", s.handleAuthorize)
+	s.mux.HandleFunc("POST /oauth2/token", s.handleToken)
+
+	return s
+}
+
+// InjectFault makes the server answer the requests matching f with its status
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault{Fault: f, remaining: f.Times})
+}
+
+// Requests returns the number of requests the server received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// ServeHTTP answers a request, unless a fault matches it
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	w.Header().Set("snyk-request-id", fmt.Sprintf("simulated-%d", s.requests))
+	f := s.matchFault(r.URL.Path)
+	s.mu.Unlock()
+
+	if f != nil {
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(f.RetryAfter))
+		}
+		writeError(w, f.Status, "Simulated fault")
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// matchFault returns the first fault matching a request path, counting the
+// request against it. It must be called with s.mu held.
+func (s *Server) matchFault(requestPath string) *fault {
+	for _, f := range s.faults {
+		if f.Times > 0 && f.remaining == 0 {
+			continue
+		}
+		if matched, _ := path.Match(f.Path, requestPath); f.Path != "" && !matched {
+			continue
+		}
+
+		if f.Times > 0 {
+			f.remaining--
+		}
+		return f
+	}
+	return nil
+}
+
+// Serve serves the simulated API on l until ctx is done
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	server := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// authenticated rejects requests without a token the server accepts
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scheme, token := bearer(r)
+		if (!strings.EqualFold(scheme, "token") && !strings.EqualFold(scheme, "bearer")) || !s.acceptsToken(token) {
+			writeError(w, http.StatusUnauthorized, "Invalid or missing token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// bearer returns the scheme and token of the Authorization header of a request
+func bearer(r *http.Request) (string, string) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return scheme, token
+}
+
+// acceptsToken reports whether a token is one of the fixture's tokens, of its
+// users or was issued by the server, or is any token if the fixture has none
+func (s *Server) acceptsToken(token string) bool {
+	if token == "" {
+		return false
+	}
+
+	if len(s.fixture.Tokens) == 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.fixture.acceptedTokens() {
+		if t == token {
+			return true
+		}
+	}
+	return s.tokens[token]
+}
+
+// handleAuthorize approves every authorization code request with PKCE right
+// away, redirecting to the loopback redirect URI with a new code, as if the
+// user had logged in and approved the access in a browser
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme != "http" || (redirectURI.Hostname() != "127.0.0.1" && redirectURI.Hostname() != "localhost") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "The redirect_uri must be a loopback URL")
+		return
+	}
+	if query.Get("client_id") == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "The client_id parameter is required")
+		return
+	}
+
+	redirect := url.Values{}
+	redirect.Set("state", query.Get("state"))
+	switch {
+	case query.Get("response_type") != "code":
+		redirect.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		redirect.Set("error", "invalid_request")
+		redirect.Set("error_description", "PKCE with the S256 method is required")
+	default:
+		s.mu.Lock()
+		s.issued++
+		code := fmt.Sprintf("simulated-code-%d", s.issued)
+		s.codes[code] = authorization{
+			clientID:      query.Get("client_id"),
+			redirectURI:   redirectURI.String(),
+			codeChallenge: query.Get("code_challenge"),
+		}
+		s.mu.Unlock()
+		redirect.Set("code", code)
+	}
+
+	redirectURI.RawQuery = redirect.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// handleToken issues a new access and refresh token for a refresh token it
+// issued, or any refresh token if the fixture has no tokens, and for an
+// authorization code it issued with the code verifier of its request. Clients
+// of the fixture get an access token for their secret.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return
+	}
+
+	switch grantType := r.PostForm.Get("grant_type"); grantType {
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		s.mu.Lock()
+		valid := refreshToken != "" && (len(s.fixture.Tokens) == 0 || s.refresh[refreshToken])
+		// Refresh tokens are rotated
+		delete(s.refresh, refreshToken)
+		s.mu.Unlock()
+
+		if !valid {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Unknown refresh token")
+			return
+		}
+		s.writeToken(w, true)
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		s.mu.Lock()
+		auth, valid := s.codes[code]
+		// Authorization codes can only be used once
+		delete(s.codes, code)
+		s.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		switch {
+		case !valid:
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Unknown authorization code")
+		case auth.clientID != r.PostForm.Get("client_id") || auth.redirectURI != r.PostForm.Get("redirect_uri"):
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "The authorization code was issued to another client")
+		case auth.codeChallenge != base64.RawURLEncoding.EncodeToString(sum[:]):
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "The code verifier doesn't match the code challenge")
+		default:
+			s.writeToken(w, true)
+		}
+	case "client_credentials":
+		if !s.fixture.validClient(r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")) {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Unknown client or wrong secret")
+			return
+		}
+		// Service accounts get new access tokens instead of refreshing them
+		s.writeToken(w, false)
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("Unsupported grant type: %q", grantType))
+	}
+}
+
+// writeToken issues a new access token, with a refresh token if refresh is set
+func (s *Server) writeToken(w http.ResponseWriter, refresh bool) {
+	s.mu.Lock()
+	s.issued++
+	accessToken := fmt.Sprintf("simulated-access-token-%d", s.issued)
+	s.tokens[accessToken] = true
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "bearer",
+		"expires_in":   int(AccessTokenLifetime.Seconds()),
+		"scope":        "org.read",
+	}
+	if refresh {
+		refreshToken := fmt.Sprintf("simulated-refresh-token-%d", s.issued)
+		s.refresh[refreshToken] = true
+		response["refresh_token"] = refreshToken
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// resource is a JSON:API resource object
+type resource struct {
+	ID            string      `json:"id"`
+	Type          string      `json:"type"`
+	Attributes    interface{} `json:"attributes"`
+	Relationships interface{} `json:"relationships,omitempty"`
+}
+
+// relationship is a JSON:API relationship to a single resource
+type relationship struct {
+	Data resource `json:"data"`
+}
+
+// handleSelf describes the user of the request's token, DefaultUser if it
+// doesn't belong to a user of the fixture
+func (s *Server) handleSelf(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("version") == "" {
+		writeError(w, http.StatusBadRequest, "The version parameter is required")
+		return
+	}
+
+	_, token := bearer(r)
+	user := DefaultUser
+	for _, u := range s.fixture.Users {
+		if u.Token == token {
+			user = u
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonapi": map[string]string{"version": "1.0"},
+		"data": resource{
+			ID:   user.ID,
+			Type: "user",
+			Attributes: map[string]string{
+				"name":     user.Name,
+				"username": user.Username,
+				"email":    user.Email,
+			},
+		},
+	})
+}
+
+// handleOrgs lists the organizations, with the role of the user in each of
+// them if the expand parameter is member_role
+func (s *Server) handleOrgs(w http.ResponseWriter, r *http.Request) {
+	expandRole := r.URL.Query().Get("expand") == "member_role"
+	resources := make([]resource, 0, len(s.fixture.Orgs))
+	for _, org := range s.fixture.Orgs {
+		res := resource{
+			ID:   org.ID,
+			Type: "org",
+			Attributes: map[string]string{
+				"name":     org.Name,
+				"slug":     org.Slug,
+				"group_id": org.GroupID,
+			},
+		}
+		if expandRole && org.Role != "" {
+			res.Relationships = map[string]relationship{
+				"member_role": {Data: resource{
+					ID:         org.ID + "-role",
+					Type:       "org_role",
+					Attributes: map[string]string{"name": org.Role},
+				}},
+			}
+		}
+		resources = append(resources, res)
+	}
+	writePage(w, r, resources)
+}
+
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	resources := make([]resource, 0, len(s.fixture.Groups))
+	for _, group := range s.fixture.Groups {
+		resources = append(resources, resource{
+			ID:         group.ID,
+			Type:       "group",
+			Attributes: map[string]string{"name": group.Name, "slug": group.Slug},
+		})
+	}
+	writePage(w, r, resources)
+}
+
+// handleTargets lists the targets of an organization, only those with the
+// URL given by the url parameter if set
+func (s *Server) handleTargets(w http.ResponseWriter, r *http.Request) {
+	org := s.org(r.PathValue("org_id"))
+	if org == nil {
+		writeError(w, http.StatusNotFound, "Organization not found")
+		return
+	}
+
+	urlFilter := r.URL.Query().Get("url")
+	resources := []resource{}
+	for _, target := range org.Targets {
+		if urlFilter != "" && target.URL != urlFilter {
+			continue
+		}
+		resources = append(resources, resource{
+			ID:   target.ID,
+			Type: "target",
+			Attributes: map[string]interface{}{
+				"displayName": target.DisplayName,
+				"url":         target.URL,
+				"is_private":  target.IsPrivate,
+				"created_at":  target.CreatedAt,
+			},
+			Relationships: map[string]relationship{
+				"integration": {Data: resource{
+					ID:         org.ID + "-" + target.IntegrationType,
+					Type:       "integration",
+					Attributes: map[string]string{"integration_type": target.IntegrationType},
+				}},
+			},
+		})
+	}
+	writePage(w, r, resources)
+}
+
+// handleProjects lists the projects of an organization, only those of the
+// target given by the target_id parameter if set
+func (s *Server) handleProjects(w http.ResponseWriter, r *http.Request) {
+	org := s.org(r.PathValue("org_id"))
+	if org == nil {
+		writeError(w, http.StatusNotFound, "Organization not found")
+		return
+	}
+
+	targetID := r.URL.Query().Get("target_id")
+	resources := []resource{}
+	for _, target := range org.Targets {
+		if targetID != "" && target.ID != targetID {
+			continue
+		}
+		for _, project := range target.Projects {
+			resources = append(resources, resource{
+				ID:   project.ID,
+				Type: "project",
+				Attributes: map[string]string{
+					"name":             project.Name,
+					"type":             project.Type,
+					"status":           project.Status,
+					"origin":           project.Origin,
+					"target_file":      project.TargetFile,
+					"target_reference": project.TargetReference,
+				},
+				Relationships: map[string]relationship{
+					"target": {Data: resource{ID: target.ID, Type: "target"}},
+				},
+			})
+		}
+	}
+	writePage(w, r, resources)
+}
+
+// org returns the organization with an ID, or nil if there is none
+func (s *Server) org(id string) *Org {
+	for i := range s.fixture.Orgs {
+		if s.fixture.Orgs[i].ID == id {
+			return &s.fixture.Orgs[i]
+		}
+	}
+	return nil
+}
+
+// writePage writes the page of resources selected by the limit and
+// starting_after parameters, linking to the next page in links.next
+func writePage(w http.ResponseWriter, r *http.Request, resources []resource) {
+	query := r.URL.Query()
+	if query.Get("version") == "" {
+		writeError(w, http.StatusBadRequest, "The version parameter is required")
+		return
+	}
+
+	limit := DefaultPageLimit
+	if l := query.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > MaxPageLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid limit: %s (must be between 1 and %d)", l, MaxPageLimit))
+			return
+		}
+	}
+
+	start := 0
+	if after := query.Get("starting_after"); after != "" {
+		start = -1
+		for i, res := range resources {
+			if res.ID == after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid starting_after: %s", after))
+			return
+		}
+	}
+
+	end := min(start+limit, len(resources))
+	links := map[string]string{"self": r.URL.RequestURI()}
+	if end < len(resources) {
+		query.Set("starting_after", resources[end-1].ID)
+		links["next"] = r.URL.Path + "?" + query.Encode()
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonapi": map[string]string{"version": "1.0"},
+		"data":    resources[start:end],
+		"links":   links,
+	})
+}
+
+// writeError writes a JSON:API error document
+func writeError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jsonapi": map[string]string{"version": "1.0"},
+		"errors": []map[string]string{{
+			"status": strconv.Itoa(status),
+			"title":  http.StatusText(status),
+			"detail": detail,
+		}},
+	})
+}
+
+// writeOAuthError writes an OAuth2 error response
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
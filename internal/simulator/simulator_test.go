@@ -0,0 +1,269 @@
+package simulator_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/z4ce/snyk-auto-org/internal/api"
+	"github.com/z4ce/snyk-auto-org/internal/simulator"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		ctx     = context.Background()
+		fixture *simulator.Fixture
+		sim     *simulator.Server
+		server  *httptest.Server
+		client  *api.SnykClient
+	)
+
+	BeforeEach(func() {
+		var err error
+		fixture, err = simulator.LoadFixture(filepath.Join("testdata", "fixture.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		sim = simulator.New(fixture)
+		server = httptest.NewServer(sim)
+
+		endpoint, err := api.NewEndpoint(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		client = &api.SnykClient{
+			APIToken:    "simulated",
+			RestBaseURL: endpoint.RestBaseURL,
+			HTTPClient:  http.DefaultClient,
+			// One item per page, so that every listing is paginated
+			PageLimit: 1,
+			Retry:     api.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("serves the organizations of the fixture page by page", func() {
+		orgs, err := client.GetOrganizations(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orgs).To(HaveLen(3))
+		Expect(orgs[0].Name).To(Equal("Backend"))
+		Expect(orgs[0].Slug).To(Equal("backend"))
+		Expect(orgs[0].GroupID).To(Equal("group-platform"))
+		Expect(orgs[2].ID).To(Equal("org-sandbox"))
+		Expect(orgs[0].Role).To(Equal("Org Admin"))
+		Expect(orgs[2].Role).To(Equal("Org Viewer"))
+
+		// One request per page
+		Expect(sim.Requests()).To(Equal(3))
+	})
+
+	It("describes the user of a token", func() {
+		client.APIToken = "bob-token"
+		user, err := client.GetSelf(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.ID).To(Equal("user-bob"))
+		Expect(user.String()).To(Equal("Bob (bob@example.com)"))
+
+		client.APIToken = "unknown-token"
+		user, err = client.GetSelf(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.ID).To(Equal(simulator.DefaultUser.ID))
+	})
+
+	It("serves the groups of the fixture", func() {
+		groups, err := client.GetGroups(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(groups).To(HaveLen(1))
+		Expect(groups[0].Name).To(Equal("Platform"))
+	})
+
+	It("serves the targets of an organization with their attributes", func() {
+		targets, err := client.GetTargets(ctx, "org-frontend")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets).To(HaveLen(2))
+		Expect(targets[0].Attributes.DisplayName).To(Equal("acme/web"))
+		Expect(targets[0].Attributes.URL).To(Equal("https://github.com/acme/web"))
+		Expect(targets[0].Attributes.CreatedAt).To(Equal(time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)))
+		Expect(targets[1].IntegrationType()).To(Equal("cli"))
+	})
+
+	It("filters targets by URL", func() {
+		org, err := client.FindOrgWithTargetURL(ctx, "https://github.com/acme/web")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(org.OrgID).To(Equal("org-frontend"))
+		Expect(org.TargetID).To(Equal("target-web"))
+	})
+
+	It("serves the projects of a target", func() {
+		projects, err := client.GetProjectsForTarget(ctx, "org-backend", "target-api")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(projects).To(HaveLen(1))
+		Expect(projects[0].TargetFile).To(Equal("package.json"))
+		Expect(projects[0].IsActive()).To(BeTrue())
+	})
+
+	It("answers unknown organizations with a JSON:API error", func() {
+		_, err := client.GetTargets(ctx, "org-unknown")
+		var apiErr *api.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(apiErr.RequestID).NotTo(BeEmpty())
+		Expect(apiErr.Errors[0].Detail).To(Equal("Organization not found"))
+	})
+
+	Context("with faults", func() {
+		BeforeEach(func() {
+			fixture.Faults = []simulator.Fault{{Path: "/rest/orgs/*/targets", Status: http.StatusTooManyRequests, Times: 2}}
+		})
+
+		It("fails matching requests as many times as asked", func() {
+			targets, err := client.GetTargets(ctx, "org-backend")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(targets).To(HaveLen(1))
+			Expect(sim.Requests()).To(Equal(3))
+		})
+
+		It("fails every matching request without a count", func() {
+			sim.InjectFault(simulator.Fault{Path: "/rest/groups", Status: http.StatusServiceUnavailable})
+
+			_, err := client.GetGroups(ctx)
+			var apiErr *api.APIError
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		})
+
+		It("doesn't fail other requests", func() {
+			_, err := client.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("with tokens", func() {
+		BeforeEach(func() {
+			fixture.Tokens = []string{"valid-token"}
+		})
+
+		It("rejects other tokens", func() {
+			_, err := client.GetOrganizations(ctx)
+			var apiErr *api.APIError
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("accepts the tokens of the fixture and its users", func() {
+			client.APIToken = "valid-token"
+			client.AuthScheme = api.AuthSchemeToken
+			_, err := client.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			client.APIToken = "alice-token"
+			_, err = client.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("logs users in with the authorization code flow", func() {
+			flow := &api.AuthorizationCodeFlow{
+				AuthorizeURL: server.URL + "/oauth2/authorize",
+				Refresher:    api.NewOAuth2TokenRefresher(server.URL+"/oauth2", nil),
+				Ports:        []int{0},
+				OpenBrowser: func(ctx context.Context, authURL string) error {
+					resp, err := http.Get(authURL)
+					if err != nil {
+						return err
+					}
+					return resp.Body.Close()
+				},
+			}
+			token, err := flow.Login(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			client.APIToken = token.AccessToken
+			_, err = client.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			refresher := api.NewOAuth2TokenRefresher(server.URL+"/oauth2", nil)
+			_, err = refresher.RefreshToken(ctx, token.RefreshToken)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects authorization codes it didn't issue", func() {
+			refresher := api.NewOAuth2TokenRefresher(server.URL+"/oauth2", nil)
+			_, err := refresher.ExchangeCode(ctx, "unknown-code", "verifier", "http://127.0.0.1:8080/callback", api.SnykCLIClientID)
+			var apiErr *api.APIError
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.Errors[0].Code).To(Equal("invalid_grant"))
+		})
+
+		It("issues access tokens to the clients of the fixture", func() {
+			refresher := api.NewOAuth2TokenRefresher(server.URL+"/oauth2", nil)
+			token, err := refresher.ClientCredentials(ctx, "ci-client", "ci-secret")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.RefreshToken).To(BeEmpty())
+
+			client.APIToken = token.AccessToken
+			_, err = client.GetOrganizations(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = refresher.ClientCredentials(ctx, "ci-client", "wrong-secret")
+			var apiErr *api.APIError
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.Errors[0].Code).To(Equal("invalid_client"))
+		})
+
+		It("rejects refresh tokens it didn't issue", func() {
+			refresher := api.NewOAuth2TokenRefresher(server.URL+"/oauth2", nil)
+			_, err := refresher.RefreshToken(ctx, "unknown-refresh-token")
+			var apiErr *api.APIError
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.Errors[0].Code).To(Equal("invalid_grant"))
+		})
+	})
+
+	Context("without tokens", func() {
+		It("refreshes any refresh token, rotating it", func() {
+			refresher := api.NewOAuth2TokenRefresher(server.URL+"/oauth2", nil)
+			token, err := refresher.RefreshToken(ctx, "any-refresh-token")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).NotTo(BeEmpty())
+			Expect(token.RefreshToken).NotTo(Equal("any-refresh-token"))
+			Expect(token.ExpiresIn).To(Equal(int(simulator.AccessTokenLifetime.Seconds())))
+		})
+	})
+})
+
+var _ = Describe("LoadFixture", func() {
+	write := func(content string) string {
+		file := filepath.Join(GinkgoT().TempDir(), "fixture.yaml")
+		Expect(os.WriteFile(file, []byte(content), 0600)).To(Succeed())
+		return file
+	}
+
+	It("rejects duplicate IDs", func() {
+		_, err := simulator.LoadFixture(write("orgs:\n  - id: org-1\n  - id: org-1\n"))
+		Expect(err).To(MatchError(ContainSubstring("duplicate id: org-1")))
+	})
+
+	It("rejects organizations of unknown groups", func() {
+		_, err := simulator.LoadFixture(write("orgs:\n  - id: org-1\n    group_id: group-1\n"))
+		Expect(err).To(MatchError(ContainSubstring("unknown group: group-1")))
+	})
+
+	It("rejects faults that aren't errors", func() {
+		_, err := simulator.LoadFixture(write("faults:\n  - status: 200\n"))
+		Expect(err).To(MatchError(ContainSubstring("invalid fault status: 200")))
+	})
+
+	It("rejects malformed YAML", func() {
+		_, err := simulator.LoadFixture(write("orgs: [\n"))
+		Expect(err).To(MatchError(ContainSubstring("failed to parse fixture")))
+	})
+})